@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// authorHandler muestra un autor y sus obras, publicadas y próximas.
+func (app *App) authorHandler(w http.ResponseWriter, r *http.Request) {
+	authorID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || authorID < 1 {
+		http.NotFound(w, r)
+		return
+	}
+	author, err := app.Authors.Get(r.Context(), authorID)
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar el autor", http.StatusInternalServerError)
+		return
+	}
+	books, err := app.Books.ListByAuthor(r.Context(), authorID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar los libros del autor", http.StatusInternalServerError)
+		return
+	}
+
+	data := AuthorPageData{
+		UserName:  app.SessionManager.GetString(r.Context(), "userName"),
+		IsAdmin:   app.SessionManager.GetString(r.Context(), "userRole") == "admin",
+		CSRFToken: app.csrfToken(r),
+	}
+	now := time.Now()
+	for _, book := range books {
+		if book.ReleaseAt.After(now) {
+			book.ReleaseDate = formatMonthYear(book.ReleaseAt)
+			data.Upcoming = append(data.Upcoming, book)
+		} else {
+			book.ReleaseDate = book.ReleaseAt.Format("2006")
+			data.Books = append(data.Books, book)
+		}
+	}
+	author.BookCount = len(books)
+	data.Author = author
+
+	files := app.templateFiles("author.html", "partials/navbar.html")
+	ts, err := template.ParseFiles(files...)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al parsear plantillas de autor", http.StatusInternalServerError)
+		return
+	}
+	ts.ExecuteTemplate(w, "author.html", data)
+}
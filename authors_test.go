@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestAuthorStoreFindOrCreate(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+
+	created, err := app.Authors.FindOrCreate(ctx, "Carmen Laforet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := app.Authors.FindOrCreate(ctx, "CARMEN LAFORET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != created.ID || found.Name != "Carmen Laforet" {
+		t.Errorf("FindOrCreate sin distinguir mayúsculas = %+v, want %+v", found, created)
+	}
+	if authors, _ := app.Authors.List(ctx); len(authors) != 1 {
+		t.Errorf("List = %+v, want un autor", authors)
+	}
+}
+
+func TestAuthorStoreFindOrCreateConcurrent(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	const saves = 50
+
+	// Todas empiezan a la vez para que las consultas y las inserciones se mezclen
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	ids := make(chan int, saves)
+	for i := 0; i < saves; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			a, err := app.Authors.FindOrCreate(ctx, "Ana María Matute")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids <- a.ID
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(ids)
+
+	first := 0
+	for id := range ids {
+		if first == 0 {
+			first = id
+		}
+		if id != first {
+			t.Errorf("FindOrCreate simultáneos devolvieron los IDs %d y %d", first, id)
+		}
+	}
+	if authors, _ := app.Authors.List(ctx); len(authors) != 1 {
+		t.Errorf("List = %+v, want un autor", authors)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// bookTitles devuelve los títulos de los libros, en orden.
+func bookTitles(books []Book) []string {
+	titles := make([]string, len(books))
+	for i, b := range books {
+		titles[i] = b.Title
+	}
+	return titles
+}
+
+func TestBookStoreBrowse(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	now := time.Now()
+	genre := func(name string, parentID int) Genre {
+		t.Helper()
+		g, err := app.Genres.FindOrCreate(ctx, name, parentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return g
+	}
+	terror := genre("Terror", 0)
+	gothic := genre("Gótico", terror.ID)
+	classic := genre("Clásico", 0)
+	series, err := app.Series.FindOrCreate(ctx, "Saga")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dracula := addTestBook(t, app, Book{Title: "Drácula", Genres: []Genre{gothic}, Tags: []string{"vampiros"}})
+	addTestBook(t, app, Book{Title: "It", Genres: []Genre{terror}})
+	addTestBook(t, app, Book{Title: "La Regenta", Genres: []Genre{classic}})
+	addTestBook(t, app, Book{Title: "Saga 1", SeriesID: series.ID, SeriesVolume: 1})
+	addTestBook(t, app, Book{Title: "Saga 2", SeriesID: series.ID, SeriesVolume: 2})
+	addTestBook(t, app, Book{Title: "Próximamente", ReleaseAt: now.Add(24 * time.Hour)})
+	addTestCopies(t, app, dracula.ID, 1)
+
+	// La paginación por clave recorre todos los publicados sin repetir ninguno
+	var titles []string
+	filter := CatalogFilter{Sort: catalogSortTitle, Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("la paginación no termina")
+		}
+		page, err := app.Books.Browse(ctx, now, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 5 {
+			t.Errorf("Total = %d, want 5", page.Total)
+		}
+		titles = append(titles, bookTitles(page.Books)...)
+		if page.NextAfter == 0 {
+			break
+		}
+		filter.After = page.NextAfter
+	}
+	want := []string{"Drácula", "It", "La Regenta", "Saga 1", "Saga 2"}
+	if len(titles) != len(want) {
+		t.Fatalf("títulos = %q, want %q", titles, want)
+	}
+	for i := range want {
+		if titles[i] != want[i] {
+			t.Fatalf("títulos = %q, want %q", titles, want)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter CatalogFilter
+		want   []string
+	}{
+		{"género con sus subgéneros", CatalogFilter{GenreID: terror.ID}, []string{"Drácula", "It"}},
+		{"subgénero", CatalogFilter{GenreID: gothic.ID}, []string{"Drácula"}},
+		{"etiqueta", CatalogFilter{Tag: "vampiros"}, []string{"Drácula"}},
+		{"disponibles", CatalogFilter{Available: true}, []string{"Drácula"}},
+		{"serie agrupada", CatalogFilter{SeriesID: series.ID, CollapseSeries: true}, []string{"Saga 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Sort, tt.filter.Limit = catalogSortTitle, 10
+			page, err := app.Books.Browse(ctx, now, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := bookTitles(page.Books)
+			if len(got) != len(tt.want) {
+				t.Fatalf("títulos = %q, want %q", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("títulos = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// Un libro de un subgénero cuenta también en su género principal
+	page, err := app.Books.Browse(ctx, now, CatalogFilter{Sort: catalogSortTitle, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, f := range page.Facets.Genres {
+		counts[f.Value] = f.Count
+	}
+	if counts["Terror"] != 2 || counts["Gótico"] != 1 || counts["Clásico"] != 1 {
+		t.Errorf("faceta de géneros = %+v", page.Facets.Genres)
+	}
+	if page.Facets.Available != 1 {
+		t.Errorf("faceta de disponibles = %d, want 1", page.Facets.Available)
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const cliUsage = `Uso: ebooks-app <comando> [opciones]
+
+Comandos:
+  serve                          inicia el servidor web (comando por defecto)
+  migrate up                     aplica las migraciones pendientes
+  migrate down [-steps N]        revierte las últimas N migraciones (por defecto 1)
+  migrate status                 muestra el estado de las migraciones
+  seed [--users] [--books] [--loans]
+                                 puebla las tablas indicadas (todas si no se indica ninguna)
+  create-admin --username U --name N --email E [--password P]
+                                 crea un usuario administrador
+  reset-password <username> [--password P]
+                                 cambia la contraseña de un usuario y limpia sus bloqueos
+  reconcile [--fix]              compara las copias de cada libro con sus préstamos y
+                                 reservas; con --fix corrige las discrepancias
+
+Todos los comandos aceptan -config <ruta> (por defecto config.json o EBOOKS_CONFIG).
+Si no se indica --password, la contraseña se lee de la entrada estándar.
+`
+
+// runCLI ejecuta el subcomando indicado en args (sin el nombre del programa).
+func runCLI(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return cmdServe(args)
+	}
+
+	switch args[0] {
+	case "serve":
+		return cmdServe(args[1:])
+	case "migrate":
+		return cmdMigrate(args[1:])
+	case "seed":
+		return cmdSeed(args[1:])
+	case "create-admin":
+		return cmdCreateAdmin(args[1:])
+	case "reset-password":
+		return cmdResetPassword(args[1:])
+	case "reconcile":
+		return cmdReconcile(args[1:])
+	case "help":
+		fmt.Fprint(os.Stdout, cliUsage)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, cliUsage)
+	return fmt.Errorf("comando desconocido: %q", args[0])
+}
+
+// newFlagSet crea un FlagSet con la opción -config común a todos los comandos.
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), cliUsage) }
+	configPath := os.Getenv("EBOOKS_CONFIG")
+	if configPath == "" {
+		configPath = "config.json"
+	}
+	return fs, fs.String("config", configPath, "ruta del archivo de configuración JSON")
+}
+
+// loadCLIConfig carga la configuración. El archivo solo es obligatorio si se
+// indicó explícitamente con -config o EBOOKS_CONFIG.
+func loadCLIConfig(fs *flag.FlagSet, path string) (*Config, error) {
+	explicit := os.Getenv("EBOOKS_CONFIG") != ""
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			explicit = true
+		}
+	})
+	cfg, err := LoadConfig(path, explicit)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo cargar la configuración: %w", err)
+	}
+	log.Printf("Configuración cargada (entorno: %s)", cfg.Env)
+	return cfg, nil
+}
+
+// openCLIApp carga la configuración y abre la aplicación para un comando.
+func openCLIApp(fs *flag.FlagSet, path string) (*App, error) {
+	cfg, err := loadCLIConfig(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	app, err := newApp(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo conectar a la base de datos: %w", err)
+	}
+	return app, nil
+}
+
+// autoMigrate aplica las migraciones pendientes si database.auto_migrate está
+// activo.
+func (app *App) autoMigrate() error {
+	if !app.Config.Database.AutoMigrate {
+		return nil
+	}
+	applied, err := migrateUp(app.DB)
+	if err != nil {
+		return fmt.Errorf("no se pudieron aplicar las migraciones: %w", err)
+	}
+	log.Printf("Migraciones aplicadas al arrancar: %d", applied)
+	return nil
+}
+
+// cmdServe inicia el servidor HTTP.
+func cmdServe(args []string) error {
+	fs, configPath := newFlagSet("serve")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	app, err := openCLIApp(fs, *configPath)
+	if err != nil {
+		return err
+	}
+	defer app.DB.Close()
+
+	if err := app.autoMigrate(); err != nil {
+		return err
+	}
+
+	// Tareas periódicas como la expiración de préstamos vencidos
+	app.startScheduler(context.Background())
+
+	addr := app.Config.Server.Addr
+	fmt.Printf("Servidor escuchando en %s\n", addr)
+	if err := http.ListenAndServe(addr, app.routes()); err != nil {
+		return fmt.Errorf("no se pudo iniciar el servidor: %w", err)
+	}
+	return nil
+}
+
+// cmdMigrate aplica, revierte o muestra el estado de las migraciones.
+func cmdMigrate(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return errors.New("migrate requiere up, down o status")
+	}
+	action := args[0]
+
+	fs, configPath := newFlagSet("migrate " + action)
+	steps := fs.Int("steps", 1, "número de migraciones a revertir (solo down)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	app, err := openCLIApp(fs, *configPath)
+	if err != nil {
+		return err
+	}
+	defer app.DB.Close()
+
+	switch action {
+	case "up":
+		applied, err := migrateUp(app.DB)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Migraciones aplicadas: %d\n", applied)
+	case "down":
+		if *steps < 1 {
+			return errors.New("-steps debe ser mayor que 0")
+		}
+		reverted, err := migrateDown(app.DB, *steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Migraciones revertidas: %d\n", reverted)
+	case "status":
+		status, err := migrationStatus(app.DB)
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			state := "pendiente"
+			if s.Applied {
+				state = "aplicada " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		return fmt.Errorf("acción de migrate desconocida: %q", action)
+	}
+	return nil
+}
+
+// cmdSeed puebla las tablas seleccionadas con datos de prueba.
+func cmdSeed(args []string) error {
+	fs, configPath := newFlagSet("seed")
+	users := fs.Bool("users", false, "poblar usuarios")
+	books := fs.Bool("books", false, "poblar libros")
+	loans := fs.Bool("loans", false, "poblar préstamos")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	app, err := openCLIApp(fs, *configPath)
+	if err != nil {
+		return err
+	}
+	defer app.DB.Close()
+
+	if err := app.autoMigrate(); err != nil {
+		return err
+	}
+
+	if !*users && !*books && !*loans {
+		app.seedDatabase()
+		return nil
+	}
+	if *users {
+		app.seedUsers()
+	}
+	if *books {
+		app.seedBooks()
+	}
+	if *loans {
+		app.seedLoans()
+	}
+	return nil
+}
+
+// cmdCreateAdmin crea un nuevo usuario con rol de administrador.
+func cmdCreateAdmin(args []string) error {
+	fs, configPath := newFlagSet("create-admin")
+	username := fs.String("username", "", "nombre de usuario")
+	name := fs.String("name", "", "nombre completo")
+	email := fs.String("email", "", "correo electrónico")
+	password := fs.String("password", "", "contraseña (si se omite se lee de la entrada estándar)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" || *name == "" || *email == "" {
+		return errors.New("create-admin requiere --username, --name y --email")
+	}
+	app, err := openCLIApp(fs, *configPath)
+	if err != nil {
+		return err
+	}
+	defer app.DB.Close()
+
+	pass, err := passwordArgOrStdin(*password, os.Stdin)
+	if err != nil {
+		return err
+	}
+	if err := app.Config.Password.Validate(pass); err != nil {
+		return err
+	}
+	hashed, err := hashPassword(pass)
+	if err != nil {
+		return fmt.Errorf("error al hashear la contraseña: %w", err)
+	}
+
+	ctx := context.Background()
+	if _, err := app.Users.GetByUsername(ctx, *username); err == nil {
+		return fmt.Errorf("ya existe un usuario %q", *username)
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	admin := User{Username: *username, Name: *name, Email: *email, Password: hashed, Role: "admin"}
+	if err := app.Users.Create(ctx, &admin); err != nil {
+		return fmt.Errorf("error al crear el administrador: %w", err)
+	}
+	fmt.Printf("Administrador %q creado.\n", *username)
+	return nil
+}
+
+// cmdResetPassword cambia la contraseña de un usuario y elimina su bloqueo de login.
+func cmdResetPassword(args []string) error {
+	// El nombre de usuario puede ir antes o después de las opciones
+	var username string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		username, args = args[0], args[1:]
+	}
+	fs, configPath := newFlagSet("reset-password")
+	password := fs.String("password", "", "nueva contraseña (si se omite se lee de la entrada estándar)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if username == "" && fs.NArg() > 0 {
+		username = fs.Arg(0)
+	}
+	if username == "" {
+		return errors.New("reset-password requiere el nombre de usuario")
+	}
+	app, err := openCLIApp(fs, *configPath)
+	if err != nil {
+		return err
+	}
+	defer app.DB.Close()
+
+	pass, err := passwordArgOrStdin(*password, os.Stdin)
+	if err != nil {
+		return err
+	}
+	if err := app.Config.Password.Validate(pass); err != nil {
+		return err
+	}
+	hashed, err := hashPassword(pass)
+	if err != nil {
+		return fmt.Errorf("error al hashear la contraseña: %w", err)
+	}
+
+	ctx := context.Background()
+	err = app.Users.SetPassword(ctx, username, hashed)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("usuario %q no encontrado", username)
+	}
+	if err != nil {
+		return fmt.Errorf("error al actualizar la contraseña: %w", err)
+	}
+	if err := app.LoginFailures.Delete(ctx, throttleScopeUsername, strings.ToLower(username)); err != nil {
+		return fmt.Errorf("error al limpiar el bloqueo de login: %w", err)
+	}
+	fmt.Printf("Contraseña de %q actualizada.\n", username)
+	return nil
+}
+
+// cmdReconcile concilia el inventario e imprime las discrepancias por libro.
+func cmdReconcile(args []string) error {
+	fs, configPath := newFlagSet("reconcile")
+	fix := fs.Bool("fix", false, "corrige las discrepancias encontradas")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	app, err := openCLIApp(fs, *configPath)
+	if err != nil {
+		return err
+	}
+	defer app.DB.Close()
+
+	run, books, err := app.reconcileInventory(context.Background(), time.Now(), *fix, reconcileSourceCommand)
+	if err != nil {
+		return fmt.Errorf("error al conciliar el inventario: %w", err)
+	}
+	for _, inv := range books {
+		if len(inv.Issues) == 0 {
+			continue
+		}
+		fmt.Printf("Libro %d %q: %d copias, %d disponibles, %d préstamos activos, %d reservas apartadas, %d en cola\n",
+			inv.BookID, inv.Title, inv.Capacity, inv.Available, inv.ActiveLoans, inv.ReadyHolds, inv.WaitingHolds)
+		for _, issue := range inv.Issues {
+			state := "pendiente"
+			if issue.Fixed {
+				state = "corregida"
+			}
+			fmt.Printf("  - [%s] %s (%s)\n", issue.Kind, issue.Description, state)
+		}
+	}
+	fmt.Printf("%d libros revisados, %d discrepancias encontradas, %d corregidas.\n", run.BooksChecked, run.IssuesFound, run.IssuesFixed)
+	return nil
+}
+
+// passwordArgOrStdin devuelve la contraseña pasada como opción o, si está
+// vacía, la primera línea leída de in.
+func passwordArgOrStdin(password string, in io.Reader) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+	fmt.Fprint(os.Stderr, "Contraseña: ")
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("no se pudo leer la contraseña: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("la contraseña no puede estar vacía")
+	}
+	return line, nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config agrupa toda la configuración de la aplicación. Se carga desde un
+// archivo JSON y después se aplican las variables de entorno EBOOKS_*.
+type Config struct {
+	Env           string          `json:"env"`
+	Server        ServerConfig    `json:"server"`
+	Database      DatabaseConfig  `json:"database"`
+	Session       SessionConfig   `json:"session"`
+	Paths         PathsConfig     `json:"paths"`
+	Password      PasswordPolicy  `json:"password_policy"`
+	LoginThrottle LoginThrottle   `json:"login_throttle"`
+	Loans         LoanConfig      `json:"loans"`
+	Inventory     InventoryConfig `json:"inventory"`
+	Search        SearchConfig    `json:"search"`
+}
+
+// ServerConfig contiene la configuración del servidor HTTP.
+type ServerConfig struct {
+	Addr string `json:"addr"`
+}
+
+// DatabaseConfig contiene la conexión y el pool de la base de datos.
+type DatabaseConfig struct {
+	// Driver es "mysql", "sqlite" o "postgres".
+	Driver          string   `json:"driver"`
+	DSN             string   `json:"dsn"`
+	MaxOpenConns    int      `json:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+	AutoMigrate     bool     `json:"auto_migrate"`
+}
+
+// SessionConfig contiene la duración de la sesión y los atributos de la cookie.
+type SessionConfig struct {
+	Lifetime      Duration `json:"lifetime"`
+	CookieName    string   `json:"cookie_name"`
+	CookiePersist bool     `json:"cookie_persist"`
+	CookieSecure  bool     `json:"cookie_secure"`
+	SameSite      string   `json:"same_site"`
+}
+
+// PathsConfig contiene los directorios de archivos estáticos, subidas y plantillas.
+type PathsConfig struct {
+	Static    string `json:"static"`
+	Covers    string `json:"covers"`
+	PDFs      string `json:"pdfs"`
+	Templates string `json:"templates"`
+}
+
+// LoanConfig contiene la duración y los límites de los préstamos. ExpiryInterval
+// es cada cuánto se ejecutan las tareas programadas de préstamos, reservas y
+// preventas.
+type LoanConfig struct {
+	Period         Duration `json:"period"`
+	ExpiryInterval Duration `json:"expiry_interval"`
+	// MaxRenewals es cuántas veces se puede renovar un préstamo; cada
+	// renovación amplía la fecha de vencimiento en Period.
+	MaxRenewals int `json:"max_renewals"`
+	// MaxActive es el máximo de préstamos activos por usuario para los roles
+	// que no aparecen en MaxActiveByRole. 0 significa sin límite.
+	MaxActive       int            `json:"max_active"`
+	MaxActiveByRole map[string]int `json:"max_active_by_role"`
+	// HoldPickupWindow es el tiempo que una copia liberada queda apartada para
+	// la primera reserva en cola antes de pasar a la siguiente.
+	HoldPickupWindow Duration `json:"hold_pickup_window"`
+}
+
+// InventoryConfig controla la conciliación periódica del inventario: cada
+// ReconcileInterval se comparan las copias de cada libro con sus préstamos y
+// reservas. Si AutoFix está activo la tarea también corrige lo que encuentra.
+type InventoryConfig struct {
+	ReconcileInterval Duration `json:"reconcile_interval"`
+	AutoFix           bool     `json:"auto_fix"`
+}
+
+// SearchConfig controla el índice de búsqueda del catálogo. Además de tras
+// cada cambio desde el panel, se reconstruye cada RebuildInterval para recoger
+// los libros creados por otros procesos (por ejemplo, seed).
+type SearchConfig struct {
+	RebuildInterval Duration `json:"rebuild_interval"`
+}
+
+// isSubdir indica si dir es parent o está dentro de él.
+func isSubdir(parent, dir string) bool {
+	parentAbs, err1 := filepath.Abs(parent)
+	dirAbs, err2 := filepath.Abs(dir)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	rel, err := filepath.Rel(parentAbs, dirAbs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Duration es un time.Duration que se lee en JSON como texto ("24h", "15m").
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON acepta duraciones como texto ("90s") o como nanosegundos.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("duración inválida %q: %w", value, err)
+		}
+		d.Duration = parsed
+	case float64:
+		d.Duration = time.Duration(value)
+	default:
+		return fmt.Errorf("duración inválida: %s", b)
+	}
+	return nil
+}
+
+// MarshalJSON escribe la duración como texto.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Entornos de ejecución admitidos
+const (
+	envDevelopment = "development"
+	envStaging     = "staging"
+	envProduction  = "production"
+)
+
+// defaultConfig devuelve la configuración de desarrollo (Laragon en local).
+func defaultConfig() *Config {
+	return &Config{
+		Env: envDevelopment,
+		Server: ServerConfig{
+			Addr: ":8080",
+		},
+		Database: DatabaseConfig{
+			Driver:          "mysql",
+			DSN:             "root:@tcp(127.0.0.1:3306)/ebooks_db?parseTime=true",
+			MaxOpenConns:    10,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: Duration{3 * time.Minute},
+			AutoMigrate:     true,
+		},
+		Session: SessionConfig{
+			Lifetime:      Duration{24 * time.Hour},
+			CookieName:    "session",
+			CookiePersist: true,
+			CookieSecure:  false,
+			SameSite:      "lax",
+		},
+		Paths: PathsConfig{
+			Static:    "./static/",
+			Covers:    "./static/book_covers/",
+			PDFs:      "./data/book_pdfs/",
+			Templates: "templates",
+		},
+		Password:      defaultPasswordPolicy,
+		LoginThrottle: defaultLoginThrottle,
+		Loans: LoanConfig{
+			Period:           Duration{14 * 24 * time.Hour},
+			ExpiryInterval:   Duration{time.Minute},
+			MaxRenewals:      2,
+			HoldPickupWindow: Duration{48 * time.Hour},
+			MaxActive:        5,
+			MaxActiveByRole:  map[string]int{"user": 5, "admin": 20},
+		},
+		Inventory: InventoryConfig{
+			ReconcileInterval: Duration{time.Hour},
+			AutoFix:           false,
+		},
+		Search: SearchConfig{
+			RebuildInterval: Duration{10 * time.Minute},
+		},
+	}
+}
+
+// LoadConfig lee la configuración desde path (si existe), aplica las
+// variables de entorno y la valida. Si required es false, un archivo
+// inexistente no es un error y se usan los valores por defecto.
+func LoadConfig(path string, required bool) (*Config, error) {
+	cfg := defaultConfig()
+
+	if path != "" {
+		f, err := os.Open(path)
+		switch {
+		case err == nil:
+			defer f.Close()
+			dec := json.NewDecoder(f)
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(cfg); err != nil {
+				return nil, fmt.Errorf("error al leer la configuración %s: %w", path, err)
+			}
+		case errors.Is(err, os.ErrNotExist) && !required:
+			// Sin archivo se usan los valores por defecto
+		default:
+			return nil, fmt.Errorf("error al abrir la configuración %s: %w", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv sobrescribe la configuración con las variables de entorno EBOOKS_*.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	str := func(dst *string) func(string) error {
+		return func(v string) error { *dst = v; return nil }
+	}
+	integer := func(dst *int) func(string) error {
+		return func(v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return err
+			}
+			*dst = n
+			return nil
+		}
+	}
+	boolean := func(dst *bool) func(string) error {
+		return func(v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			*dst = b
+			return nil
+		}
+	}
+	duration := func(dst *Duration) func(string) error {
+		return func(v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+			dst.Duration = d
+			return nil
+		}
+	}
+
+	overrides := []struct {
+		name  string
+		apply func(string) error
+	}{
+		{"EBOOKS_ENV", str(&c.Env)},
+		{"EBOOKS_ADDR", str(&c.Server.Addr)},
+		{"EBOOKS_DB_DRIVER", str(&c.Database.Driver)},
+		{"EBOOKS_DB_DSN", str(&c.Database.DSN)},
+		{"EBOOKS_DB_MAX_OPEN_CONNS", integer(&c.Database.MaxOpenConns)},
+		{"EBOOKS_DB_MAX_IDLE_CONNS", integer(&c.Database.MaxIdleConns)},
+		{"EBOOKS_DB_CONN_MAX_LIFETIME", duration(&c.Database.ConnMaxLifetime)},
+		{"EBOOKS_DB_AUTO_MIGRATE", boolean(&c.Database.AutoMigrate)},
+		{"EBOOKS_SESSION_LIFETIME", duration(&c.Session.Lifetime)},
+		{"EBOOKS_SESSION_COOKIE_NAME", str(&c.Session.CookieName)},
+		{"EBOOKS_SESSION_COOKIE_PERSIST", boolean(&c.Session.CookiePersist)},
+		{"EBOOKS_SESSION_COOKIE_SECURE", boolean(&c.Session.CookieSecure)},
+		{"EBOOKS_SESSION_SAME_SITE", str(&c.Session.SameSite)},
+		{"EBOOKS_STATIC_DIR", str(&c.Paths.Static)},
+		{"EBOOKS_COVERS_DIR", str(&c.Paths.Covers)},
+		{"EBOOKS_PDFS_DIR", str(&c.Paths.PDFs)},
+		{"EBOOKS_TEMPLATES_DIR", str(&c.Paths.Templates)},
+		{"EBOOKS_PASSWORD_MIN_LENGTH", integer(&c.Password.MinLength)},
+		{"EBOOKS_LOGIN_MAX_FAILURES", integer(&c.LoginThrottle.MaxFailures)},
+		{"EBOOKS_LOGIN_LOCK_DURATION", duration(&c.LoginThrottle.LockDuration)},
+		{"EBOOKS_LOAN_PERIOD", duration(&c.Loans.Period)},
+		{"EBOOKS_LOAN_EXPIRY_INTERVAL", duration(&c.Loans.ExpiryInterval)},
+		{"EBOOKS_LOAN_MAX_RENEWALS", integer(&c.Loans.MaxRenewals)},
+		{"EBOOKS_HOLD_PICKUP_WINDOW", duration(&c.Loans.HoldPickupWindow)},
+		{"EBOOKS_LOAN_MAX_ACTIVE", integer(&c.Loans.MaxActive)},
+		{"EBOOKS_INVENTORY_RECONCILE_INTERVAL", duration(&c.Inventory.ReconcileInterval)},
+		{"EBOOKS_INVENTORY_AUTO_FIX", boolean(&c.Inventory.AutoFix)},
+		{"EBOOKS_SEARCH_REBUILD_INTERVAL", duration(&c.Search.RebuildInterval)},
+	}
+	for _, o := range overrides {
+		v, ok := lookup(o.name)
+		if !ok {
+			continue
+		}
+		if err := o.apply(v); err != nil {
+			return fmt.Errorf("valor inválido en %s: %w", o.name, err)
+		}
+	}
+	return nil
+}
+
+// Validate comprueba que la configuración es coherente antes de arrancar.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, msg string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(msg, args...))
+		}
+	}
+
+	check(c.Env == envDevelopment || c.Env == envStaging || c.Env == envProduction,
+		"env debe ser %q, %q o %q", envDevelopment, envStaging, envProduction)
+	check(c.Server.Addr != "", "server.addr es obligatorio")
+	_, driverErr := dialectFor(c.Database.Driver)
+	check(driverErr == nil, "database.driver debe ser \"mysql\", \"sqlite\" o \"postgres\"")
+	check(c.Database.DSN != "", "database.dsn es obligatorio")
+	check(c.Database.MaxOpenConns > 0, "database.max_open_conns debe ser mayor que 0")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns no puede ser negativo")
+	check(c.Database.ConnMaxLifetime.Duration >= 0, "database.conn_max_lifetime no puede ser negativo")
+	check(c.Session.Lifetime.Duration > 0, "session.lifetime debe ser mayor que 0")
+	check(c.Session.CookieName != "", "session.cookie_name es obligatorio")
+	_, sameSiteErr := c.Session.sameSiteMode()
+	check(sameSiteErr == nil, "session.same_site debe ser \"lax\", \"strict\" o \"none\"")
+	check(!strings.EqualFold(c.Session.SameSite, "none") || c.Session.CookieSecure,
+		"session.same_site \"none\" requiere session.cookie_secure")
+	check(c.Env != envProduction || c.Session.CookieSecure, "en producción session.cookie_secure debe estar activo")
+	check(c.Paths.Static != "", "paths.static es obligatorio")
+	check(c.Paths.Covers != "", "paths.covers es obligatorio")
+	check(c.Paths.PDFs != "", "paths.pdfs es obligatorio")
+	check(c.Paths.PDFs == "" || c.Paths.Static == "" || !isSubdir(c.Paths.Static, c.Paths.PDFs),
+		"paths.pdfs no puede estar dentro de paths.static: los PDFs solo se sirven con /read")
+	check(c.Paths.Templates != "", "paths.templates es obligatorio")
+	check(c.Password.MinLength > 0, "password_policy.min_length debe ser mayor que 0")
+	check(c.LoginThrottle.MaxFailures > 0, "login_throttle.max_failures debe ser mayor que 0")
+	check(c.LoginThrottle.BaseDelay.Duration > 0, "login_throttle.base_delay debe ser mayor que 0")
+	check(c.LoginThrottle.MaxDelay.Duration >= c.LoginThrottle.BaseDelay.Duration, "login_throttle.max_delay no puede ser menor que base_delay")
+	check(c.LoginThrottle.LockDuration.Duration > 0, "login_throttle.lock_duration debe ser mayor que 0")
+	check(c.Loans.Period.Duration > 0, "loans.period debe ser mayor que 0")
+	check(c.Loans.ExpiryInterval.Duration > 0, "loans.expiry_interval debe ser mayor que 0")
+	check(c.Loans.MaxRenewals >= 0, "loans.max_renewals no puede ser negativo")
+	check(c.Loans.HoldPickupWindow.Duration > 0, "loans.hold_pickup_window debe ser mayor que 0")
+	check(c.Loans.MaxActive >= 0, "loans.max_active no puede ser negativo")
+	for role, limit := range c.Loans.MaxActiveByRole {
+		check(limit >= 0, "loans.max_active_by_role.%s no puede ser negativo", role)
+	}
+	check(c.Inventory.ReconcileInterval.Duration > 0, "inventory.reconcile_interval debe ser mayor que 0")
+	check(c.Search.RebuildInterval.Duration > 0, "search.rebuild_interval debe ser mayor que 0")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("configuración inválida:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// sameSiteMode traduce session.same_site al valor de net/http.
+func (s SessionConfig) sameSiteMode() (http.SameSite, error) {
+	switch strings.ToLower(s.SameSite) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("same_site desconocido: %q", s.SameSite)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCopiesPerAdd limita las copias que se crean en una sola operación.
+const maxCopiesPerAdd = 1000
+
+// adminCopiesHandler muestra las copias y licencias de un libro.
+func (app *App) adminCopiesHandler(w http.ResponseWriter, r *http.Request) {
+	bookID, err := strconv.Atoi(r.URL.Query().Get("book_id"))
+	if err != nil || bookID < 1 {
+		http.NotFound(w, r)
+		return
+	}
+	book, err := app.Books.Get(r.Context(), bookID)
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar el libro", http.StatusInternalServerError)
+		return
+	}
+	copies, err := app.Copies.ListByBook(r.Context(), bookID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar las copias", http.StatusInternalServerError)
+		return
+	}
+	for i := range copies {
+		formatCopy(&copies[i])
+	}
+
+	data := AdminCopiesPageData{
+		UserName:       app.SessionManager.GetString(r.Context(), "userName"),
+		IsAdmin:        true,
+		Book:           book,
+		Copies:         copies,
+		SuccessMessage: r.URL.Query().Get("success"),
+		ErrorMessage:   r.URL.Query().Get("error"),
+		CSRFToken:      app.csrfToken(r),
+	}
+
+	files := app.templateFiles("admin_copies.html", "partials/navbar.html")
+	ts, err := template.ParseFiles(files...)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al parsear plantillas de copias", http.StatusInternalServerError)
+		return
+	}
+	ts.ExecuteTemplate(w, "admin_copies.html", data)
+}
+
+// adminCopiesAddHandler añade copias propias o licencias a un libro.
+func (app *App) adminCopiesAddHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	bookID, err := strconv.Atoi(r.FormValue("book_id"))
+	if err != nil || bookID < 1 {
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		return
+	}
+	pageURL := fmt.Sprintf("/admin/copies?book_id=%d", bookID)
+	now := time.Now()
+
+	count, err := strconv.Atoi(strings.TrimSpace(r.FormValue("count")))
+	if err != nil || count < 1 || count > maxCopiesPerAdd {
+		http.Redirect(w, r, pageURL+"&error=cantidad_invalida", http.StatusSeeOther)
+		return
+	}
+	c := Copy{BookID: bookID, AcquiredAt: now}
+	if v := strings.TrimSpace(r.FormValue("acquired_at")); v != "" {
+		if c.AcquiredAt, err = parseDateTimeInput(v); err != nil {
+			http.Redirect(w, r, pageURL+"&error=fecha_invalida", http.StatusSeeOther)
+			return
+		}
+	}
+	// Licencia: préstamos incluidos y fecha de caducidad, ambos opcionales
+	if v := strings.TrimSpace(r.FormValue("licence_loans")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Redirect(w, r, pageURL+"&error=licencia_invalida", http.StatusSeeOther)
+			return
+		}
+		c.LicenceLoansRemaining = sql.NullInt64{Int64: int64(n), Valid: true}
+	}
+	if v := strings.TrimSpace(r.FormValue("licence_expires_at")); v != "" {
+		expiresAt, err := parseDateTimeInput(v)
+		if err != nil || !expiresAt.After(now) {
+			http.Redirect(w, r, pageURL+"&error=licencia_invalida", http.StatusSeeOther)
+			return
+		}
+		c.LicenceExpiresAt = sql.NullTime{Time: expiresAt, Valid: true}
+	}
+
+	err = app.Copies.Add(r.Context(), c, count, now)
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error al añadir copias al libro %d: %v", bookID, err)
+		http.Error(w, "Error de servidor al añadir copias", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Copias: %d añadidas al libro %d", count, bookID)
+	http.Redirect(w, r, pageURL+"&success=copias_anadidas", http.StatusSeeOther)
+}
+
+// adminCopyRetireHandler retira una copia disponible.
+func (app *App) adminCopyRetireHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	bookID, err := strconv.Atoi(r.FormValue("book_id"))
+	if err != nil || bookID < 1 {
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		return
+	}
+	copyID, err := strconv.Atoi(r.FormValue("copy_id"))
+	if err != nil {
+		http.Error(w, "ID de copia inválido", http.StatusBadRequest)
+		return
+	}
+	pageURL := fmt.Sprintf("/admin/copies?book_id=%d", bookID)
+
+	err = app.Copies.Retire(r.Context(), bookID, copyID, time.Now())
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Redirect(w, r, pageURL+"&error=copia_no_encontrada", http.StatusSeeOther)
+		return
+	case errors.Is(err, ErrCopyInUse):
+		http.Redirect(w, r, pageURL+"&error=copia_en_uso", http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("Error al retirar la copia %d: %v", copyID, err)
+		http.Error(w, "Error de servidor al retirar la copia", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Copias: copia %d del libro %d retirada", copyID, bookID)
+	http.Redirect(w, r, pageURL+"&success=copia_retirada", http.StatusSeeOther)
+}
+
+// formatCopy rellena los campos de presentación de una copia.
+func formatCopy(c *Copy) {
+	c.AcquiredAtFormatted = c.AcquiredAt.Local().Format("02/01/2006 15:04")
+	if c.LicenceExpiresAt.Valid {
+		c.LicenceExpiresAtFormatted = c.LicenceExpiresAt.Time.Local().Format("02/01/2006 15:04")
+	}
+	if c.RetiredAt.Valid {
+		c.RetiredAtFormatted = c.RetiredAt.Time.Local().Format("02/01/2006 15:04")
+	}
+}
+
+// retireExpiredLicences es la tarea programada que retira las licencias
+// vencidas que no están prestadas. Las prestadas se retiran al devolverse.
+func (app *App) retireExpiredLicences(ctx context.Context, now time.Time) error {
+	retired, err := app.Copies.RetireExpired(ctx, now)
+	for _, c := range retired {
+		log.Printf("Licencia vencida: copia %d del libro %d retirada", c.ID, c.BookID)
+	}
+	return err
+}
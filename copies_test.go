@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// copyWithStatus devuelve la primera copia del libro con el estado indicado.
+func copyWithStatus(t *testing.T, app *App, bookID int, status string) Copy {
+	t.Helper()
+	copies, err := app.Copies.ListByBook(context.Background(), bookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range copies {
+		if c.Status == status {
+			return c
+		}
+	}
+	t.Fatalf("el libro %d no tiene copias %s: %+v", bookID, status, copies)
+	return Copy{}
+}
+
+func TestCopyStoreRetire(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	user := addTestUser(t, app, User{Username: "lector", Name: "Lector"})
+	book := addTestBook(t, app, Book{Title: "Niebla"})
+	other := addTestBook(t, app, Book{Title: "Nada"})
+	addTestCopies(t, app, book.ID, 2)
+	addTestCopies(t, app, other.ID, 1)
+	now := time.Now()
+
+	if err := app.Copies.Add(ctx, Copy{BookID: 9999, AcquiredAt: now}, 1, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Add a un libro inexistente: error = %v, want ErrNotFound", err)
+	}
+	if err := app.Loans.Create(ctx, user.ID, book.ID, now, now.Add(time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+	loaned := copyWithStatus(t, app, book.ID, "loaned")
+	available := copyWithStatus(t, app, book.ID, "available")
+
+	if err := app.Copies.Retire(ctx, book.ID, loaned.ID, now); !errors.Is(err, ErrCopyInUse) {
+		t.Errorf("Retire de una copia prestada: error = %v, want ErrCopyInUse", err)
+	}
+	if err := app.Copies.Retire(ctx, other.ID, available.ID, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Retire con otro libro: error = %v, want ErrNotFound", err)
+	}
+	if err := app.Copies.Retire(ctx, book.ID, 9999, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Retire de una copia inexistente: error = %v, want ErrNotFound", err)
+	}
+	if err := app.Copies.Retire(ctx, book.ID, available.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Copies.Retire(ctx, book.ID, available.ID, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Retire de una copia retirada: error = %v, want ErrNotFound", err)
+	}
+	if got, _ := app.Books.Get(ctx, book.ID); got.Stock != 0 {
+		t.Errorf("Stock = %d tras retirar, want 0", got.Stock)
+	}
+	if got, _ := app.Books.Get(ctx, other.ID); got.Stock != 1 {
+		t.Errorf("Stock del otro libro = %d, want 1", got.Stock)
+	}
+	retired := copyWithStatus(t, app, book.ID, "retired")
+	if !retired.RetiredAt.Valid {
+		t.Errorf("copia retirada sin fecha: %+v", retired)
+	}
+}
+
+func TestCopyLicences(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	user := addTestUser(t, app, User{Username: "lector", Name: "Lector"})
+	now := time.Now().Truncate(time.Second)
+
+	// Una licencia de un solo préstamo se retira al devolverse
+	limited := addTestBook(t, app, Book{Title: "Un préstamo"})
+	licence := Copy{BookID: limited.ID, AcquiredAt: now, LicenceLoansRemaining: sql.NullInt64{Int64: 1, Valid: true}}
+	if err := app.Copies.Add(ctx, licence, 1, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Loans.Create(ctx, user.ID, limited.ID, now, now.Add(time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+	if c := copyWithStatus(t, app, limited.ID, "loaned"); c.LicenceLoansRemaining.Int64 != 0 {
+		t.Errorf("préstamos restantes = %d, want 0", c.LicenceLoansRemaining.Int64)
+	}
+	if err := app.Loans.Return(ctx, user.ID, limited.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	copyWithStatus(t, app, limited.ID, "retired")
+	if got, _ := app.Books.Get(ctx, limited.ID); got.Stock != 0 {
+		t.Errorf("Stock con la licencia agotada = %d, want 0", got.Stock)
+	}
+
+	// Una licencia con fecha de fin se retira al vencer; una propia no
+	expiring := addTestBook(t, app, Book{Title: "Temporal"})
+	licence = Copy{BookID: expiring.ID, AcquiredAt: now, LicenceExpiresAt: sql.NullTime{Time: now.Add(time.Hour), Valid: true}}
+	if err := app.Copies.Add(ctx, licence, 1, now); err != nil {
+		t.Fatal(err)
+	}
+	addTestCopies(t, app, expiring.ID, 1)
+	if retired, _ := app.Copies.RetireExpired(ctx, now); len(retired) != 0 {
+		t.Errorf("RetireExpired antes de vencer = %+v", retired)
+	}
+	retired, err := app.Copies.RetireExpired(ctx, now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retired) != 1 || retired[0].BookID != expiring.ID || !retired[0].LicenceExpiresAt.Valid {
+		t.Fatalf("RetireExpired = %+v, want la licencia vencida", retired)
+	}
+	if got, _ := app.Books.Get(ctx, expiring.ID); got.Stock != 1 {
+		t.Errorf("Stock tras vencer la licencia = %d, want 1", got.Stock)
+	}
+}
+
+func TestAdminCopyRetireHandler(t *testing.T) {
+	app := newSQLTestApp(t)
+	admin := addTestUser(t, app, User{Username: "admin", Name: "Admin", Role: "admin"})
+	book := addTestBook(t, app, Book{Title: "Niebla"})
+	other := addTestBook(t, app, Book{Title: "Nada"})
+	addTestCopies(t, app, book.ID, 1)
+	c := copyWithStatus(t, app, book.ID, "available")
+	session := testSession{UserID: admin.ID, Role: admin.Role}
+	retire := func(bookID int) string {
+		form := url.Values{"book_id": {strconv.Itoa(bookID)}, "copy_id": {strconv.Itoa(c.ID)}}
+		w, _ := serveTest(t, app, http.HandlerFunc(app.adminCopyRetireHandler), http.MethodPost, "/admin/copies/retire", form, session)
+		return w.Header().Get("Location")
+	}
+
+	// La copia de otro libro no se retira desde la página de este
+	if got, want := retire(other.ID), "/admin/copies?book_id="+strconv.Itoa(other.ID)+"&error=copia_no_encontrada"; got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+	copyWithStatus(t, app, book.ID, "available")
+	if got, want := retire(book.ID), "/admin/copies?book_id="+strconv.Itoa(book.ID)+"&success=copia_retirada"; got != want {
+		t.Errorf("Location = %q, want %q", got, want)
+	}
+	copyWithStatus(t, app, book.ID, "retired")
+}
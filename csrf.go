@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"net/http"
+)
+
+const (
+	// csrfSessionKey es la clave de la sesión donde se guarda el token CSRF.
+	csrfSessionKey = "csrfToken"
+	// csrfFormField es el campo oculto que deben incluir los formularios.
+	csrfFormField = "csrf_token"
+	// csrfHeader permite enviar el token en peticiones que no son formularios.
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrfToken devuelve el token CSRF de la sesión actual, generándolo si aún no existe.
+func (app *App) csrfToken(r *http.Request) string {
+	token := app.SessionManager.GetString(r.Context(), csrfSessionKey)
+	if token != "" {
+		return token
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Error al generar token CSRF: %v", err)
+		return ""
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	app.SessionManager.Put(r.Context(), csrfSessionKey, token)
+	return token
+}
+
+// csrfProtect es un middleware que rechaza con 403 las peticiones que modifican
+// estado (POST, PUT, PATCH, DELETE) cuyo token no coincide con el de la sesión.
+// Debe ir dentro de SessionManager.LoadAndSave para tener acceso a la sesión.
+func (app *App) csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		expected := app.SessionManager.GetString(r.Context(), csrfSessionKey)
+		sent := r.Header.Get(csrfHeader)
+		if sent == "" {
+			sent = r.FormValue(csrfFormField)
+		}
+		if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(sent)) != 1 {
+			log.Printf("Petición rechazada por token CSRF inválido: %s %s desde %s", r.Method, r.URL.Path, clientIP(r))
+			http.Error(w, "Token CSRF inválido", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
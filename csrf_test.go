@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		noSession  bool   // La sesión aún no tiene token
+		field      string // Token enviado en el formulario: "valid", "wrong" o vacío
+		header     string // Token enviado en la cabecera: "valid", "wrong" o vacío
+		wantStatus int
+	}{
+		{name: "GET sin token", method: http.MethodGet, wantStatus: http.StatusNoContent},
+		{name: "HEAD sin token", method: http.MethodHead, wantStatus: http.StatusNoContent},
+		{name: "POST sin token", method: http.MethodPost, wantStatus: http.StatusForbidden},
+		{name: "POST con token en el formulario", method: http.MethodPost, field: "valid", wantStatus: http.StatusNoContent},
+		{name: "POST con token en la cabecera", method: http.MethodPost, header: "valid", wantStatus: http.StatusNoContent},
+		{name: "POST con token incorrecto", method: http.MethodPost, field: "wrong", wantStatus: http.StatusForbidden},
+		{name: "la cabecera tiene prioridad", method: http.MethodPost, field: "valid", header: "wrong", wantStatus: http.StatusForbidden},
+		{name: "DELETE sin token", method: http.MethodDelete, wantStatus: http.StatusForbidden},
+		{name: "sesión sin token", method: http.MethodPost, noSession: true, field: "wrong", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+			h := app.csrfProtect(next)
+
+			ctx, err := app.SessionManager.Load(context.Background(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var token string
+			if !tt.noSession {
+				session := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+				token = app.csrfToken(session)
+				if token == "" {
+					t.Fatal("csrfToken devolvió un token vacío")
+				}
+				if again := app.csrfToken(session); again != token {
+					t.Fatalf("csrfToken cambió dentro de la misma sesión: %q y %q", token, again)
+				}
+			}
+			value := func(kind string) string {
+				if kind == "valid" {
+					return token
+				}
+				return kind
+			}
+
+			form := url.Values{}
+			if tt.field != "" {
+				form.Set(csrfFormField, value(tt.field))
+			}
+			r := httptest.NewRequest(tt.method, "/loan/create", strings.NewReader(form.Encode())).WithContext(ctx)
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.header != "" {
+				r.Header.Set(csrfHeader, value(tt.header))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAdminHandlersRejectGet(t *testing.T) {
+	app := newTestApp(t)
+	handlers := map[string]http.HandlerFunc{
+		"/admin/books/save":   app.adminBookSaveHandler,
+		"/admin/books/delete": app.adminBookDeleteHandler,
+		"/admin/users/save":   app.adminUserSaveHandler,
+		"/admin/users/delete": app.adminUserDeleteHandler,
+	}
+	for path, h := range handlers {
+		w, _ := serveTest(t, app, h, http.MethodGet, path+"?id=1", nil, testSession{UserID: 1, Role: "admin"})
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: status = %d, want %d", path, w.Code, http.StatusMethodNotAllowed)
+		}
+	}
+}
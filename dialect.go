@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect describe las diferencias entre los motores de base de datos soportados.
+type dialect struct {
+	// name es el valor de database.driver y el subdirectorio de migrations/.
+	name string
+	// driverName es el nombre registrado en database/sql.
+	driverName string
+	// prepareDSN completa el DSN con las opciones que la aplicación necesita.
+	prepareDSN func(dsn string) string
+	// singleWriter indica que el motor solo admite un escritor a la vez, por lo
+	// que el pool se limita a una conexión.
+	singleWriter bool
+	// numberedParams indica que el motor usa marcadores $1, $2... en lugar de "?".
+	numberedParams bool
+	// returningID indica que el ID de un INSERT se obtiene con RETURNING id
+	// porque el driver no implementa LastInsertId.
+	returningID bool
+	// timestampType es el tipo de columna para fechas con hora.
+	timestampType string
+	// forUpdate se añade a un SELECT para bloquear las filas leídas hasta el fin
+	// de la transacción. SQLite no lo necesita porque serializa las escrituras.
+	forUpdate string
+	// onDuplicateKey indica que el motor hace los upserts con ON DUPLICATE KEY
+	// UPDATE en lugar de ON CONFLICT ... DO UPDATE.
+	onDuplicateKey bool
+}
+
+var (
+	mysqlDialect = &dialect{
+		name:           "mysql",
+		driverName:     "mysql",
+		prepareDSN:     func(dsn string) string { return dsn },
+		timestampType:  "DATETIME",
+		forUpdate:      " FOR UPDATE",
+		onDuplicateKey: true,
+	}
+	sqliteDialect = &dialect{
+		name:       "sqlite",
+		driverName: "sqlite",
+		// Las claves foráneas (ON DELETE CASCADE) están desactivadas por defecto en SQLite.
+		// _time_format=sqlite guarda las fechas en un formato que entienden las
+		// funciones de fecha de SQLite (datetime, date...).
+		prepareDSN: func(dsn string) string {
+			for _, pragma := range []string{"foreign_keys(1)", "busy_timeout(5000)"} {
+				if !strings.Contains(dsn, pragma) {
+					dsn = appendDSNParam(dsn, "_pragma="+pragma)
+				}
+			}
+			if !strings.Contains(dsn, "_time_format=") {
+				dsn = appendDSNParam(dsn, "_time_format=sqlite")
+			}
+			return dsn
+		},
+		singleWriter:  true,
+		timestampType: "DATETIME",
+	}
+	postgresDialect = &dialect{
+		name:           "postgres",
+		driverName:     "pgx",
+		prepareDSN:     func(dsn string) string { return dsn },
+		numberedParams: true,
+		returningID:    true,
+		timestampType:  "TIMESTAMPTZ",
+		forUpdate:      " FOR UPDATE",
+	}
+)
+
+// dialects contiene los motores seleccionables con database.driver.
+var dialects = map[string]*dialect{
+	mysqlDialect.name:    mysqlDialect,
+	sqliteDialect.name:   sqliteDialect,
+	postgresDialect.name: postgresDialect,
+}
+
+// dialectFor devuelve el dialecto del driver configurado.
+func dialectFor(driver string) (*dialect, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("driver de base de datos desconocido: %q", driver)
+	}
+	return d, nil
+}
+
+// appendDSNParam añade un parámetro a un DSN con formato de URL.
+func appendDSNParam(dsn, param string) string {
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + param
+	}
+	return dsn + "?" + param
+}
+
+// rebind traduce los marcadores "?" de la consulta al formato del dialecto.
+// Los "?" dentro de literales entre comillas simples se respetan.
+func (d *dialect) rebind(query string) string {
+	if !d.numberedParams {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	inQuote := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+		case c == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// upsert completa un INSERT para que, si ya existe una fila con la misma clave
+// (las columnas keys), actualice en ella las columnas update con los valores
+// que se intentaban insertar.
+func (d *dialect) upsert(insert string, keys, update []string) string {
+	set := make([]string, len(update))
+	for i, col := range update {
+		if d.onDuplicateKey {
+			set[i] = col + " = VALUES(" + col + ")"
+		} else {
+			set[i] = col + " = excluded." + col
+		}
+	}
+	return d.upsertSet(insert, keys, strings.Join(set, ", "))
+}
+
+// upsertSet es upsert con las asignaciones de set en lugar de los valores que
+// se intentaban insertar. En set las columnas de la fila existente se nombran
+// con la tabla delante (tabla.columna), que todos los motores aceptan.
+func (d *dialect) upsertSet(insert string, keys []string, set string) string {
+	if d.onDuplicateKey {
+		return insert + " ON DUPLICATE KEY UPDATE " + set
+	}
+	return insert + " ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET " + set
+}
+
+// execQueryer es común a sqlDB y sqlTx.
+type execQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insert ejecuta un INSERT en una tabla con columna id y devuelve el ID generado.
+func (d *dialect) insert(ctx context.Context, q execQueryer, query string, args ...interface{}) (int64, error) {
+	if d.returningID {
+		var id int64
+		err := q.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	res, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// insertOrGetID ejecuta un INSERT en una tabla con columna id y una clave
+// única en la columna key, y devuelve el ID de la fila insertada o, si la
+// clave ya existía, el de la fila existente, que no se modifica. A diferencia
+// de consultar antes de insertar, no falla si otra petición crea la misma fila
+// a la vez, ni deja abortada la transacción en PostgreSQL.
+func (d *dialect) insertOrGetID(ctx context.Context, q execQueryer, table, key, query string, args ...interface{}) (int64, error) {
+	if d.onDuplicateKey {
+		// LAST_INSERT_ID(id) hace que LastInsertId devuelva el ID de la fila existente
+		res, err := q.ExecContext(ctx, query+" ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)", args...)
+		if err != nil {
+			return 0, err
+		}
+		return res.LastInsertId()
+	}
+	// La actualización no cambia nada, pero hace que RETURNING devuelva también
+	// la fila existente
+	var id int64
+	err := q.QueryRowContext(ctx, query+" ON CONFLICT ("+key+") DO UPDATE SET "+key+" = "+table+"."+key+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// sqlDB envuelve la conexión para adaptar consultas y argumentos al dialecto.
+// Los stores escriben SQL portable con marcadores "?" y fechas calculadas en Go;
+// los marcadores se traducen con rebind antes de llegar al driver.
+type sqlDB struct {
+	*sql.DB
+	dialect *dialect
+}
+
+// sqlTx es una transacción de sqlDB con la misma adaptación de argumentos.
+type sqlTx struct {
+	*sql.Tx
+	dialect *dialect
+}
+
+// normalizeArgs guarda todas las fechas en UTC para que las comparaciones
+// sean correctas también en motores que almacenan las fechas como texto.
+func normalizeArgs(args []interface{}) []interface{} {
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			args[i] = v.UTC()
+		case sql.NullTime:
+			if v.Valid {
+				args[i] = sql.NullTime{Time: v.Time.UTC(), Valid: true}
+			}
+		}
+	}
+	return args
+}
+
+func (db *sqlDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, db.dialect.rebind(query), normalizeArgs(args)...)
+}
+
+func (db *sqlDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, db.dialect.rebind(query), normalizeArgs(args)...)
+}
+
+func (db *sqlDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRowContext(ctx, db.dialect.rebind(query), normalizeArgs(args)...)
+}
+
+func (db *sqlDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sqlTx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, dialect: db.dialect}, nil
+}
+
+func (tx *sqlTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.dialect.rebind(query), normalizeArgs(args)...)
+}
+
+func (tx *sqlTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, tx.dialect.rebind(query), normalizeArgs(args)...)
+}
+
+func (tx *sqlTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.dialect.rebind(query), normalizeArgs(args)...)
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestDialectRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect *dialect
+		query   string
+		want    string
+	}{
+		{"mysql no cambia", mysqlDialect, "SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = ? AND b = ?"},
+		{"sqlite no cambia", sqliteDialect, "SELECT * FROM t WHERE a = ?", "SELECT * FROM t WHERE a = ?"},
+		{"postgres numera", postgresDialect, "SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"postgres sin marcadores", postgresDialect, "SELECT 1", "SELECT 1"},
+		{"postgres respeta literales", postgresDialect, "SELECT '?' FROM t WHERE a = ? AND b = 'x?y'", "SELECT '?' FROM t WHERE a = $1 AND b = 'x?y'"},
+		{"postgres comilla escapada", postgresDialect, "SELECT 'it''s ?' FROM t WHERE a = ?", "SELECT 'it''s ?' FROM t WHERE a = $1"},
+		{"postgres más de nueve", postgresDialect, "VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", "VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.rebind(tt.query); got != tt.want {
+				t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDialectUpsert(t *testing.T) {
+	insert := "INSERT INTO t (a, b, c) VALUES (?, ?, ?)"
+	tests := []struct {
+		dialect *dialect
+		want    string
+	}{
+		{mysqlDialect, insert + " ON DUPLICATE KEY UPDATE b = VALUES(b), c = VALUES(c)"},
+		{sqliteDialect, insert + " ON CONFLICT (a) DO UPDATE SET b = excluded.b, c = excluded.c"},
+		{postgresDialect, insert + " ON CONFLICT (a) DO UPDATE SET b = excluded.b, c = excluded.c"},
+	}
+	for _, tt := range tests {
+		if got := tt.dialect.upsert(insert, []string{"a"}, []string{"b", "c"}); got != tt.want {
+			t.Errorf("%s: upsert = %q, want %q", tt.dialect.name, got, tt.want)
+		}
+	}
+}
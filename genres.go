@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// adminGenresHandler muestra los géneros con el número de libros de cada uno.
+func (app *App) adminGenresHandler(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.Genres.List(r.Context())
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar los géneros", http.StatusInternalServerError)
+		return
+	}
+
+	data := AdminGenresPageData{
+		UserName:       app.SessionManager.GetString(r.Context(), "userName"),
+		IsAdmin:        true,
+		Genres:         genres,
+		SuccessMessage: r.URL.Query().Get("success"),
+		ErrorMessage:   r.URL.Query().Get("error"),
+		CSRFToken:      app.csrfToken(r),
+	}
+
+	files := app.templateFiles("admin_genres.html", "partials/navbar.html")
+	ts, err := template.ParseFiles(files...)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al parsear plantillas de géneros", http.StatusInternalServerError)
+		return
+	}
+	ts.ExecuteTemplate(w, "admin_genres.html", data)
+}
+
+// adminGenreSaveHandler crea un género o, con genre_id, lo renombra o lo mueve
+// a otro género principal. Los libros enlazados muestran el nuevo nombre.
+func (app *App) adminGenreSaveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	genre := Genre{Name: strings.Join(strings.Fields(r.FormValue("name")), " ")}
+	if v := r.FormValue("genre_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			http.Error(w, "ID de género inválido", http.StatusBadRequest)
+			return
+		}
+		genre.ID = id
+	}
+	// Sin parent_id es un género principal
+	if v := r.FormValue("parent_id"); v != "" && v != "0" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			http.Redirect(w, r, "/admin/genres?error=genero_no_encontrado", http.StatusSeeOther)
+			return
+		}
+		genre.ParentID = id
+	}
+	if genre.Name == "" {
+		http.Redirect(w, r, "/admin/genres?error=nombre_requerido", http.StatusSeeOther)
+		return
+	}
+	if utf8.RuneCountInString(genre.Name) > 100 {
+		http.Redirect(w, r, "/admin/genres?error=texto_demasiado_largo", http.StatusSeeOther)
+		return
+	}
+
+	var err error
+	success := "genero_creado"
+	if genre.ID == 0 {
+		err = app.Genres.Create(r.Context(), &genre)
+	} else {
+		err = app.Genres.Update(r.Context(), genre)
+		success = "genero_actualizado"
+	}
+	if code := genreErrorCode(err); code != "" {
+		http.Redirect(w, r, "/admin/genres?error="+code, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("Error al guardar el género %q: %v", genre.Name, err)
+		http.Error(w, "Error de servidor al guardar el género", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Géneros: género %d guardado como %q", genre.ID, genre.Name)
+	app.refreshSearchIndex(r.Context())
+	http.Redirect(w, r, "/admin/genres?success="+success, http.StatusSeeOther)
+}
+
+// adminGenreMergeHandler fusiona el género source_id en target_id: sus libros
+// y subgéneros pasan a target_id y source_id se elimina.
+func (app *App) adminGenreMergeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	sourceID, err := strconv.Atoi(r.FormValue("source_id"))
+	if err != nil || sourceID < 1 {
+		http.Error(w, "ID de género inválido", http.StatusBadRequest)
+		return
+	}
+	targetID, err := strconv.Atoi(r.FormValue("target_id"))
+	if err != nil || targetID < 1 {
+		http.Redirect(w, r, "/admin/genres?error=genero_no_encontrado", http.StatusSeeOther)
+		return
+	}
+	if sourceID == targetID {
+		http.Redirect(w, r, "/admin/genres?error=mismo_genero", http.StatusSeeOther)
+		return
+	}
+
+	err = app.Genres.Merge(r.Context(), sourceID, targetID)
+	if code := genreErrorCode(err); code != "" {
+		http.Redirect(w, r, "/admin/genres?error="+code, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("Error al fusionar el género %d en %d: %v", sourceID, targetID, err)
+		http.Error(w, "Error de servidor al fusionar los géneros", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Géneros: género %d fusionado en %d por %s", sourceID, targetID, app.SessionManager.GetString(r.Context(), "userName"))
+	app.refreshSearchIndex(r.Context())
+	http.Redirect(w, r, "/admin/genres?success=generos_fusionados", http.StatusSeeOther)
+}
+
+// genreErrorCode traduce los errores de GenreStore que se deben al formulario
+// a un código para ?error=; devuelve "" para el resto.
+func genreErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrUnknownGenre):
+		return "genero_no_encontrado"
+	case errors.Is(err, ErrGenreExists):
+		return "genero_duplicado"
+	case errors.Is(err, ErrGenreHierarchy):
+		return "jerarquia_invalida"
+	}
+	return ""
+}
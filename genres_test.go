@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestGenreStoreFindOrCreate(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+
+	terror, err := app.Genres.FindOrCreate(ctx, "Terror", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gothic, err := app.Genres.FindOrCreate(ctx, "Gótico", terror.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gothic.ParentID != terror.ID || gothic.ParentName != "Terror" {
+		t.Errorf("subgénero creado = %+v", gothic)
+	}
+	// Si ya existe no cambia de género principal
+	found, err := app.Genres.FindOrCreate(ctx, "gótico", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != gothic.ID || found.ParentID != terror.ID {
+		t.Errorf("FindOrCreate de un género existente = %+v, want %+v", found, gothic)
+	}
+}
+
+func TestGenreAndTagCreationConcurrent(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	const saves = 20
+
+	// Todas empiezan a la vez para que las consultas y las inserciones se mezclen
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < saves; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			genre, err := app.Genres.FindOrCreate(ctx, "Misterio", 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			book := Book{Title: fmt.Sprintf("Libro %d", i), Genres: []Genre{genre}, Tags: []string{"detectives", "Clásico"}}
+			if err := app.Books.Create(ctx, &book); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	genres, _ := app.Genres.List(ctx)
+	if len(genres) != 1 || genres[0].BookCount != saves {
+		t.Errorf("List = %+v, want un género con %d libros", genres, saves)
+	}
+	var tags int
+	if err := app.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM tags").Scan(&tags); err != nil {
+		t.Fatal(err)
+	}
+	if tags != 2 {
+		t.Errorf("%d etiquetas, want 2", tags)
+	}
+}
+
+func TestGenreStoreMerge(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	genre := func(name string, parentID int) Genre {
+		t.Helper()
+		g, err := app.Genres.FindOrCreate(ctx, name, parentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return g
+	}
+	terror := genre("Terror", 0)
+	horror := genre("Horror", 0)
+	gothic := genre("Gótico", horror.ID)
+	classic := genre("Clásico", 0)
+	both := addTestBook(t, app, Book{Title: "Drácula", Genres: []Genre{horror, terror}})
+	sub := addTestBook(t, app, Book{Title: "El monje", Genres: []Genre{gothic, classic}})
+
+	if err := app.Genres.Merge(ctx, horror.ID, gothic.ID); !errors.Is(err, ErrGenreHierarchy) {
+		t.Errorf("Merge en su propio subgénero: error = %v, want ErrGenreHierarchy", err)
+	}
+	if err := app.Genres.Merge(ctx, horror.ID, horror.ID); !errors.Is(err, ErrGenreHierarchy) {
+		t.Errorf("Merge consigo mismo: error = %v, want ErrGenreHierarchy", err)
+	}
+	if err := app.Genres.Merge(ctx, horror.ID, 9999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Merge en un género inexistente: error = %v, want ErrNotFound", err)
+	}
+
+	if err := app.Genres.Merge(ctx, horror.ID, terror.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.Genres.Get(ctx, horror.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get del género fusionado: error = %v, want ErrNotFound", err)
+	}
+	if got, _ := app.Genres.Get(ctx, gothic.ID); got.ParentID != terror.ID {
+		t.Errorf("subgénero tras fusionar = %+v, want dentro de Terror", got)
+	}
+	// El libro que tenía los dos géneros se queda con uno; el texto de
+	// books.genre se recalcula también en los libros de los subgéneros
+	got, err := app.Books.Get(ctx, both.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Genres) != 1 || got.Genres[0].ID != terror.ID || got.Genre != "Terror" {
+		t.Errorf("%s tras fusionar: Genres %+v, Genre %q", got.Title, got.Genres, got.Genre)
+	}
+	if got, _ := app.Books.Get(ctx, sub.ID); got.Genre != "Terror > Gótico, Clásico" {
+		t.Errorf("%s tras fusionar: Genre %q", got.Title, got.Genre)
+	}
+}
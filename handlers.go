@@ -2,17 +2,19 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
+	"unicode/utf8"
 )
 
 type MyLoansPageData struct {
@@ -21,6 +23,30 @@ type MyLoansPageData struct {
 	Loans          []Loan
 	SuccessMessage string
 	ErrorMessage   string
+	CSRFToken      string
+}
+
+// CatalogPageData se utiliza para la plantilla catalog.html. Filter contiene
+// los filtros aplicados y NextPageURL el enlace a la página siguiente (vacío
+// en la última).
+type CatalogPageData struct {
+	UserName    string
+	IsAdmin     bool
+	Books       []Book
+	Total       int
+	SearchQuery string
+	Filter      CatalogFilter
+	Facets      CatalogFacets
+	NextPageURL string
+	CSRFToken   string
+}
+
+// catalogPageSize es el número de libros por página del catálogo.
+const catalogPageSize = 24
+
+// LoginPageData se utiliza para pasar datos a la plantilla login.html
+type LoginPageData struct {
+	CSRFToken string
 }
 
 // AdminDashboardData se utiliza para pasar datos específicos a la plantilla admin_dashboard.html
@@ -30,28 +56,123 @@ type AdminDashboardData struct {
 	UserCount      int
 	BookCount      int
 	LoanCount      int
-	Users          []User // Usa la struct User de models.go
-	Books          []Book // Usa la struct Book de models.go
+	Users          []User      // Usa la struct User de models.go
+	Books          []Book      // Usa la struct Book de models.go
+	LoginLocks     []LoginLock // Bloqueos de login vigentes
 	SuccessMessage string
 	SearchQuery    string
 	ErrorMessage   string
+	CSRFToken      string
 }
 
 // FormPageData se utiliza para pasar datos específicos a los formularios de admin
 type FormPageData struct {
-	UserName   string
-	IsAdmin    bool
-	Book       Book // Usa la struct Book de models.go
-	User       User // Usa la struct User de models.go
+	UserName string
+	IsAdmin  bool
+	Book     Book // Usa la struct Book de models.go
+	User     User // Usa la struct User de models.go
+	// Authors, Genres y Series son todos los autores, géneros y series, para
+	// elegir los del libro
+	Authors    []Author
+	Genres     []Genre
+	Series     []Series
 	IsUpcoming bool
+	// ReleaseAtValue es la fecha de lanzamiento del libro en hora local, con el
+	// formato de un <input type="datetime-local">
+	ReleaseAtValue string
+	ErrorMessage   string
+	CSRFToken      string
+}
+
+// AdminCopiesPageData se utiliza para la plantilla admin_copies.html
+type AdminCopiesPageData struct {
+	UserName       string
+	IsAdmin        bool
+	Book           Book
+	Copies         []Copy
+	SuccessMessage string
+	ErrorMessage   string
+	CSRFToken      string
+}
+
+// AdminInventoryPageData se utiliza para la plantilla admin_inventory.html.
+// Books es una conciliación sin correcciones hecha al cargar la página y Runs
+// las últimas ejecuciones registradas.
+type AdminInventoryPageData struct {
+	UserName       string
+	IsAdmin        bool
+	Books          []BookInventory
+	IssuesFound    int
+	Runs           []ReconciliationRun
+	SuccessMessage string
+	ErrorMessage   string
+	CSRFToken      string
+}
+
+// AdminGenresPageData se utiliza para la plantilla admin_genres.html. Genres
+// tiene cada género principal seguido de sus subgéneros.
+type AdminGenresPageData struct {
+	UserName       string
+	IsAdmin        bool
+	Genres         []Genre
+	SuccessMessage string
+	ErrorMessage   string
+	CSRFToken      string
+}
+
+// AdminReviewsPageData se utiliza para la plantilla admin_reviews.html.
+// Reviews son las reseñas con el estado Status.
+type AdminReviewsPageData struct {
+	UserName       string
+	IsAdmin        bool
+	Reviews        []Review
+	Status         string
+	SuccessMessage string
+	ErrorMessage   string
+	CSRFToken      string
 }
 
 // BookDetailPageData se utiliza para pasar datos específicos a la plantilla book_detail.html
 type BookDetailPageData struct {
-	UserName    string
-	IsAdmin     bool
-	Book        Book // Usa la struct Book de models.go
-	UserHasLoan bool
+	UserName     string
+	IsAdmin      bool
+	Book         Book // Usa la struct Book de models.go
+	UserHasLoan  bool
+	UserHold     *Hold    // Reserva en cola o apartada del usuario, si tiene
+	WaitingCount int      // Reservas en cola para el libro
+	LoanLimit    int      // Máximo de préstamos activos del usuario (0 = sin límite)
+	LoansLeft    int      // Préstamos que aún puede pedir si hay límite
+	PrevVolume   *Book    // Volumen anterior de la serie, si hay
+	NextVolume   *Book    // Volumen siguiente de la serie, si hay
+	Reviews      []Review // Reseñas aprobadas, las más recientes primero
+	UserReview   *Review  // Reseña del usuario en cualquier estado, si tiene
+	CanReview    bool     // El usuario tiene el libro prestado o lo ha devuelto
+	// SuccessMessage y ErrorMessage son los mensajes flash de la última acción
+	SuccessMessage string
+	ErrorMessage   string
+	CSRFToken      string
+}
+
+// AuthorPageData se utiliza para la plantilla author.html. Books son las obras
+// ya publicadas y Upcoming las que aún no.
+type AuthorPageData struct {
+	UserName  string
+	IsAdmin   bool
+	Author    Author
+	Books     []Book
+	Upcoming  []Book
+	CSRFToken string
+}
+
+// MyHoldsPageData se utiliza para pasar datos a la plantilla my_holds.html
+type MyHoldsPageData struct {
+	UserName       string
+	IsAdmin        bool
+	Holds          []Hold
+	Preorders      []Preorder // Preventas pendientes de libros por publicar
+	SuccessMessage string
+	ErrorMessage   string
+	CSRFToken      string
 }
 
 // --- Handlers de Autenticacion y Rutas Publicas ---
@@ -68,14 +189,14 @@ func (app *App) homeRedirectHandler(w http.ResponseWriter, r *http.Request) {
 // loginHandler maneja el proceso de inicio de sesion de usuarios.
 func (app *App) loginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		fp := filepath.Join("templates", "login.html")
+		fp := filepath.Join(app.Config.Paths.Templates, "login.html")
 		tmpl, err := template.ParseFiles(fp)
 		if err != nil {
 			log.Printf("Error al parsear plantilla de login (GET): %v", err)
 			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
 			return
 		}
-		if err := tmpl.Execute(w, nil); err != nil {
+		if err := tmpl.Execute(w, LoginPageData{CSRFToken: app.csrfToken(r)}); err != nil {
 			log.Printf("Error al ejecutar plantilla de login (GET): %v", err)
 			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
 		}
@@ -85,20 +206,31 @@ func (app *App) loginHandler(w http.ResponseWriter, r *http.Request) {
 		r.ParseForm()
 		username := r.FormValue("username")
 		password := r.FormValue("password")
+		ip := clientIP(r)
+		now := time.Now()
 
-		if len(password) != 4 {
-			log.Printf("Intento de login fallido para %s: longitud de password incorrecta", username)
-			http.Redirect(w, r, "/login?error=true", http.StatusSeeOther)
+		// Rechazar el intento si el usuario o la IP están en espera o bloqueados
+		blockedUntil, err := app.loginBlockedUntil(r.Context(), username, ip, now)
+		if err != nil {
+			log.Printf("Error de DB al comprobar bloqueos de login para %s: %v", username, err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+		if !blockedUntil.IsZero() {
+			log.Printf("Intento de login rechazado para %s desde %s: bloqueado hasta %s", username, ip, blockedUntil.Format(time.RFC3339))
+			http.Redirect(w, r, "/login?error=locked", http.StatusSeeOther)
 			return
 		}
 
-		var userID int
-		var userRole, userName string
-		query := "SELECT id, name, role FROM users WHERE username = ?"
-		err := app.DB.QueryRow(query, username).Scan(&userID, &userName, &userRole)
+		user, err := app.Users.GetByUsername(r.Context(), username)
 		if err != nil {
-			if err == sql.ErrNoRows {
+			if errors.Is(err, ErrNotFound) {
+				// Se compara igualmente contra un hash ficticio para no revelar por tiempo de respuesta que el usuario no existe
+				checkPassword(string(dummyPasswordHash), password)
 				log.Printf("Intento de login fallido para %s: usuario no encontrado", username)
+				if err := app.recordLoginFailure(r.Context(), username, ip, now); err != nil {
+					log.Printf("Error al registrar intento fallido de login para %s: %v", username, err)
+				}
 				http.Redirect(w, r, "/login?error=true", http.StatusSeeOther)
 			} else {
 				log.Printf("Error de DB durante el login para %s: %v", username, err)
@@ -107,11 +239,31 @@ func (app *App) loginHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		app.SessionManager.RenewToken(r.Context())
-		app.SessionManager.Put(r.Context(), "authenticatedUserID", userID)
-		app.SessionManager.Put(r.Context(), "userName", userName)
-		app.SessionManager.Put(r.Context(), "userRole", userRole)
-		log.Printf("Inicio de sesión exitoso (modo simple) para %s (%s)", userName, userRole)
+		if !checkPassword(user.Password, password) {
+			log.Printf("Intento de login fallido para %s: contraseña incorrecta", username)
+			if err := app.recordLoginFailure(r.Context(), username, ip, now); err != nil {
+				log.Printf("Error al registrar intento fallido de login para %s: %v", username, err)
+			}
+			http.Redirect(w, r, "/login?error=true", http.StatusSeeOther)
+			return
+		}
+
+		if err := app.LoginFailures.Delete(r.Context(), throttleScopeUsername, strings.ToLower(username)); err != nil {
+			log.Printf("Error al limpiar intentos fallidos de login para %s: %v", username, err)
+		}
+
+		err = app.SessionManager.RenewToken(r.Context())
+		if err != nil {
+			log.Printf("Error al renovar el token de sesión para %s: %v", username, err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+		// El token CSRF anterior al login se descarta y se genera uno nuevo en la siguiente página
+		app.SessionManager.Remove(r.Context(), csrfSessionKey)
+		app.SessionManager.Put(r.Context(), "authenticatedUserID", user.ID)
+		app.SessionManager.Put(r.Context(), "userName", user.Name)
+		app.SessionManager.Put(r.Context(), "userRole", user.Role)
+		log.Printf("Inicio de sesión exitoso para %s (%s)", user.Name, user.Role)
 		http.Redirect(w, r, "/catalog", http.StatusSeeOther)
 	}
 }
@@ -151,39 +303,87 @@ func (app *App) requireAdmin(next http.Handler) http.Handler {
 
 // catalogHandler muestra el catálogo de libros disponibles.
 func (app *App) catalogHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := app.DB.Query("SELECT id, title, author, cover_image_path, DATE_FORMAT(release_date, '%Y') as release_year FROM books WHERE release_date <= NOW() ORDER BY title")
+	query := r.URL.Query()
+	filter := CatalogFilter{
+		Tag:       strings.Join(strings.Fields(query.Get("tag")), " "),
+		Available: query.Get("available") != "",
+		Sort:      query.Get("sort"),
+		Limit:     catalogPageSize,
+	}
+	// Los valores numéricos inválidos se ignoran
+	if genreID, err := strconv.Atoi(query.Get("genre_id")); err == nil && genreID > 0 {
+		filter.GenreID = genreID
+	}
+	if authorID, err := strconv.Atoi(query.Get("author_id")); err == nil && authorID > 0 {
+		filter.AuthorID = authorID
+	}
+	// Dentro de una serie se muestran todos sus volúmenes
+	if seriesID, err := strconv.Atoi(query.Get("series_id")); err == nil && seriesID > 0 {
+		filter.SeriesID = seriesID
+	} else {
+		filter.CollapseSeries = query.Get("collapse_series") != ""
+	}
+	if year, err := strconv.Atoi(query.Get("year_from")); err == nil && year > 0 {
+		filter.YearFrom = year
+	}
+	if year, err := strconv.Atoi(query.Get("year_to")); err == nil && year > 0 {
+		filter.YearTo = year
+	}
+	if after, err := strconv.Atoi(query.Get("after")); err == nil && after > 0 {
+		filter.After = after
+	}
+
+	// Con q, solo los libros que coinciden, por defecto ordenados por relevancia
+	searchQuery := strings.TrimSpace(query.Get("q"))
+	if searchQuery != "" {
+		results := app.Search.Search(searchQuery)
+		filter.BookIDs = make([]int, len(results))
+		for i, result := range results {
+			filter.BookIDs[i] = result.BookID
+		}
+	}
+	switch filter.Sort {
+	case catalogSortTitle, catalogSortAuthor, catalogSortNewest, catalogSortMostBorrowed:
+	default:
+		if searchQuery != "" {
+			filter.Sort = catalogSortRelevance
+		} else {
+			filter.Sort = catalogSortTitle
+		}
+	}
+
+	page, err := app.Books.Browse(r.Context(), time.Now(), filter)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Error de servidor al cargar el catálogo", 500)
 		return
 	}
-	defer rows.Close()
+	books := page.Books
+	for i := range books {
+		books[i].ReleaseDate = books[i].ReleaseAt.Format("2006")
+		books[i].IsAvailable = true
+	}
 
-	var books []Book
-	for rows.Next() {
-		var book Book
-		var releaseYear string
-		if err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.CoverImagePath, &releaseYear); err != nil {
-			log.Println(err)
-			http.Error(w, "Error de servidor al escanear libro del catálogo", 500)
-			return
-		}
-		book.ReleaseDate = releaseYear
-		book.IsAvailable = true
-		books = append(books, book)
+	var nextPageURL string
+	if page.NextAfter != 0 {
+		next := r.URL.Query()
+		next.Set("after", strconv.Itoa(page.NextAfter))
+		nextPageURL = "/catalog?" + next.Encode()
 	}
 
-	data := struct {
-		UserName string
-		IsAdmin  bool
-		Books    []Book
-	}{
-		UserName: app.SessionManager.GetString(r.Context(), "userName"),
-		IsAdmin:  app.SessionManager.GetString(r.Context(), "userRole") == "admin",
-		Books:    books,
+	data := CatalogPageData{
+		UserName:    app.SessionManager.GetString(r.Context(), "userName"),
+		IsAdmin:     app.SessionManager.GetString(r.Context(), "userRole") == "admin",
+		Books:       books,
+		Total:       page.Total,
+		SearchQuery: searchQuery,
+		Filter:      filter,
+		Facets:      page.Facets,
+		NextPageURL: nextPageURL,
+		CSRFToken:   app.csrfToken(r),
 	}
 
-	files := []string{"templates/catalog.html", "templates/partials/navbar.html"}
+	files := app.templateFiles("catalog.html", "partials/navbar.html")
 	ts, err := template.ParseFiles(files...)
 	if err != nil {
 		log.Println(err)
@@ -195,38 +395,49 @@ func (app *App) catalogHandler(w http.ResponseWriter, r *http.Request) {
 
 // upcomingReleasesHandler muestra los libros con lanzamientos futuros.
 func (app *App) upcomingReleasesHandler(w http.ResponseWriter, r *http.Request) {
-	rows, err := app.DB.Query("SELECT id, title, author, cover_image_path, DATE_FORMAT(release_date, 'Enero de %Y') as release_date FROM books WHERE release_date > NOW() ORDER BY release_date")
+	books, err := app.Books.ListUpcoming(r.Context(), time.Now())
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Error de servidor al cargar próximos lanzamientos", 500)
 		return
 	}
-	defer rows.Close()
+	for i := range books {
+		books[i].ReleaseDate = formatMonthYear(books[i].ReleaseAt)
+	}
 
-	var books []Book // Usa la struct Book de models.go
-	for rows.Next() {
-		var book Book
-		var releaseDateStr string
-		if err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.CoverImagePath, &releaseDateStr); err != nil {
+	// Libros que el usuario ya tiene en preventa
+	preordered := make(map[int]bool)
+	if userID := app.SessionManager.GetInt(r.Context(), "authenticatedUserID"); userID != 0 {
+		preorders, err := app.Preorders.ListByUser(r.Context(), userID)
+		if err != nil {
 			log.Println(err)
-			http.Error(w, "Error de servidor al escanear próximo lanzamiento", 500)
+			http.Error(w, "Error de servidor al cargar las preventas", 500)
 			return
 		}
-		book.ReleaseDate = releaseDateStr
-		books = append(books, book)
+		for _, p := range preorders {
+			preordered[p.BookID] = true
+		}
 	}
 
 	data := struct {
-		UserName string
-		IsAdmin  bool
-		Books    []Book
+		UserName       string
+		IsAdmin        bool
+		Books          []Book
+		Preordered     map[int]bool // ID de libro -> el usuario ya lo tiene en preventa
+		SuccessMessage string
+		ErrorMessage   string
+		CSRFToken      string
 	}{
-		UserName: app.SessionManager.GetString(r.Context(), "userName"),
-		IsAdmin:  app.SessionManager.GetString(r.Context(), "userRole") == "admin",
-		Books:    books,
+		UserName:       app.SessionManager.GetString(r.Context(), "userName"),
+		IsAdmin:        app.SessionManager.GetString(r.Context(), "userRole") == "admin",
+		Books:          books,
+		Preordered:     preordered,
+		SuccessMessage: app.SessionManager.PopString(r.Context(), "flashSuccess"),
+		ErrorMessage:   app.SessionManager.PopString(r.Context(), "flashError"),
+		CSRFToken:      app.csrfToken(r),
 	}
 
-	files := []string{"templates/upcoming.html", "templates/partials/navbar.html"}
+	files := app.templateFiles("upcoming.html", "partials/navbar.html")
 	ts, err := template.ParseFiles(files...)
 	if err != nil {
 		log.Println(err)
@@ -245,13 +456,9 @@ func (app *App) bookDetailHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userID := app.SessionManager.GetInt(r.Context(), "authenticatedUserID")
-	var book Book
-	var releaseDateTime time.Time
-
-	row := app.DB.QueryRow("SELECT id, title, author, genre, stock, description, cover_image_path, pdf_file_path, release_date FROM books WHERE id = ?", bookID)
-	err = row.Scan(&book.ID, &book.Title, &book.Author, &book.Genre, &book.Stock, &book.Description, &book.CoverImagePath, &book.PdfFilePath, &releaseDateTime)
+	book, err := app.Books.Get(r.Context(), bookID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, ErrNotFound) {
 			http.NotFound(w, r)
 			return
 		}
@@ -259,20 +466,80 @@ func (app *App) bookDetailHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error de servidor al cargar detalle del libro", 500)
 		return
 	}
-	book.ReleaseDate = releaseDateTime.Format("2006")
+	book.ReleaseDate = book.ReleaseAt.Format("2006")
 
-	var loanCount int
 	// Verifica si el usuario tiene un prestamo activo para este libro
-	app.DB.QueryRow("SELECT COUNT(*) FROM loans WHERE user_id = ? AND book_id = ? AND status = 'active'", userID, bookID).Scan(&loanCount)
-
-	data := BookDetailPageData{
-		UserName:    app.SessionManager.GetString(r.Context(), "userName"),
-		IsAdmin:     app.SessionManager.GetString(r.Context(), "userRole") == "admin",
-		Book:        book,
-		UserHasLoan: loanCount > 0,
+	hasLoan, err := app.Loans.HasActive(r.Context(), userID, bookID)
+	if err != nil {
+		log.Println(err)
+	}
+	var userHold *Hold
+	if hold, err := app.Holds.GetActive(r.Context(), userID, bookID); err == nil {
+		app.formatHold(&hold, time.Now())
+		userHold = &hold
+	} else if !errors.Is(err, ErrNotFound) {
+		log.Println(err)
+	}
+	waiting, err := app.Holds.CountWaiting(r.Context(), bookID)
+	if err != nil {
+		log.Println(err)
+	}
+	var loanLimit, loansLeft int
+	if user, err := app.Users.Get(r.Context(), userID); err == nil {
+		loanLimit = app.loanLimit(user)
+	} else {
+		log.Println(err)
+	}
+	if loanLimit > 0 {
+		active, err := app.Loans.CountActiveByUser(r.Context(), userID)
+		if err != nil {
+			log.Println(err)
+		}
+		loansLeft = max(loanLimit-active, 0)
+	}
+	prevVolume, nextVolume, err := app.Books.AdjacentVolumes(r.Context(), book)
+	if err != nil {
+		log.Println(err)
+	}
+	reviews, err := app.Reviews.ListApproved(r.Context(), bookID)
+	if err != nil {
+		log.Println(err)
+	}
+	for i := range reviews {
+		formatReview(&reviews[i])
+	}
+	var userReview *Review
+	if review, err := app.Reviews.GetByUser(r.Context(), userID, bookID); err == nil {
+		formatReview(&review)
+		userReview = &review
+	} else if !errors.Is(err, ErrNotFound) {
+		log.Println(err)
+	}
+	canReview, err := app.Reviews.CanReview(r.Context(), userID, bookID)
+	if err != nil {
+		log.Println(err)
 	}
 
-	files := []string{"templates/book_detail.html", "templates/partials/navbar.html"}
+	data := BookDetailPageData{
+		UserName:       app.SessionManager.GetString(r.Context(), "userName"),
+		IsAdmin:        app.SessionManager.GetString(r.Context(), "userRole") == "admin",
+		Book:           book,
+		UserHasLoan:    hasLoan,
+		UserHold:       userHold,
+		WaitingCount:   waiting,
+		LoanLimit:      loanLimit,
+		LoansLeft:      loansLeft,
+		PrevVolume:     prevVolume,
+		NextVolume:     nextVolume,
+		Reviews:        reviews,
+		UserReview:     userReview,
+		CanReview:      canReview,
+		SuccessMessage: app.SessionManager.PopString(r.Context(), "flashSuccess"),
+		ErrorMessage:   app.SessionManager.PopString(r.Context(), "flashError"),
+		CSRFToken:      app.csrfToken(r),
+	}
+
+	files := app.templateFiles("book_detail.html", "partials/navbar.html")
 	ts, err := template.ParseFiles(files...)
 	if err != nil {
 		log.Println(err)
@@ -300,66 +567,48 @@ func (app *App) createLoanHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tx, err := app.DB.Begin()
+	user, err := app.Users.Get(r.Context(), userID)
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "Error de servidor al iniciar transacción", http.StatusInternalServerError)
+		http.Error(w, "Error de servidor al registrar préstamo", http.StatusInternalServerError)
 		return
 	}
-	defer tx.Rollback() // Asegurarse de hacer rollback si algo falla
+	limit := app.loanLimit(user)
 
-	// --- LÓGICA: Verificar si ya existe un préstamo ACTIVO para este usuario y libro ---
-	var activeLoanCount int
-	err = tx.QueryRow("SELECT COUNT(*) FROM loans WHERE user_id = ? AND book_id = ? AND status = 'active'", userID, bookID).Scan(&activeLoanCount)
-	if err != nil {
-		log.Println(err)
-		app.SessionManager.Put(r.Context(), "flashError", "Error de servidor al verificar préstamos existentes.")
-		http.Error(w, "Error de servidor al verificar préstamos existentes", http.StatusInternalServerError)
-		return
-	}
-	if activeLoanCount > 0 {
+	now := time.Now()
+	err = app.Loans.Create(r.Context(), userID, bookID, now, app.loanDueDate(now), limit)
+	switch {
+	case errors.Is(err, ErrAlreadyLoaned):
 		// Ya existe un préstamo activo para este libro y usuario. Prevenir duplicados.
 		log.Printf("Intento de crear préstamo: Usuario %d ya tiene el libro %d activo.", userID, bookID)
 		app.SessionManager.Put(r.Context(), "flashError", "Ya tienes este libro prestado.") // Mensaje flash
 		http.Redirect(w, r, fmt.Sprintf("/book?id=%d", bookID), http.StatusSeeOther)
 		return
-	}
-
-	res, err := tx.Exec("UPDATE books SET stock = stock - 1 WHERE id = ? AND stock > 0", bookID)
-	if err != nil {
-		log.Println(err)
-		app.SessionManager.Put(r.Context(), "flashError", "Error al actualizar stock del libro.")
-		http.Error(w, "Error de servidor al actualizar stock del libro", http.StatusInternalServerError)
+	case errors.Is(err, ErrLoanLimit):
+		app.SessionManager.Put(r.Context(), "flashError", fmt.Sprintf("Ya tienes %d préstamos activos, el máximo permitido. Devuelve alguno para pedir otro.", limit))
+		http.Redirect(w, r, fmt.Sprintf("/book?id=%d", bookID), http.StatusSeeOther)
 		return
-	}
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		log.Println(err)
-		app.SessionManager.Put(r.Context(), "flashError", "Error al verificar stock afectado.")
-		http.Error(w, "Error al verificar filas afectadas", http.StatusInternalServerError)
+	case errors.Is(err, ErrNotFound):
+		http.NotFound(w, r)
 		return
-	}
-	if rowsAffected == 0 {
-		app.SessionManager.Put(r.Context(), "flashError", "No hay stock disponible para este libro.")
+	case errors.Is(err, ErrNotReleased):
+		app.SessionManager.Put(r.Context(), "flashError", "Este libro aún no se ha publicado. Puedes reservarlo en preventa.")
+		http.Redirect(w, r, fmt.Sprintf("/book?id=%d", bookID), http.StatusSeeOther)
+		return
+	case errors.Is(err, ErrPreordersPending):
+		app.SessionManager.Put(r.Context(), "flashError", "Este libro acaba de publicarse y se está entregando a quienes lo reservaron en preventa. Inténtalo de nuevo en unos minutos.")
+		http.Redirect(w, r, fmt.Sprintf("/book?id=%d", bookID), http.StatusSeeOther)
+		return
+	case errors.Is(err, ErrNoStock):
+		app.SessionManager.Put(r.Context(), "flashError", "No hay stock disponible para este libro. Puedes reservarlo y te avisaremos cuando haya una copia para ti.")
 		http.Redirect(w, r, fmt.Sprintf("/book?id=%d", bookID), http.StatusSeeOther) // Redirigir con error
 		return
-	}
-
-	_, err = tx.Exec("INSERT INTO loans (user_id, book_id, status, loan_date) VALUES (?, ?, 'active', NOW())", userID, bookID)
-	if err != nil {
+	case err != nil:
 		log.Println(err)
 		app.SessionManager.Put(r.Context(), "flashError", "Error al registrar el préstamo.")
 		http.Error(w, "Error de servidor al registrar préstamo", http.StatusInternalServerError)
 		return
 	}
-
-	err = tx.Commit()
-	if err != nil {
-		log.Println(err)
-		app.SessionManager.Put(r.Context(), "flashError", "Error al finalizar el préstamo.")
-		http.Error(w, "Error de servidor al finalizar transacción de préstamo", http.StatusInternalServerError)
-		return
-	}
 	app.SessionManager.Put(r.Context(), "flashSuccess", "¡Libro prestado con éxito!")
 	http.Redirect(w, r, fmt.Sprintf("/book?id=%d", bookID), http.StatusSeeOther)
 }
@@ -381,74 +630,67 @@ func (app *App) returnLoanHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tx, err := app.DB.Begin()
-	if err != nil {
-		log.Println(err)
-		http.Error(w, "Error de servidor al iniciar transacción", http.StatusInternalServerError)
+	err = app.Loans.Return(r.Context(), userID, bookID, time.Now())
+	if errors.Is(err, ErrNoActiveLoan) {
+		// Si no se encuentra un préstamo activo, redirigimos con un mensaje de error.
+		log.Printf("Intento de devolver libro (ID: %d) para usuario (ID: %d): No se encontró un préstamo activo para devolver.", bookID, userID)
+		app.SessionManager.Put(r.Context(), "flashError", "No se encontró un préstamo activo para este libro.")
+		http.Redirect(w, r, "/my-loans", http.StatusSeeOther)
 		return
 	}
-	defer tx.Rollback()
-
-	var loanID int
-	// Selecciona el préstamo más reciente activo para ese user_id y book_id
-	err = tx.QueryRow("SELECT id FROM loans WHERE user_id = ? AND book_id = ? AND status = 'active' ORDER BY loan_date DESC LIMIT 1", userID, bookID).Scan(&loanID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// Si no se encuentra un préstamo activo, redirigimos con un mensaje de error.
-			log.Printf("Intento de devolver libro (ID: %d) para usuario (ID: %d): No se encontró un préstamo activo para devolver.", bookID, userID)
-			app.SessionManager.Put(r.Context(), "flashError", "No se encontró un préstamo activo para este libro.")
-			http.Redirect(w, r, "/my-loans", http.StatusSeeOther)
-			return
-		}
 		log.Println(err)
-		app.SessionManager.Put(r.Context(), "flashError", "Error de servidor al buscar el préstamo.")
-		http.Error(w, "Error de servidor al buscar préstamo activo", http.StatusInternalServerError)
+		app.SessionManager.Put(r.Context(), "flashError", "Error al finalizar la devolución del libro.")
+		http.Error(w, "Error de servidor al devolver el libro", http.StatusInternalServerError)
 		return
 	}
 
-	res, err := tx.Exec("UPDATE loans SET status = 'returned', return_date = NOW() WHERE id = ?", loanID)
-	if err != nil {
+	app.SessionManager.Put(r.Context(), "flashSuccess", "¡Libro devuelto con éxito!")
+	http.Redirect(w, r, "/my-loans", http.StatusSeeOther)
+}
 
-		log.Println("Error ejecutando UPDATE loans:", err)
-		app.SessionManager.Put(r.Context(), "flashError", "Error al actualizar el estado del préstamo.")
-		http.Error(w, "Error de servidor al actualizar estado del préstamo", http.StatusInternalServerError)
+// renewLoanHandler amplía la fecha de vencimiento de un préstamo activo.
+func (app *App) renewLoanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		return
 	}
-	rowsAffected, err := res.RowsAffected()
+	r.ParseForm()
+	bookID, err := strconv.Atoi(r.FormValue("book_id"))
 	if err != nil {
-		log.Println("Error obteniendo RowsAffected de UPDATE loans:", err)
-		app.SessionManager.Put(r.Context(), "flashError", "Error al verificar filas afectadas por retorno.")
-		http.Error(w, "Error al verificar filas afectadas por retorno", http.StatusInternalServerError)
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
 		return
 	}
-
-	log.Printf("DEBUG: UPDATE loans afectó %d filas para loanID %d.", rowsAffected, loanID)
-
-	if rowsAffected > 0 {
-		_, err = tx.Exec("UPDATE books SET stock = stock + 1 WHERE id = ?", bookID)
-		if err != nil {
-			log.Println("Error ejecutando UPDATE books (incrementar stock):", err)
-			app.SessionManager.Put(r.Context(), "flashError", "Error al actualizar stock del libro.")
-			http.Error(w, "Error de servidor al actualizar stock del libro", http.StatusInternalServerError)
-			return
-		}
-	} else {
-
-		log.Printf("Advertencia: El préstamo (ID: %d) no fue afectado por la actualización de estado (rowsAffected fue 0).", loanID)
-		app.SessionManager.Put(r.Context(), "flashError", "El préstamo ya fue devuelto o no es válido.")
-		http.Redirect(w, r, "/my-loans", http.StatusSeeOther)
+	userID := app.SessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if userID == 0 { // Seguridad extra
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	err = tx.Commit()
-	if err != nil {
+	loans := app.Config.Loans
+	dueDate, err := app.Loans.Renew(r.Context(), userID, bookID, time.Now(), loans.Period.Duration, loans.MaxRenewals)
+	switch {
+	case errors.Is(err, ErrNoActiveLoan):
+		log.Printf("Intento de renovar libro (ID: %d) para usuario (ID: %d): No hay un préstamo vigente.", bookID, userID)
+		app.SessionManager.Put(r.Context(), "flashError", "No tienes un préstamo vigente de este libro para renovar.")
+		http.Redirect(w, r, "/my-loans", http.StatusSeeOther)
+		return
+	case errors.Is(err, ErrRenewalLimit):
+		app.SessionManager.Put(r.Context(), "flashError", fmt.Sprintf("Este préstamo ya se renovó el máximo de %d veces.", loans.MaxRenewals))
+		http.Redirect(w, r, "/my-loans", http.StatusSeeOther)
+		return
+	case errors.Is(err, ErrHoldsPending):
+		app.SessionManager.Put(r.Context(), "flashError", "No se puede renovar: hay otros usuarios esperando este libro.")
+		http.Redirect(w, r, "/my-loans", http.StatusSeeOther)
+		return
+	case err != nil:
 		log.Println(err)
-		app.SessionManager.Put(r.Context(), "flashError", "Error al finalizar transacción de retorno.")
-		http.Error(w, "Error de servidor al finalizar transacción de retorno", http.StatusInternalServerError)
+		app.SessionManager.Put(r.Context(), "flashError", "Error al renovar el préstamo.")
+		http.Error(w, "Error de servidor al renovar el préstamo", http.StatusInternalServerError)
 		return
 	}
 
-	app.SessionManager.Put(r.Context(), "flashSuccess", "¡Libro devuelto con éxito!")
+	app.SessionManager.Put(r.Context(), "flashSuccess", fmt.Sprintf("¡Préstamo renovado hasta el %s!", dueDate.Local().Format("02/01/2006 15:04")))
 	http.Redirect(w, r, "/my-loans", http.StatusSeeOther)
 }
 
@@ -459,66 +701,29 @@ func (app *App) myLoansHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `
-        SELECT
-            l.id,
-            b.id, b.title, b.author, b.cover_image_path, b.pdf_file_path, -- Campos del libro
-            l.loan_date,
-            l.return_date,
-            l.status
-        FROM
-            loans l
-        JOIN
-            books b ON l.book_id = b.id
-        WHERE
-            l.user_id = ?
-        ORDER BY
-            l.loan_date DESC
-    `
-	rows, err := app.DB.Query(query, userID)
+	userLoans, err := app.Loans.ListByUser(r.Context(), userID)
 	if err != nil {
 		log.Printf("Error al consultar préstamos del usuario %d: %v", userID, err)
 		http.Error(w, "Error de servidor al cargar mis préstamos", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var userLoans []Loan
-	for rows.Next() {
-		var loan Loan
-		var book Book
-		var loanDate time.Time
-		var returnDate sql.NullTime
-		var status string
-
-		err := rows.Scan(
-			&loan.ID,
-			&book.ID, &book.Title, &book.Author, &book.CoverImagePath, &book.PdfFilePath,
-			&loanDate,
-			&returnDate,
-			&status,
-		)
-		if err != nil {
-			log.Printf("Error al escanear fila de préstamo: %v", err)
-			http.Error(w, "Error de servidor al procesar préstamos", http.StatusInternalServerError)
-			return
-		}
-
-		loan.Book = book
-		loan.LoanDate = loanDate
-		loan.Status = status
 
+	now := time.Now()
+	for i := range userLoans {
+		loan := &userLoans[i]
 		// Formatea las fechas para la presentación en la plantilla
-		loan.LoanDateFormatted = loanDate.Format("02/01/2006") // Formato DD/MM/YYYY
-		if returnDate.Valid {
-			loan.ReturnDate = returnDate // Asigna el sql.NullTime original
-			loan.ReturnDateFormatted = returnDate.Time.Format("02/01/2006")
+		loan.LoanDateFormatted = loan.LoanDate.Format("02/01/2006") // Formato DD/MM/YYYY
+		loan.DueDateFormatted = loan.DueDate.Local().Format("02/01/2006 15:04")
+		if loan.Status == "active" {
+			loan.TimeRemaining = formatTimeRemaining(loan.DueDate, now)
+			loan.CanRenew = loan.RenewalCount < app.Config.Loans.MaxRenewals && loan.DueDate.After(now)
+		}
+		if loan.ReturnDate.Valid {
+			loan.ReturnDateFormatted = loan.ReturnDate.Time.Format("02/01/2006")
 		} else {
 			// Si ReturnDate no es válida (es NULL en DB), se indica como "Pendiente"
 			loan.ReturnDateFormatted = "Pendiente"
 		}
-
-		userLoans = append(userLoans, loan)
 	}
 
 	successMsg := app.SessionManager.PopString(r.Context(), "flashSuccess")
@@ -531,10 +736,11 @@ func (app *App) myLoansHandler(w http.ResponseWriter, r *http.Request) {
 		Loans:          userLoans,
 		SuccessMessage: successMsg,
 		ErrorMessage:   errorMsg,
+		CSRFToken:      app.csrfToken(r),
 	}
 
 	// Renderiza la plantilla "my_loans.html"
-	files := []string{"templates/my_loans.html", "templates/partials/navbar.html"}
+	files := app.templateFiles("my_loans.html", "partials/navbar.html")
 	ts, err := template.ParseFiles(files...)
 	if err != nil {
 		log.Printf("Error al parsear plantillas para my_loans: %v", err)
@@ -554,63 +760,47 @@ func (app *App) adminDashboardHandler(w http.ResponseWriter, r *http.Request) {
 	searchQuery := r.URL.Query().Get("q")
 	data := AdminDashboardData{
 		UserName: app.SessionManager.GetString(r.Context(), "userName"), IsAdmin: true, SuccessMessage: r.URL.Query().Get("success"), SearchQuery: searchQuery, ErrorMessage: r.URL.Query().Get("error"),
+		CSRFToken: app.csrfToken(r),
 	}
 
 	// Obtener conteos para el dashboard
-	app.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&data.UserCount)
-	app.DB.QueryRow("SELECT COUNT(*) FROM books").Scan(&data.BookCount)
-	app.DB.QueryRow("SELECT COUNT(*) FROM loans").Scan(&data.LoanCount)
-
-	// Obtener libros
-	var books []Book // Usa la struct Book de models.go
-	var bookRows *sql.Rows
 	var err error
-	baseBookQuery := "SELECT id, title, author, cover_image_path FROM books"
-	args := []interface{}{}
-	if searchQuery != "" {
-		baseBookQuery += " WHERE title LIKE ?"
-		args = append(args, "%"+searchQuery+"%")
+	if data.UserCount, err = app.Users.Count(r.Context()); err != nil {
+		log.Println(err)
 	}
-	baseBookQuery += " ORDER BY id DESC"
-	bookRows, err = app.DB.Query(baseBookQuery, args...)
+	if data.BookCount, err = app.Books.Count(r.Context()); err != nil {
+		log.Println(err)
+	}
+	if data.LoanCount, err = app.Loans.Count(r.Context()); err != nil {
+		log.Println(err)
+	}
+
+	// Obtener libros
+	data.Books, err = app.Books.List(r.Context(), searchQuery)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Error de servidor al cargar libros en admin dashboard", 500)
 		return
 	}
-	defer bookRows.Close()
-	for bookRows.Next() {
-		var book Book
-		if err := bookRows.Scan(&book.ID, &book.Title, &book.Author, &book.CoverImagePath); err != nil {
-			log.Println(err)
-			http.Error(w, "Error de servidor al escanear libro en admin dashboard", 500)
-			return
-		}
-		books = append(books, book)
-	}
-	data.Books = books
 
 	// Obtener usuarios
-	userRows, err := app.DB.Query("SELECT id, username, name, email, role FROM users ORDER BY id DESC")
+	data.Users, err = app.Users.List(r.Context())
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Error de servidor al cargar usuarios en admin dashboard", 500)
 		return
 	}
-	defer userRows.Close()
-	var users []User
-	for userRows.Next() {
-		var user User
-		if err := userRows.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role); err != nil {
-			log.Println(err)
-			http.Error(w, "Error de servidor al escanear usuario en admin dashboard", 500)
-			return
-		}
-		users = append(users, user)
+
+	// Obtener bloqueos de login vigentes
+	locks, err := app.LoginFailures.ListLocked(r.Context(), time.Now())
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar bloqueos de login en admin dashboard", 500)
+		return
 	}
-	data.Users = users
+	data.LoginLocks = locks
 
-	files := []string{"templates/admin_dashboard.html", "templates/partials/navbar.html"}
+	files := app.templateFiles("admin_dashboard.html", "partials/navbar.html")
 	ts, err := template.ParseFiles(files...)
 	if err != nil {
 		log.Println(err)
@@ -625,19 +815,49 @@ func (app *App) adminBookFormHandler(w http.ResponseWriter, r *http.Request) {
 	bookID := r.URL.Query().Get("id")
 	pageData := FormPageData{
 		UserName: app.SessionManager.GetString(r.Context(), "userName"), IsAdmin: true,
+		ErrorMessage: r.URL.Query().Get("error"),
+		CSRFToken:    app.csrfToken(r),
+	}
+	authors, err := app.Authors.List(r.Context())
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar los autores", 500)
+		return
+	}
+	pageData.Authors = authors
+	if pageData.Genres, err = app.Genres.List(r.Context()); err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar los géneros", 500)
+		return
+	}
+	if pageData.Series, err = app.Series.List(r.Context()); err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar las series", 500)
+		return
 	}
 	if bookID != "" {
-		id, _ := strconv.Atoi(bookID)
-		row := app.DB.QueryRow("SELECT id, title, author, description, release_date FROM books WHERE id = ?", id)
-		var releaseDateTime time.Time
-		err := row.Scan(&pageData.Book.ID, &pageData.Book.Title, &pageData.Book.Author, &pageData.Book.Description, &releaseDateTime)
+		id, err := strconv.Atoi(bookID)
 		if err != nil {
 			http.Error(w, "Libro no encontrado", http.StatusNotFound)
 			return
 		}
-		pageData.IsUpcoming = releaseDateTime.After(time.Now())
+		book, err := app.Books.Get(r.Context(), id)
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Libro no encontrado", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Error de servidor al cargar el libro", 500)
+			return
+		}
+		pageData.Book = book
+		pageData.IsUpcoming = book.ReleaseAt.After(time.Now())
+		pageData.ReleaseAtValue = book.ReleaseAt.Local().Format(dateTimeInputLayout)
+	} else {
+		pageData.ReleaseAtValue = time.Now().Format(dateTimeInputLayout)
 	}
-	files := []string{"templates/admin_book_form.html", "templates/partials/navbar.html"}
+	files := app.templateFiles("admin_book_form.html", "partials/navbar.html")
 	ts, err := template.ParseFiles(files...)
 	if err != nil {
 		log.Println(err)
@@ -648,74 +868,123 @@ func (app *App) adminBookFormHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *App) adminBookSaveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
 	r.ParseMultipartForm(32 << 20)
 	bookID := r.FormValue("book_id")
-	title := r.FormValue("title")
-	author := r.FormValue("author")
-	description := r.FormValue("description")
-	isUpcoming := r.FormValue("is_upcoming")
-	var releaseDate time.Time
-	if isUpcoming == "on" {
-		releaseDate = time.Now().AddDate(0, 1, 0) // Ejemplo: un mes a partir de ahora
-	} else {
-		releaseDate = time.Now()
+	formURL := func(code string) string {
+		if bookID != "" && bookID != "0" {
+			return "/admin/books/new?id=" + url.QueryEscape(bookID) + "&error=" + code
+		}
+		return "/admin/books/new?error=" + code
+	}
+	book, err := parseBookForm(r)
+	if err != nil {
+		var formErr bookFormError
+		if !errors.As(err, &formErr) {
+			formErr = bookFormError{code: "datos_invalidos", err: err}
+		}
+		log.Printf("Formulario de libro rechazado: %v", formErr)
+		http.Redirect(w, r, formURL(formErr.code), http.StatusSeeOther)
+		return
+	}
+	// Los autores escritos a mano se crean si aún no existen
+	for i, a := range book.Authors {
+		if a.ID != 0 {
+			continue
+		}
+		if book.Authors[i], err = app.Authors.FindOrCreate(r.Context(), a.Name); err != nil {
+			log.Printf("Error al crear el autor %q: %v", a.Name, err)
+			http.Error(w, "Error de servidor al guardar libro", 500)
+			return
+		}
+	}
+	// Igual con la serie, que se escribe por su nombre
+	if book.SeriesName != "" {
+		series, err := app.Series.FindOrCreate(r.Context(), book.SeriesName)
+		if err != nil {
+			log.Printf("Error al crear la serie %q: %v", book.SeriesName, err)
+			http.Error(w, "Error de servidor al guardar libro", 500)
+			return
+		}
+		book.SeriesID = series.ID
 	}
 
-	coverPath, err := app.uploadFile(r, "cover_image", "./static/book_covers/")
+	coverPath, err := app.uploadFile(r, "cover_image", app.Config.Paths.Covers)
 	if err != nil {
 		log.Printf("Error al subir imagen de portada: %v", err)
 		http.Error(w, "Error al subir imagen de portada", http.StatusInternalServerError)
 		return
 	}
-	pdfPath, err := app.uploadFile(r, "pdf_file", "./static/book_pdfs/")
+	pdfPath, err := app.uploadFile(r, "pdf_file", app.Config.Paths.PDFs)
 	if err != nil {
 		log.Printf("Error al subir archivo PDF: %v", err)
 		http.Error(w, "Error al subir archivo PDF", http.StatusInternalServerError)
 		return
 	}
 
+	book.CoverImagePath = coverPath
+	book.PdfFilePath = pdfPath
 	if bookID == "" || bookID == "0" {
-		_, err := app.DB.Exec("INSERT INTO books (title, author, description, release_date, cover_image_path, pdf_file_path) VALUES (?, ?, ?, ?, ?, ?)", title, author, description, releaseDate, coverPath, pdfPath)
+		err := app.Books.Create(r.Context(), &book)
+		if errors.Is(err, ErrUnknownAuthor) {
+			http.Redirect(w, r, formURL("autor_invalido"), http.StatusSeeOther)
+			return
+		}
+		if errors.Is(err, ErrVolumeTaken) {
+			http.Redirect(w, r, formURL("volumen_duplicado"), http.StatusSeeOther)
+			return
+		}
+		if errors.Is(err, ErrUnknownGenre) {
+			http.Redirect(w, r, formURL("genero_invalido"), http.StatusSeeOther)
+			return
+		}
 		if err != nil {
 			log.Printf("Error al insertar libro: %v", err)
 			http.Error(w, "Error de servidor al guardar libro", 500)
 			return
 		}
+		// El stock inicial se crea como copias propias, sin licencia
+		if book.Stock > 0 {
+			now := time.Now()
+			if err := app.Copies.Add(r.Context(), Copy{BookID: book.ID, AcquiredAt: now}, book.Stock, now); err != nil {
+				log.Printf("Error al crear las copias del libro %d: %v", book.ID, err)
+				http.Error(w, "Error de servidor al guardar libro", 500)
+				return
+			}
+		}
 	} else { // Actualización de libro existente
-		tx, err := app.DB.Begin()
+		book.ID, err = strconv.Atoi(bookID)
 		if err != nil {
-			log.Printf("Error al iniciar transacción para actualizar libro: %v", err)
-			http.Error(w, "Error de servidor", http.StatusInternalServerError)
+			http.Error(w, "ID de libro inválido", http.StatusBadRequest)
 			return
 		}
-		defer tx.Rollback()
-
-		// Actualizar rutas de archivos solo si se cargaron nuevos
-		if coverPath != "" {
-			_, err = tx.Exec("UPDATE books SET cover_image_path = ? WHERE id = ?", coverPath, bookID)
-			if err != nil {
-				log.Printf("Error al actualizar cover_image_path: %v", err)
-				http.Error(w, "Error de servidor", http.StatusInternalServerError)
-				return
-			}
+		err := app.Books.Update(r.Context(), book)
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "Libro no encontrado", http.StatusNotFound)
+			return
 		}
-		if pdfPath != "" {
-			_, err = tx.Exec("UPDATE books SET pdf_file_path = ? WHERE id = ?", pdfPath, bookID)
-			if err != nil {
-				log.Printf("Error al actualizar pdf_file_path: %v", err)
-				http.Error(w, "Error de servidor", http.StatusInternalServerError)
-				return
-			}
+		if errors.Is(err, ErrUnknownAuthor) {
+			http.Redirect(w, r, formURL("autor_invalido"), http.StatusSeeOther)
+			return
+		}
+		if errors.Is(err, ErrVolumeTaken) {
+			http.Redirect(w, r, formURL("volumen_duplicado"), http.StatusSeeOther)
+			return
+		}
+		if errors.Is(err, ErrUnknownGenre) {
+			http.Redirect(w, r, formURL("genero_invalido"), http.StatusSeeOther)
+			return
 		}
-		// Actualizar campos de texto
-		_, err = tx.Exec("UPDATE books SET title = ?, author = ?, description = ?, release_date = ? WHERE id = ?", title, author, description, releaseDate, bookID)
 		if err != nil {
-			log.Printf("Error al actualizar campos de texto del libro: %v", err)
+			log.Printf("Error al actualizar libro: %v", err)
 			http.Error(w, "Error de servidor", http.StatusInternalServerError)
 			return
 		}
-		tx.Commit()
 	}
+	app.refreshSearchIndex(r.Context())
 	http.Redirect(w, r, "/admin/dashboard?success=book_saved", http.StatusSeeOther)
 }
 
@@ -725,30 +994,31 @@ func (app *App) adminBookDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
 		return
 	}
-	bookID := r.URL.Query().Get("id")
-	if bookID == "" {
+	bookID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
 		http.Error(w, "ID de libro no proporcionado", http.StatusBadRequest)
 		return
 	}
-	var coverPath, pdfPath string
 	// Obtener rutas de archivos antes de eliminar el registro de la DB
-	err := app.DB.QueryRow("SELECT cover_image_path, pdf_file_path FROM books WHERE id = ?", bookID).Scan(&coverPath, &pdfPath)
-	if err != nil && err != sql.ErrNoRows {
+	book, err := app.Books.Get(r.Context(), bookID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
 		log.Printf("Error al obtener rutas de archivos para eliminar libro: %v", err)
 		http.Error(w, "Error de servidor", http.StatusInternalServerError)
 		return
 	}
+	coverPath, pdfPath := book.CoverImagePath, book.PdfFilePath
 
-	_, err = app.DB.Exec("DELETE FROM books WHERE id = ?", bookID)
+	err = app.Books.Delete(r.Context(), bookID)
 	if err != nil {
 		log.Printf("Error al eliminar libro de la base de datos: %v", err)
 		http.Error(w, "Error al eliminar libro", http.StatusInternalServerError)
 		return
 	}
+	app.refreshSearchIndex(r.Context())
 
 	// Eliminar archivos físicos (si existen)
 	if coverPath != "" {
-		fullPath := filepath.Join("./static/book_covers/", coverPath)
+		fullPath := filepath.Join(app.Config.Paths.Covers, coverPath)
 		if _, err := os.Stat(fullPath); err == nil { //
 			if err := os.Remove(fullPath); err != nil {
 				log.Printf("Advertencia: No se pudo eliminar archivo de portada %s: %v", fullPath, err)
@@ -756,7 +1026,7 @@ func (app *App) adminBookDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if pdfPath != "" {
-		fullPath := filepath.Join("./static/book_pdfs/", pdfPath)
+		fullPath := filepath.Join(app.Config.Paths.PDFs, pdfPath)
 		if _, err := os.Stat(fullPath); err == nil { //
 			if err := os.Remove(fullPath); err != nil {
 				log.Printf("Advertencia: No se pudo eliminar archivo PDF %s: %v", fullPath, err)
@@ -771,17 +1041,19 @@ func (app *App) adminUserFormHandler(w http.ResponseWriter, r *http.Request) {
 	userIDStr := r.URL.Query().Get("id")
 	pageData := FormPageData{
 		UserName: app.SessionManager.GetString(r.Context(), "userName"), IsAdmin: true,
+		ErrorMessage: r.URL.Query().Get("error"),
+		CSRFToken:    app.csrfToken(r),
 	}
 	if userIDStr != "" {
 		id, _ := strconv.Atoi(userIDStr)
-		row := app.DB.QueryRow("SELECT id, username, name, email, role FROM users WHERE id = ?", id)
-		err := row.Scan(&pageData.User.ID, &pageData.User.Username, &pageData.User.Name, &pageData.User.Email, &pageData.User.Role)
+		user, err := app.Users.Get(r.Context(), id)
 		if err != nil {
 			http.Error(w, "Usuario no encontrado", http.StatusNotFound)
 			return
 		}
+		pageData.User = user
 	}
-	files := []string{"templates/admin_user_form.html", "templates/partials/navbar.html"}
+	files := app.templateFiles("admin_user_form.html", "partials/navbar.html")
 	ts, err := template.ParseFiles(files...)
 	if err != nil {
 		log.Println(err.Error())
@@ -811,45 +1083,72 @@ func (app *App) adminUserSaveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Límite propio de préstamos activos; vacío usa el del rol
+	var maxActiveLoans sql.NullInt64
+	if v := strings.TrimSpace(r.FormValue("max_active_loans")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			formURL := "/admin/users/new?error=limite_invalido"
+			if userID != "" && userID != "0" {
+				formURL = "/admin/users/edit?id=" + url.QueryEscape(userID) + "&error=limite_invalido"
+			}
+			http.Redirect(w, r, formURL, http.StatusSeeOther)
+			return
+		}
+		maxActiveLoans = sql.NullInt64{Int64: int64(n), Valid: true}
+	}
+
+	// La misma política de contraseñas se aplica al crear y al cambiar contraseñas
+	if password != "" {
+		if err := app.Config.Password.Validate(password); err != nil {
+			log.Printf("Contraseña rechazada para %s: %v", username, err)
+			formURL := "/admin/users/new?error=password_debil"
+			if userID != "" && userID != "0" {
+				formURL = "/admin/users/edit?id=" + url.QueryEscape(userID) + "&error=password_debil"
+			}
+			http.Redirect(w, r, formURL, http.StatusSeeOther)
+			return
+		}
+	}
+
+	user := User{Username: username, Name: name, Email: email, Role: role, MaxActiveLoans: maxActiveLoans}
 	if userID == "" || userID == "0" {
 		if password == "" {
 			http.Redirect(w, r, "/admin/users/new?error=password_requerida", http.StatusSeeOther)
 			return
 		}
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		hashedPassword, err := hashPassword(password)
 		if err != nil {
 			log.Printf("Error al hashear contraseña: %v", err)
 			http.Error(w, "Error interno al procesar contraseña", http.StatusInternalServerError)
 			return
 		}
-		_, err = app.DB.Exec("INSERT INTO users (username, name, email, password, role) VALUES (?, ?, ?, ?, ?)", username, name, email, string(hashedPassword), role)
-		if err != nil {
+		user.Password = hashedPassword
+		if err := app.Users.Create(r.Context(), &user); err != nil {
 			log.Printf("Error al insertar usuario: %v", err)
 			http.Error(w, "Error al crear usuario", http.StatusInternalServerError)
 			return
 		}
 	} else { // Es una actualización de usuario
+		id, err := strconv.Atoi(userID)
+		if err != nil {
+			http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+			return
+		}
+		user.ID = id
 		// Si se proporcionó una nueva contraseña, hashearla y actualizarla
 		if password != "" {
-			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			user.Password, err = hashPassword(password)
 			if err != nil {
 				log.Printf("Error al hashear nueva contraseña: %v", err)
 				http.Error(w, "Error interno al procesar nueva contraseña", http.StatusInternalServerError)
 				return
 			}
-			_, err = app.DB.Exec("UPDATE users SET username=?, name=?, email=?, password=?, role=? WHERE id=?", username, name, email, string(hashedPassword), role, userID)
-			if err != nil {
-				log.Printf("Error al actualizar usuario con contraseña: %v", err)
-				http.Error(w, "Error al actualizar usuario", http.StatusInternalServerError)
-				return
-			}
-		} else { // Si no se proporcionó contraseña, actualizar solo los otros campos
-			_, err := app.DB.Exec("UPDATE users SET username=?, name=?, email=?, role=? WHERE id=?", username, name, email, role, userID)
-			if err != nil {
-				log.Printf("Error al actualizar usuario sin contraseña: %v", err)
-				http.Error(w, "Error al actualizar usuario", http.StatusInternalServerError)
-				return
-			}
+		}
+		if err := app.Users.Update(r.Context(), user); err != nil {
+			log.Printf("Error al actualizar usuario: %v", err)
+			http.Error(w, "Error al actualizar usuario", http.StatusInternalServerError)
+			return
 		}
 	}
 	http.Redirect(w, r, "/admin/dashboard?success=user_saved", http.StatusSeeOther)
@@ -874,7 +1173,7 @@ func (app *App) adminUserDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/admin/dashboard?error=self_delete", http.StatusSeeOther)
 		return
 	}
-	_, err = app.DB.Exec("DELETE FROM users WHERE id = ?", userIDToDelete)
+	err = app.Users.Delete(r.Context(), userIDToDelete)
 	if err != nil {
 		log.Printf("Error al eliminar usuario: %v", err)
 		http.Error(w, "Error al eliminar usuario", http.StatusInternalServerError)
@@ -883,6 +1182,178 @@ func (app *App) adminUserDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin/dashboard?success=user_deleted", http.StatusSeeOther)
 }
 
+// adminLoginLockClearHandler elimina un bloqueo de login (por usuario o por IP).
+func (app *App) adminLoginLockClearHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	scope := r.FormValue("scope")
+	identifier := r.FormValue("identifier")
+	if (scope != throttleScopeUsername && scope != throttleScopeIP) || identifier == "" {
+		http.Error(w, "Bloqueo inválido", http.StatusBadRequest)
+		return
+	}
+	if err := app.LoginFailures.Delete(r.Context(), scope, identifier); err != nil {
+		log.Printf("Error al eliminar bloqueo de login %s %q: %v", scope, identifier, err)
+		http.Error(w, "Error al eliminar bloqueo", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Bloqueo de login %s %q eliminado por %s", scope, identifier, app.SessionManager.GetString(r.Context(), "userName"))
+	http.Redirect(w, r, "/admin/dashboard?success=lock_cleared", http.StatusSeeOther)
+}
+
+// formatMonthYear da formato "Marzo de 2026" a una fecha de lanzamiento.
+func formatMonthYear(t time.Time) string {
+	months := [...]string{"Enero", "Febrero", "Marzo", "Abril", "Mayo", "Junio", "Julio", "Agosto", "Septiembre", "Octubre", "Noviembre", "Diciembre"}
+	return fmt.Sprintf("%s de %d", months[t.Month()-1], t.Year())
+}
+
+// bookFormError es un error de validación del formulario de libros. code se
+// pasa al formulario en ?error= para que muestre el mensaje correspondiente.
+type bookFormError struct {
+	code string
+	err  error
+}
+
+func (e bookFormError) Error() string { return e.code + ": " + e.err.Error() }
+
+// parseBookForm lee y valida los campos del formulario de libros. Los campos
+// de texto se recortan; ISBN, editorial, idioma, páginas y edición son opcionales.
+func parseBookForm(r *http.Request) (Book, error) {
+	field := func(name string) string { return strings.TrimSpace(r.FormValue(name)) }
+	book := Book{
+		Title:       field("title"),
+		Publisher:   field("publisher"),
+		Language:    field("language"),
+		Edition:     field("edition"),
+		Description: field("description"),
+	}
+	// Autores elegidos de la lista (author_ids, en orden) y autores nuevos
+	// escritos a mano (new_author, que el handler crea si no existen)
+	for _, v := range r.Form["author_ids"] {
+		id, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || id < 1 {
+			return book, bookFormError{"autor_invalido", fmt.Errorf("ID de autor %q", v)}
+		}
+		book.Authors = append(book.Authors, Author{ID: id})
+	}
+	for _, v := range r.Form["new_author"] {
+		if name := strings.Join(strings.Fields(v), " "); name != "" {
+			if utf8.RuneCountInString(name) > 255 {
+				return book, bookFormError{"texto_demasiado_largo", fmt.Errorf("autor %q supera 255 caracteres", name)}
+			}
+			book.Authors = append(book.Authors, Author{Name: name})
+		}
+	}
+	if book.Title == "" || len(book.Authors) == 0 {
+		return book, bookFormError{"campos_requeridos", errors.New("título y autor son obligatorios")}
+	}
+
+	// Géneros elegidos de la lista (genre_ids, en orden) y etiquetas libres
+	// separadas por comas
+	for _, v := range r.Form["genre_ids"] {
+		id, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || id < 1 {
+			return book, bookFormError{"genero_invalido", fmt.Errorf("ID de género %q", v)}
+		}
+		book.Genres = append(book.Genres, Genre{ID: id})
+	}
+	seenTags := make(map[string]bool)
+	for _, v := range strings.Split(r.FormValue("tags"), ",") {
+		tag := strings.Join(strings.Fields(v), " ")
+		if tag == "" || seenTags[strings.ToLower(tag)] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > 50 {
+			return book, bookFormError{"texto_demasiado_largo", fmt.Errorf("etiqueta %q supera 50 caracteres", tag)}
+		}
+		seenTags[strings.ToLower(tag)] = true
+		book.Tags = append(book.Tags, tag)
+	}
+
+	// Serie opcional, por nombre; si se indica, el volumen es obligatorio
+	if book.SeriesName = strings.Join(strings.Fields(r.FormValue("series_name")), " "); book.SeriesName != "" {
+		volume, err := strconv.Atoi(field("series_volume"))
+		if err != nil || volume < 1 {
+			return book, bookFormError{"volumen_invalido", fmt.Errorf("volumen %q", field("series_volume"))}
+		}
+		book.SeriesVolume = volume
+	}
+	// Límites de longitud de las columnas
+	for _, f := range []struct {
+		value string
+		max   int
+	}{{book.Title, 255}, {book.SeriesName, 255}, {book.Publisher, 255}, {book.Language, 50}, {book.Edition, 100}} {
+		if utf8.RuneCountInString(f.value) > f.max {
+			return book, bookFormError{"texto_demasiado_largo", fmt.Errorf("%q supera %d caracteres", f.value, f.max)}
+		}
+	}
+
+	// stock solo se usa al crear el libro: son sus copias iniciales
+	if v := field("stock"); v != "" {
+		stock, err := strconv.Atoi(v)
+		if err != nil || stock < 0 || stock > maxCopiesPerAdd {
+			return book, bookFormError{"stock_invalido", fmt.Errorf("stock %q", v)}
+		}
+		book.Stock = stock
+	}
+
+	if v := field("isbn"); v != "" {
+		isbn, err := normalizeISBN(v)
+		if err != nil {
+			return book, bookFormError{"isbn_invalido", err}
+		}
+		book.ISBN = isbn
+	}
+
+	if v := field("page_count"); v != "" {
+		pages, err := strconv.Atoi(v)
+		if err != nil || pages < 1 {
+			return book, bookFormError{"paginas_invalidas", fmt.Errorf("número de páginas %q", v)}
+		}
+		book.PageCount = pages
+	}
+
+	// El libro pasa del catálogo a próximos lanzamientos (o al revés) en el
+	// instante exacto de release_at
+	var err error
+	book.ReleaseAt, err = parseDateTimeInput(r.FormValue("release_at"))
+	if err != nil {
+		return book, bookFormError{"fecha_invalida", err}
+	}
+	return book, nil
+}
+
+// dateTimeInputLayout es el formato de los campos <input type="datetime-local">.
+const dateTimeInputLayout = "2006-01-02T15:04"
+
+// parseDateTimeInput interpreta una fecha de un <input type="datetime-local">,
+// enviada sin zona horaria, en la hora local del servidor.
+func parseDateTimeInput(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, errors.New("fecha requerida")
+	}
+	// Algunos navegadores incluyen los segundos
+	for _, layout := range []string{dateTimeInputLayout, dateTimeInputLayout + ":05"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("fecha inválida: %q", value)
+}
+
+// templateFiles devuelve las rutas de las plantillas dentro del directorio configurado.
+func (app *App) templateFiles(names ...string) []string {
+	files := make([]string, len(names))
+	for i, name := range names {
+		files[i] = filepath.Join(app.Config.Paths.Templates, name)
+	}
+	return files
+}
+
 // uploadFile es una función auxiliar para manejar la subida de archivos (portadas, PDFs).
 func (app *App) uploadFile(r *http.Request, inputName, destPath string) (string, error) {
 	file, handler, err := r.FormFile(inputName)
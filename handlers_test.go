@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// newTestApp devuelve una App con la configuración por defecto y los stores de
+// libros, usuarios y préstamos en memoria.
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	data := newMemData()
+	return &App{
+		Config:         defaultConfig(),
+		SessionManager: scs.New(),
+		Books:          memBookStore{data},
+		Users:          memUserStore{data},
+		Loans:          memLoanStore{data},
+		Search:         newSearchIndex(),
+	}
+}
+
+func addTestUser(t *testing.T, app *App, user User) User {
+	t.Helper()
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	if err := app.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// addTestBook crea un libro publicado hace un día si no se indica ReleaseAt.
+func addTestBook(t *testing.T, app *App, book Book) Book {
+	t.Helper()
+	if book.ReleaseAt.IsZero() {
+		book.ReleaseAt = time.Now().Add(-24 * time.Hour)
+	}
+	if err := app.Books.Create(context.Background(), &book); err != nil {
+		t.Fatal(err)
+	}
+	return book
+}
+
+// testSession es la sesión con la que se hace una petición de prueba. Un
+// UserID 0 es una petición sin iniciar sesión.
+type testSession struct {
+	UserID int
+	Role   string
+}
+
+// serveTest ejecuta h con la sesión indicada y devuelve la respuesta y el
+// contexto de la sesión, del que se leen los mensajes flash.
+func serveTest(t *testing.T, app *App, h http.Handler, method, target string, form url.Values, session testSession) (*httptest.ResponseRecorder, context.Context) {
+	t.Helper()
+	var body string
+	if form != nil {
+		body = form.Encode()
+	}
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if form != nil {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return serveTestRequest(t, app, h, r, session)
+}
+
+// serveMultipartTest es serveTest con el formulario en multipart/form-data,
+// como lo envían los formularios con ficheros.
+func serveMultipartTest(t *testing.T, app *App, h http.Handler, target string, form url.Values, session testSession) (*httptest.ResponseRecorder, context.Context) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, values := range form {
+		for _, v := range values {
+			if err := mw.WriteField(name, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, target, &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return serveTestRequest(t, app, h, r, session)
+}
+
+func serveTestRequest(t *testing.T, app *App, h http.Handler, r *http.Request, session testSession) (*httptest.ResponseRecorder, context.Context) {
+	t.Helper()
+	ctx, err := app.SessionManager.Load(r.Context(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.UserID != 0 {
+		app.SessionManager.Put(ctx, "authenticatedUserID", session.UserID)
+		app.SessionManager.Put(ctx, "userRole", session.Role)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r.WithContext(ctx))
+	return w, ctx
+}
+
+// checkRedirect comprueba que la respuesta sea un 303 a location.
+func checkRedirect(t *testing.T, w *httptest.ResponseRecorder, location string) {
+	t.Helper()
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d (cuerpo: %q)", w.Code, http.StatusSeeOther, w.Body.String())
+	}
+	if got := w.Header().Get("Location"); got != location {
+		t.Errorf("Location = %q, want %q", got, location)
+	}
+}
+
+func TestCreateLoanHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		bookID       string // "available", "sold_out", "upcoming" o un valor literal
+		limited      bool   // El usuario tiene un límite de 1 préstamo y ya lo usa
+		loanedBefore bool   // El usuario ya tiene prestado el libro disponible
+		wantStatus   int
+		wantFlash    string // Flash esperado, "flashSuccess" o "flashError"
+		wantText     string
+	}{
+		{name: "método no permitido", method: http.MethodGet, bookID: "available", wantStatus: http.StatusMethodNotAllowed},
+		{name: "ID inválido", method: http.MethodPost, bookID: "abc", wantStatus: http.StatusBadRequest},
+		{name: "libro inexistente", method: http.MethodPost, bookID: "999", wantStatus: http.StatusNotFound},
+		{name: "préstamo", method: http.MethodPost, bookID: "available", wantStatus: http.StatusSeeOther, wantFlash: "flashSuccess", wantText: "prestado con éxito"},
+		{name: "ya prestado", method: http.MethodPost, bookID: "available", loanedBefore: true, wantStatus: http.StatusSeeOther, wantFlash: "flashError", wantText: "Ya tienes este libro prestado"},
+		{name: "límite de préstamos", method: http.MethodPost, bookID: "available", limited: true, wantStatus: http.StatusSeeOther, wantFlash: "flashError", wantText: "Ya tienes 1 préstamos activos"},
+		{name: "sin stock", method: http.MethodPost, bookID: "sold_out", wantStatus: http.StatusSeeOther, wantFlash: "flashError", wantText: "No hay stock"},
+		{name: "sin publicar", method: http.MethodPost, bookID: "upcoming", wantStatus: http.StatusSeeOther, wantFlash: "flashError", wantText: "aún no se ha publicado"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			ctx := context.Background()
+			user := User{Username: "lector", Name: "Lector"}
+			if tt.limited {
+				user.MaxActiveLoans = sql.NullInt64{Int64: 1, Valid: true}
+			}
+			user = addTestUser(t, app, user)
+			books := map[string]Book{
+				"available": addTestBook(t, app, Book{Title: "Disponible", Stock: 2}),
+				"sold_out":  addTestBook(t, app, Book{Title: "Agotado"}),
+				"upcoming":  addTestBook(t, app, Book{Title: "Próximamente", Stock: 1, ReleaseAt: time.Now().Add(24 * time.Hour)}),
+			}
+			now := time.Now()
+			if tt.limited {
+				other := addTestBook(t, app, Book{Title: "Otro", Stock: 1})
+				if err := app.Loans.Create(ctx, user.ID, other.ID, now, now.Add(time.Hour), 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.loanedBefore {
+				if err := app.Loans.Create(ctx, user.ID, books["available"].ID, now, now.Add(time.Hour), 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			bookID := tt.bookID
+			if book, ok := books[bookID]; ok {
+				bookID = strconv.Itoa(book.ID)
+			}
+
+			w, session := serveTest(t, app, http.HandlerFunc(app.createLoanHandler), tt.method, "/loan/create",
+				url.Values{"book_id": {bookID}}, testSession{UserID: user.ID, Role: user.Role})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (cuerpo: %q)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantFlash == "" {
+				return
+			}
+			checkRedirect(t, w, "/book?id="+bookID)
+			if got := app.SessionManager.GetString(session, tt.wantFlash); !strings.Contains(got, tt.wantText) {
+				t.Errorf("%s = %q, want que contenga %q", tt.wantFlash, got, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestCreateLoanHandlerTakesStock(t *testing.T) {
+	app := newTestApp(t)
+	user := addTestUser(t, app, User{Username: "lector"})
+	book := addTestBook(t, app, Book{Title: "Último ejemplar", Stock: 1})
+
+	w, _ := serveTest(t, app, http.HandlerFunc(app.createLoanHandler), http.MethodPost, "/loan/create",
+		url.Values{"book_id": {strconv.Itoa(book.ID)}}, testSession{UserID: user.ID, Role: user.Role})
+	checkRedirect(t, w, "/book?id="+strconv.Itoa(book.ID))
+
+	ctx := context.Background()
+	if active, _ := app.Loans.HasActive(ctx, user.ID, book.ID); !active {
+		t.Error("el préstamo no quedó activo")
+	}
+	if got, _ := app.Books.Get(ctx, book.ID); got.Stock != 0 {
+		t.Errorf("Stock = %d, want 0", got.Stock)
+	}
+}
+
+func TestReturnLoanHandler(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	user := addTestUser(t, app, User{Username: "lector"})
+	book := addTestBook(t, app, Book{Title: "Prestado", Stock: 1})
+	now := time.Now()
+	if err := app.Loans.Create(ctx, user.ID, book.ID, now, now.Add(time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+	session := testSession{UserID: user.ID, Role: user.Role}
+	form := url.Values{"book_id": {strconv.Itoa(book.ID)}}
+
+	w, sess := serveTest(t, app, http.HandlerFunc(app.returnLoanHandler), http.MethodPost, "/loan/return", form, session)
+	checkRedirect(t, w, "/my-loans")
+	if got := app.SessionManager.GetString(sess, "flashSuccess"); got == "" {
+		t.Error("falta el mensaje de éxito")
+	}
+	if got, _ := app.Books.Get(ctx, book.ID); got.Stock != 1 {
+		t.Errorf("Stock = %d tras devolver, want 1", got.Stock)
+	}
+
+	// Una segunda devolución ya no encuentra el préstamo
+	w, sess = serveTest(t, app, http.HandlerFunc(app.returnLoanHandler), http.MethodPost, "/loan/return", form, session)
+	checkRedirect(t, w, "/my-loans")
+	if got := app.SessionManager.GetString(sess, "flashError"); !strings.Contains(got, "No se encontró un préstamo activo") {
+		t.Errorf("flashError = %q", got)
+	}
+}
+
+func TestRenewLoanHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Loans.MaxRenewals = 1
+	ctx := context.Background()
+	user := addTestUser(t, app, User{Username: "lector"})
+	book := addTestBook(t, app, Book{Title: "Renovable", Stock: 1})
+	now := time.Now()
+	if err := app.Loans.Create(ctx, user.ID, book.ID, now, now.Add(time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+	session := testSession{UserID: user.ID, Role: user.Role}
+	form := url.Values{"book_id": {strconv.Itoa(book.ID)}}
+
+	w, sess := serveTest(t, app, http.HandlerFunc(app.renewLoanHandler), http.MethodPost, "/loan/renew", form, session)
+	checkRedirect(t, w, "/my-loans")
+	if got := app.SessionManager.GetString(sess, "flashSuccess"); !strings.Contains(got, "renovado") {
+		t.Errorf("flashSuccess = %q", got)
+	}
+
+	w, sess = serveTest(t, app, http.HandlerFunc(app.renewLoanHandler), http.MethodPost, "/loan/renew", form, session)
+	checkRedirect(t, w, "/my-loans")
+	if got := app.SessionManager.GetString(sess, "flashError"); !strings.Contains(got, "máximo de 1 veces") {
+		t.Errorf("flashError = %q", got)
+	}
+}
+
+func TestRequireAuthentication(t *testing.T) {
+	app := newTestApp(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	h := app.requireAuthentication(next)
+
+	w, _ := serveTest(t, app, h, http.MethodGet, "/catalog", nil, testSession{})
+	checkRedirect(t, w, "/login")
+
+	w, _ = serveTest(t, app, h, http.MethodGet, "/catalog", nil, testSession{UserID: 1, Role: "user"})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status con sesión = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	app := newTestApp(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	h := app.requireAdmin(next)
+
+	w, _ := serveTest(t, app, h, http.MethodGet, "/admin/dashboard", nil, testSession{UserID: 1, Role: "user"})
+	checkRedirect(t, w, "/catalog")
+
+	w, _ = serveTest(t, app, h, http.MethodGet, "/admin/dashboard", nil, testSession{UserID: 1, Role: "admin"})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status de admin = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestAdminBookDeleteHandler(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	admin := addTestUser(t, app, User{Username: "admin", Role: "admin"})
+	book := addTestBook(t, app, Book{Title: "A borrar", Stock: 1})
+
+	w, _ := serveTest(t, app, http.HandlerFunc(app.adminBookDeleteHandler), http.MethodPost, "/admin/books/delete?id="+strconv.Itoa(book.ID),
+		url.Values{}, testSession{UserID: admin.ID, Role: admin.Role})
+	checkRedirect(t, w, "/admin/dashboard?success=book_deleted")
+	if _, err := app.Books.Get(ctx, book.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get tras borrar: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAdminUserDeleteHandler(t *testing.T) {
+	app := newTestApp(t)
+	ctx := context.Background()
+	admin := addTestUser(t, app, User{Username: "admin", Role: "admin"})
+	reader := addTestUser(t, app, User{Username: "lector"})
+	session := testSession{UserID: admin.ID, Role: admin.Role}
+
+	// Un administrador no puede borrarse a sí mismo
+	w, _ := serveTest(t, app, http.HandlerFunc(app.adminUserDeleteHandler), http.MethodPost, "/admin/users/delete?id="+strconv.Itoa(admin.ID), url.Values{}, session)
+	checkRedirect(t, w, "/admin/dashboard?error=self_delete")
+	if _, err := app.Users.Get(ctx, admin.ID); err != nil {
+		t.Fatalf("el administrador se borró: %v", err)
+	}
+
+	w, _ = serveTest(t, app, http.HandlerFunc(app.adminUserDeleteHandler), http.MethodPost, "/admin/users/delete?id="+strconv.Itoa(reader.ID), url.Values{}, session)
+	checkRedirect(t, w, "/admin/dashboard?success=user_deleted")
+	if _, err := app.Users.Get(ctx, reader.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get tras borrar: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAdminBookFormHandlerNotFound(t *testing.T) {
+	app := newSQLTestApp(t)
+	admin := addTestUser(t, app, User{Username: "admin", Name: "Admin", Role: "admin"})
+	for _, id := range []string{"abc", "9999"} {
+		w, _ := serveTest(t, app, http.HandlerFunc(app.adminBookFormHandler), http.MethodGet, "/admin/books/new?id="+id, nil, testSession{UserID: admin.ID, Role: admin.Role})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("?id=%s: status = %d, want %d", id, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestAdminBookSaveHandlerErrors(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	admin := addTestUser(t, app, User{Username: "admin", Name: "Admin", Role: "admin"})
+	author, err := app.Authors.FindOrCreate(ctx, "Carmen Laforet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	book := addTestBook(t, app, Book{Title: "Nada", Authors: []Author{author}})
+	session := testSession{UserID: admin.ID, Role: admin.Role}
+	save := func(bookID, authorID string) *httptest.ResponseRecorder {
+		form := url.Values{
+			"book_id":    {bookID},
+			"title":      {"Nada"},
+			"author_ids": {authorID},
+			"release_at": {"2020-01-01T10:00"},
+		}
+		w, _ := serveMultipartTest(t, app, http.HandlerFunc(app.adminBookSaveHandler), "/admin/books/save", form, session)
+		return w
+	}
+	id, authorID := strconv.Itoa(book.ID), strconv.Itoa(author.ID)
+
+	checkRedirect(t, save("", "9999"), "/admin/books/new?error=autor_invalido")
+	checkRedirect(t, save(id, "9999"), "/admin/books/new?id="+id+"&error=autor_invalido")
+	if w := save("9999", authorID); w.Code != http.StatusNotFound {
+		t.Errorf("libro inexistente: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	checkRedirect(t, save(id, authorID), "/admin/dashboard?success=book_saved")
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// createHoldHandler pone al usuario en la cola de reservas de un libro sin stock.
+func (app *App) createHoldHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	bookID, err := strconv.Atoi(r.FormValue("book_id"))
+	if err != nil {
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		return
+	}
+	userID := app.SessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if userID == 0 { // Seguridad extra
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	bookURL := fmt.Sprintf("/book?id=%d", bookID)
+
+	position, err := app.Holds.Create(r.Context(), userID, bookID, time.Now())
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, ErrStockAvailable):
+		app.SessionManager.Put(r.Context(), "flashError", "Este libro tiene stock disponible: puedes tomarlo prestado directamente.")
+		http.Redirect(w, r, bookURL, http.StatusSeeOther)
+		return
+	case errors.Is(err, ErrAlreadyLoaned):
+		app.SessionManager.Put(r.Context(), "flashError", "Ya tienes este libro prestado.")
+		http.Redirect(w, r, bookURL, http.StatusSeeOther)
+		return
+	case errors.Is(err, ErrAlreadyOnHold):
+		app.SessionManager.Put(r.Context(), "flashError", "Ya tienes una reserva de este libro.")
+		http.Redirect(w, r, "/my-holds", http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Println(err)
+		app.SessionManager.Put(r.Context(), "flashError", "Error al registrar la reserva.")
+		http.Error(w, "Error de servidor al registrar la reserva", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Reserva: usuario %d en la posición %d de la cola del libro %d", userID, position, bookID)
+	app.SessionManager.Put(r.Context(), "flashSuccess", fmt.Sprintf("¡Reserva registrada! Estás en la posición %d de la cola.", position))
+	http.Redirect(w, r, "/my-holds", http.StatusSeeOther)
+}
+
+// cancelHoldHandler cancela una reserva del usuario. Si tenía una copia
+// apartada, pasa a la siguiente reserva de la cola.
+func (app *App) cancelHoldHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	holdID, err := strconv.Atoi(r.FormValue("hold_id"))
+	if err != nil {
+		http.Error(w, "ID de reserva inválido", http.StatusBadRequest)
+		return
+	}
+	userID := app.SessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if userID == 0 { // Seguridad extra
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	err = app.Holds.Cancel(r.Context(), userID, holdID, time.Now())
+	if errors.Is(err, ErrNotFound) {
+		app.SessionManager.Put(r.Context(), "flashError", "No se encontró una reserva pendiente para cancelar.")
+		http.Redirect(w, r, "/my-holds", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		app.SessionManager.Put(r.Context(), "flashError", "Error al cancelar la reserva.")
+		http.Error(w, "Error de servidor al cancelar la reserva", http.StatusInternalServerError)
+		return
+	}
+
+	app.SessionManager.Put(r.Context(), "flashSuccess", "Reserva cancelada.")
+	http.Redirect(w, r, "/my-holds", http.StatusSeeOther)
+}
+
+// myHoldsHandler muestra las reservas en cola, las copias apartadas y las
+// preventas pendientes del usuario.
+func (app *App) myHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := app.SessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if userID == 0 {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	holds, err := app.Holds.ListByUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error al consultar reservas del usuario %d: %v", userID, err)
+		http.Error(w, "Error de servidor al cargar mis reservas", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	for i := range holds {
+		app.formatHold(&holds[i], now)
+	}
+	preorders, err := app.Preorders.ListByUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error al consultar preventas del usuario %d: %v", userID, err)
+		http.Error(w, "Error de servidor al cargar mis reservas", http.StatusInternalServerError)
+		return
+	}
+	for i := range preorders {
+		preorders[i].CreatedAtFormatted = preorders[i].CreatedAt.Local().Format("02/01/2006 15:04")
+		preorders[i].Book.ReleaseDate = formatMonthYear(preorders[i].Book.ReleaseAt)
+	}
+
+	data := MyHoldsPageData{
+		UserName:       app.SessionManager.GetString(r.Context(), "userName"),
+		IsAdmin:        app.SessionManager.GetString(r.Context(), "userRole") == "admin",
+		Holds:          holds,
+		Preorders:      preorders,
+		SuccessMessage: app.SessionManager.PopString(r.Context(), "flashSuccess"),
+		ErrorMessage:   app.SessionManager.PopString(r.Context(), "flashError"),
+		CSRFToken:      app.csrfToken(r),
+	}
+
+	files := app.templateFiles("my_holds.html", "partials/navbar.html")
+	ts, err := template.ParseFiles(files...)
+	if err != nil {
+		log.Printf("Error al parsear plantillas para my_holds: %v", err)
+		http.Error(w, "Error interno del servidor al cargar la página", http.StatusInternalServerError)
+		return
+	}
+	if err := ts.ExecuteTemplate(w, "my_holds.html", data); err != nil {
+		log.Printf("Error al ejecutar plantilla my_holds: %v", err)
+		http.Error(w, "Error interno del servidor al renderizar la página", http.StatusInternalServerError)
+	}
+}
+
+// formatHold rellena los campos de presentación de una reserva.
+func (app *App) formatHold(hold *Hold, now time.Time) {
+	hold.CreatedAtFormatted = hold.CreatedAt.Local().Format("02/01/2006 15:04")
+	if hold.Status == "ready" && hold.ExpiresAt.Valid {
+		hold.ExpiresAtFormatted = hold.ExpiresAt.Time.Local().Format("02/01/2006 15:04")
+		hold.TimeRemaining = formatTimeRemaining(hold.ExpiresAt.Time, now)
+	}
+}
+
+// expireUnclaimedHolds es la tarea programada que libera las copias apartadas
+// que no se recogieron a tiempo.
+func (app *App) expireUnclaimedHolds(ctx context.Context, now time.Time) error {
+	expired, err := app.Holds.ExpireReady(ctx, now)
+	for _, hold := range expired {
+		log.Printf("Reserva %d expirada sin recoger: usuario %d, libro %d", hold.ID, hold.UserID, hold.BookID)
+	}
+	return err
+}
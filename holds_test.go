@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHoldQueue(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	first := addTestUser(t, app, User{Username: "primera", Name: "Primera"})
+	second := addTestUser(t, app, User{Username: "segunda", Name: "Segunda"})
+	third := addTestUser(t, app, User{Username: "tercera", Name: "Tercera"})
+	book := addTestBook(t, app, Book{Title: "Niebla"})
+	addTestCopies(t, app, book.ID, 1)
+	now := time.Now()
+	window := app.Config.Loans.HoldPickupWindow.Duration
+
+	if _, err := app.Holds.Create(ctx, second.ID, book.ID, now); !errors.Is(err, ErrStockAvailable) {
+		t.Fatalf("reserva con stock: error = %v, want ErrStockAvailable", err)
+	}
+	if _, err := app.Holds.Create(ctx, second.ID, 9999, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("reserva de un libro inexistente: error = %v, want ErrNotFound", err)
+	}
+	if err := app.Loans.Create(ctx, first.ID, book.ID, now, now.Add(time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.Holds.Create(ctx, first.ID, book.ID, now); !errors.Is(err, ErrAlreadyLoaned) {
+		t.Errorf("reserva del libro prestado: error = %v, want ErrAlreadyLoaned", err)
+	}
+	for i, user := range []User{second, third} {
+		position, err := app.Holds.Create(ctx, user.ID, book.ID, now.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if position != i+1 {
+			t.Errorf("posición de %s = %d, want %d", user.Username, position, i+1)
+		}
+	}
+	if _, err := app.Holds.Create(ctx, second.ID, book.ID, now); !errors.Is(err, ErrAlreadyOnHold) {
+		t.Errorf("reserva repetida: error = %v, want ErrAlreadyOnHold", err)
+	}
+
+	// Con reservas en cola no se renueva
+	if _, err := app.Loans.Renew(ctx, first.ID, book.ID, now, time.Hour, 5); !errors.Is(err, ErrHoldsPending) {
+		t.Errorf("Renew con cola: error = %v, want ErrHoldsPending", err)
+	}
+
+	// La copia devuelta se aparta para la primera reserva, no vuelve al stock
+	if err := app.Loans.Return(ctx, first.ID, book.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	hold, err := app.Holds.GetActive(ctx, second.ID, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hold.Status != "ready" || !hold.ExpiresAt.Valid || !hold.ExpiresAt.Time.Equal(now.Add(window)) {
+		t.Fatalf("reserva tras la devolución = %+v, want ready hasta %v", hold, now.Add(window))
+	}
+	if got, _ := app.Books.Get(ctx, book.ID); got.Stock != 0 {
+		t.Errorf("Stock con la copia apartada = %d, want 0", got.Stock)
+	}
+	if err := app.Loans.Create(ctx, third.ID, book.ID, now, now.Add(time.Hour), 0); !errors.Is(err, ErrNoStock) {
+		t.Errorf("préstamo de la copia apartada para otra: error = %v, want ErrNoStock", err)
+	}
+
+	// Quien tiene la copia apartada la recoge aunque no haya stock
+	if err := app.Loans.Create(ctx, second.ID, book.ID, now, now.Add(time.Hour), 0); err != nil {
+		t.Fatalf("préstamo de la copia apartada: %v", err)
+	}
+	if _, err := app.Holds.GetActive(ctx, second.ID, book.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("la reserva recogida sigue activa: %v", err)
+	}
+	if waiting, _ := app.Holds.CountWaiting(ctx, book.ID); waiting != 1 {
+		t.Errorf("CountWaiting = %d, want 1", waiting)
+	}
+
+	// Si no se recoge a tiempo, la reserva expira y la copia vuelve al stock
+	if err := app.Loans.Return(ctx, second.ID, book.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if expired, _ := app.Holds.ExpireReady(ctx, now.Add(window-time.Minute)); len(expired) != 0 {
+		t.Errorf("ExpireReady dentro del plazo = %+v, want ninguna", expired)
+	}
+	expired, err := app.Holds.ExpireReady(ctx, now.Add(window+time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].UserID != third.ID {
+		t.Fatalf("ExpireReady = %+v, want la reserva de tercera", expired)
+	}
+	if got, _ := app.Books.Get(ctx, book.ID); got.Stock != 1 {
+		t.Errorf("Stock tras expirar la reserva = %d, want 1", got.Stock)
+	}
+}
+
+func TestHoldCancelPassesCopyOn(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	reader := addTestUser(t, app, User{Username: "lectora", Name: "Lectora"})
+	first := addTestUser(t, app, User{Username: "primera", Name: "Primera"})
+	second := addTestUser(t, app, User{Username: "segunda", Name: "Segunda"})
+	book := addTestBook(t, app, Book{Title: "Niebla"})
+	addTestCopies(t, app, book.ID, 1)
+	now := time.Now()
+
+	if err := app.Loans.Create(ctx, reader.ID, book.ID, now, now.Add(time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []User{first, second} {
+		if _, err := app.Holds.Create(ctx, user.ID, book.ID, now); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+	if err := app.Loans.Return(ctx, reader.ID, book.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	hold, err := app.Holds.GetActive(ctx, first.ID, book.ID)
+	if err != nil || hold.Status != "ready" {
+		t.Fatalf("reserva de primera = %+v, %v; want ready", hold, err)
+	}
+
+	if err := app.Holds.Cancel(ctx, second.ID, hold.ID, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cancelar la reserva de otra usuaria: error = %v, want ErrNotFound", err)
+	}
+	if err := app.Holds.Cancel(ctx, first.ID, hold.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	next, err := app.Holds.GetActive(ctx, second.ID, book.ID)
+	if err != nil || next.Status != "ready" {
+		t.Errorf("reserva de segunda tras cancelar = %+v, %v; want ready", next, err)
+	}
+	if err := app.Holds.Cancel(ctx, first.ID, hold.ID, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cancelar dos veces: error = %v, want ErrNotFound", err)
+	}
+}
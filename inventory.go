@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Origen de cada ejecución de la conciliación
+const (
+	reconcileSourceCommand = "command"
+	reconcileSourceJob     = "job"
+	reconcileSourceAdmin   = "admin"
+)
+
+// inventoryRunsShown es cuántas ejecuciones anteriores muestra el informe.
+const inventoryRunsShown = 10
+
+// reconcileInventory concilia el inventario, registra la ejecución con sus
+// discrepancias y las escribe en el log.
+func (app *App) reconcileInventory(ctx context.Context, now time.Time, fix bool, source string) (ReconciliationRun, []BookInventory, error) {
+	run := ReconciliationRun{Source: source, Fix: fix, StartedAt: now}
+	books, err := app.Inventory.Reconcile(ctx, now, fix)
+	if err != nil {
+		return run, books, err
+	}
+	run.BooksChecked = len(books)
+	for _, inv := range books {
+		for _, issue := range inv.Issues {
+			run.Issues = append(run.Issues, issue)
+			run.IssuesFound++
+			if issue.Fixed {
+				run.IssuesFixed++
+			}
+			log.Printf("Inventario: libro %d, %s: %s (corregida: %t)", issue.BookID, issue.Kind, issue.Description, issue.Fixed)
+		}
+	}
+	if err := app.Inventory.SaveRun(ctx, &run); err != nil {
+		return run, books, err
+	}
+	return run, books, nil
+}
+
+// reconcileInventoryJob es la tarea programada de conciliación. Solo corrige
+// si inventory.auto_fix está activo.
+func (app *App) reconcileInventoryJob(ctx context.Context, now time.Time) error {
+	_, _, err := app.reconcileInventory(ctx, now, app.Config.Inventory.AutoFix, reconcileSourceJob)
+	return err
+}
+
+// adminInventoryHandler muestra el informe de inventario: el estado actual de
+// cada libro, sin corregir nada, y las últimas conciliaciones registradas.
+func (app *App) adminInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	books, err := app.Inventory.Reconcile(r.Context(), time.Now(), false)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al revisar el inventario", http.StatusInternalServerError)
+		return
+	}
+	runs, err := app.Inventory.ListRuns(r.Context(), inventoryRunsShown)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar las conciliaciones", http.StatusInternalServerError)
+		return
+	}
+	issuesFound := 0
+	for _, inv := range books {
+		issuesFound += len(inv.Issues)
+	}
+	for i := range runs {
+		runs[i].StartedAtFormatted = runs[i].StartedAt.Local().Format("02/01/2006 15:04")
+	}
+
+	data := AdminInventoryPageData{
+		UserName:       app.SessionManager.GetString(r.Context(), "userName"),
+		IsAdmin:        true,
+		Books:          books,
+		IssuesFound:    issuesFound,
+		Runs:           runs,
+		SuccessMessage: r.URL.Query().Get("success"),
+		ErrorMessage:   r.URL.Query().Get("error"),
+		CSRFToken:      app.csrfToken(r),
+	}
+
+	files := app.templateFiles("admin_inventory.html", "partials/navbar.html")
+	ts, err := template.ParseFiles(files...)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al parsear plantillas de inventario", http.StatusInternalServerError)
+		return
+	}
+	ts.ExecuteTemplate(w, "admin_inventory.html", data)
+}
+
+// adminInventoryReconcileHandler lanza una conciliación desde el panel. Con el
+// campo fix también corrige las discrepancias.
+func (app *App) adminInventoryReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	fix := r.FormValue("fix") != ""
+
+	run, _, err := app.reconcileInventory(r.Context(), time.Now(), fix, reconcileSourceAdmin)
+	if err != nil {
+		log.Printf("Error al conciliar el inventario: %v", err)
+		http.Redirect(w, r, "/admin/inventory?error=conciliacion_fallida", http.StatusSeeOther)
+		return
+	}
+	log.Printf("Inventario: conciliación %d desde el panel, %d discrepancias, %d corregidas", run.ID, run.IssuesFound, run.IssuesFixed)
+	http.Redirect(w, r, "/admin/inventory?success=conciliacion_realizada", http.StatusSeeOther)
+}
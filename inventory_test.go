@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// issueKinds devuelve los códigos de las discrepancias y cuántas se corrigieron.
+func issueKinds(inv BookInventory) (map[string]bool, int) {
+	kinds := make(map[string]bool)
+	fixed := 0
+	for _, issue := range inv.Issues {
+		kinds[issue.Kind] = true
+		if issue.Fixed {
+			fixed++
+		}
+	}
+	return kinds, fixed
+}
+
+func TestReconcileInventory(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	user := addTestUser(t, app, User{Username: "lector", Name: "Lector"})
+	broken := addTestBook(t, app, Book{Title: "Descuadrado"})
+	sound := addTestBook(t, app, Book{Title: "Cuadrado"})
+	addTestCopies(t, app, broken.ID, 3)
+	addTestCopies(t, app, sound.ID, 1)
+	if err := app.Loans.Create(ctx, user.ID, broken.ID, now, now.Add(time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// El préstamo pierde su copia, que queda prestada sin préstamo, y una de
+	// las disponibles tiene la licencia agotada
+	if _, err := app.DB.ExecContext(ctx, "UPDATE loans SET copy_id = NULL WHERE book_id = ?", broken.ID); err != nil {
+		t.Fatal(err)
+	}
+	available := copyWithStatus(t, app, broken.ID, "available")
+	if _, err := app.DB.ExecContext(ctx, "UPDATE copies SET licence_loans_remaining = 0 WHERE id = ?", available.ID); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"copia_prestada_sin_prestamo", "prestamo_sin_copia", "licencia_agotada"}
+
+	// Sin corregir solo informa, y la siguiente revisión encuentra lo mismo
+	for i := 0; i < 2; i++ {
+		books, err := app.Inventory.Reconcile(ctx, now, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(books) != 2 {
+			t.Fatalf("Reconcile revisó %d libros, want 2", len(books))
+		}
+		kinds, fixed := issueKinds(books[0])
+		for _, kind := range want {
+			if !kinds[kind] {
+				t.Errorf("revisión %d: falta %s en %+v", i+1, kind, books[0].Issues)
+			}
+		}
+		if fixed != 0 {
+			t.Errorf("revisión %d: %d corregidas sin fix", i+1, fixed)
+		}
+		if books[0].Capacity != 3 || books[0].LoanedCopies != 1 || books[0].ActiveLoans != 1 {
+			t.Errorf("inventario = %+v", books[0])
+		}
+		if len(books[1].Issues) != 0 || !books[1].Balanced {
+			t.Errorf("el libro cuadrado tiene discrepancias: %+v", books[1])
+		}
+	}
+
+	run, books, err := app.reconcileInventory(ctx, now, true, reconcileSourceCommand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, fixed := issueKinds(books[0]); fixed != len(books[0].Issues) {
+		t.Errorf("corregidas %d de %+v", fixed, books[0].Issues)
+	}
+	if run.ID == 0 || run.BooksChecked != 2 || run.IssuesFound != len(want) || run.IssuesFixed != len(want) {
+		t.Errorf("ejecución = %+v", run)
+	}
+	books, err = app.Inventory.Reconcile(ctx, now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books[0].Issues) != 0 || !books[0].Balanced {
+		t.Errorf("tras corregir: %+v", books[0])
+	}
+	// Quedan el préstamo y una copia disponible; la de la licencia agotada se retiró
+	if got, _ := app.Books.Get(ctx, broken.ID); got.Stock != 1 {
+		t.Errorf("Stock tras corregir = %d, want 1", got.Stock)
+	}
+
+	runs, err := app.Inventory.ListRuns(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != run.ID || !runs[0].Fix || len(runs[0].Issues) != len(want) || !runs[0].Issues[0].Fixed {
+		t.Errorf("ListRuns = %+v", runs)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// normalizeISBN quita guiones y espacios de un ISBN-10 o ISBN-13 y comprueba
+// su longitud y su dígito de control. Devuelve el ISBN solo con dígitos (y la
+// X final de un ISBN-10, en mayúscula).
+func normalizeISBN(value string) (string, error) {
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(value))
+	switch len(isbn) {
+	case 10:
+		if !validISBN10(isbn) {
+			return "", errors.New("el dígito de control del ISBN-10 no es válido")
+		}
+	case 13:
+		if !validISBN13(isbn) {
+			return "", errors.New("el dígito de control del ISBN-13 no es válido")
+		}
+	default:
+		return "", errors.New("el ISBN debe tener 10 o 13 dígitos")
+	}
+	return isbn, nil
+}
+
+// validISBN10 comprueba que la suma ponderada (10..1) sea múltiplo de 11. Solo
+// el último carácter puede ser X, que vale 10.
+func validISBN10(isbn string) bool {
+	sum := 0
+	for i, c := range isbn {
+		var digit int
+		switch {
+		case c >= '0' && c <= '9':
+			digit = int(c - '0')
+		case c == 'X' && i == 9:
+			digit = 10
+		default:
+			return false
+		}
+		sum += digit * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+// validISBN13 comprueba que la suma con pesos alternos 1 y 3 sea múltiplo de 10.
+func validISBN13(isbn string) bool {
+	sum := 0
+	for i, c := range isbn {
+		if c < '0' || c > '9' {
+			return false
+		}
+		digit := int(c - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"ISBN-13 con guiones", "978-0-306-40615-7", "9780306406157", false},
+		{"ISBN-13 con espacios", "978 0 306 40615 7", "9780306406157", false},
+		{"ISBN-10", "0-306-40615-2", "0306406152", false},
+		{"ISBN-10 con X final", "0-8044-2957-X", "080442957X", false},
+		{"X final en minúscula", "080442957x", "080442957X", false},
+		{"dígito de control ISBN-13 erróneo", "978-0-306-40615-8", "", true},
+		{"dígito de control ISBN-10 erróneo", "0-306-40615-3", "", true},
+		{"X fuera de la última posición", "08044295X7", "", true},
+		{"letras en un ISBN-13", "978030640615A", "", true},
+		{"longitud incorrecta", "12345", "", true},
+		{"vacío", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeISBN(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeISBN(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeISBN(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
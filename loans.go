@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// loanDueDate devuelve la fecha de vencimiento de un préstamo hecho en loanDate.
+func (app *App) loanDueDate(loanDate time.Time) time.Time {
+	return loanDate.Add(app.Config.Loans.Period.Duration)
+}
+
+// loanLimit devuelve el máximo de préstamos activos del usuario: su límite
+// propio si lo tiene o el de su rol. 0 significa sin límite.
+func (app *App) loanLimit(user User) int {
+	if user.MaxActiveLoans.Valid {
+		return int(user.MaxActiveLoans.Int64)
+	}
+	if limit, ok := app.Config.Loans.MaxActiveByRole[user.Role]; ok {
+		return limit
+	}
+	return app.Config.Loans.MaxActive
+}
+
+// expireOverdueLoans es la tarea programada que expira los préstamos vencidos.
+func (app *App) expireOverdueLoans(ctx context.Context, now time.Time) error {
+	expired, err := app.Loans.ExpireOverdue(ctx, now)
+	for _, loan := range expired {
+		log.Printf("Préstamo %d expirado: usuario %d, libro %d, vencía el %s", loan.ID, loan.UserID, loan.BookID, loan.DueDate.Local().Format("02/01/2006 15:04"))
+	}
+	return err
+}
+
+// formatTimeRemaining describe el tiempo que queda hasta due, por ejemplo
+// "3 días y 4 horas" o "25 minutos".
+func formatTimeRemaining(due, now time.Time) string {
+	d := due.Sub(now)
+	if d <= 0 {
+		return "Vencido"
+	}
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	switch {
+	case days > 0 && hours > 0:
+		return fmt.Sprintf("%s y %s", plural(days, "día", "días"), plural(hours, "hora", "horas"))
+	case days > 0:
+		return plural(days, "día", "días")
+	case hours > 0:
+		return plural(hours, "hora", "horas")
+	case minutes > 0:
+		return plural(minutes, "minuto", "minutos")
+	}
+	return "Menos de un minuto"
+}
+
+// plural da formato "1 día" / "2 días".
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, pluralForm)
+}
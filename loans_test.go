@@ -0,0 +1,29 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestLoanLimit(t *testing.T) {
+	app := &App{Config: defaultConfig()}
+	app.Config.Loans.MaxActive = 3
+	app.Config.Loans.MaxActiveByRole = map[string]int{"user": 5, "admin": 0}
+
+	tests := []struct {
+		name string
+		user User
+		want int
+	}{
+		{"límite del rol", User{Role: "user"}, 5},
+		{"rol sin límite", User{Role: "admin"}, 0},
+		{"rol sin configurar", User{Role: "invitado"}, 3},
+		{"límite propio", User{Role: "user", MaxActiveLoans: sql.NullInt64{Int64: 1, Valid: true}}, 1},
+		{"límite propio 0 es sin límite", User{Role: "user", MaxActiveLoans: sql.NullInt64{Int64: 0, Valid: true}}, 0},
+	}
+	for _, tt := range tests {
+		if got := app.loanLimit(tt.user); got != tt.want {
+			t.Errorf("%s: loanLimit = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
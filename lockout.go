@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Ámbitos de los contadores de intentos fallidos de login
+const (
+	throttleScopeUsername = "username"
+	throttleScopeIP       = "ip"
+)
+
+// LoginThrottle define el retardo exponencial y el bloqueo temporal tras
+// varios intentos de login fallidos.
+type LoginThrottle struct {
+	MaxFailures  int      `json:"max_failures"`
+	BaseDelay    Duration `json:"base_delay"`
+	MaxDelay     Duration `json:"max_delay"`
+	LockDuration Duration `json:"lock_duration"`
+}
+
+// defaultLoginThrottle es la configuración usada si no se indica otra.
+var defaultLoginThrottle = LoginThrottle{
+	MaxFailures:  5,
+	BaseDelay:    Duration{time.Second},
+	MaxDelay:     Duration{30 * time.Second},
+	LockDuration: Duration{15 * time.Minute},
+}
+
+// backoff devuelve cuánto hay que esperar tras el número de fallos indicado.
+func (t LoginThrottle) backoff(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	delay := t.BaseDelay.Duration
+	for i := 1; i < failures && delay < t.MaxDelay.Duration; i++ {
+		delay *= 2
+	}
+	if delay > t.MaxDelay.Duration {
+		delay = t.MaxDelay.Duration
+	}
+	return delay
+}
+
+// clientIP devuelve la IP remota de la petición sin el puerto.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// throttleKeys devuelve los contadores que aplican a un intento de login.
+func throttleKeys(username, ip string) [][2]string {
+	return [][2]string{
+		{throttleScopeUsername, strings.ToLower(username)},
+		{throttleScopeIP, ip},
+	}
+}
+
+// loadLoginFailure lee el contador de un ámbito. Los contadores caducados
+// (bloqueo vencido o sin fallos recientes) se tratan como vacíos.
+func (app *App) loadLoginFailure(ctx context.Context, scope, identifier string, now time.Time) (LoginLock, error) {
+	lock, err := app.LoginFailures.Get(ctx, scope, identifier)
+	if errors.Is(err, ErrNotFound) {
+		return LoginLock{Scope: scope, Identifier: identifier}, nil
+	}
+	if err != nil {
+		return lock, err
+	}
+
+	expiredLock := !lock.LockedUntil.IsZero() && !lock.LockedUntil.After(now)
+	stale := now.Sub(lock.LastFailureAt) > app.Config.LoginThrottle.LockDuration.Duration
+	if expiredLock || stale {
+		lock.Failures = 0
+		lock.LockedUntil = time.Time{}
+	}
+	return lock, nil
+}
+
+// loginBlockedUntil devuelve hasta cuándo se rechazan los intentos de login
+// para ese usuario e IP. Un instante cero significa que se permite el intento.
+func (app *App) loginBlockedUntil(ctx context.Context, username, ip string, now time.Time) (time.Time, error) {
+	var blockedUntil time.Time
+	for _, key := range throttleKeys(username, ip) {
+		lock, err := app.loadLoginFailure(ctx, key[0], key[1], now)
+		if err != nil {
+			return time.Time{}, err
+		}
+		until := lock.LockedUntil
+		if until.IsZero() && lock.Failures > 0 {
+			until = lock.LastFailureAt.Add(app.Config.LoginThrottle.backoff(lock.Failures))
+		}
+		if until.After(now) && until.After(blockedUntil) {
+			blockedUntil = until
+		}
+	}
+	return blockedUntil, nil
+}
+
+// recordLoginFailure incrementa los contadores de usuario e IP y bloquea
+// temporalmente los que alcanzan el máximo de fallos permitido.
+func (app *App) recordLoginFailure(ctx context.Context, username, ip string, now time.Time) error {
+	for _, key := range throttleKeys(username, ip) {
+		lock, err := app.LoginFailures.RecordFailure(ctx, key[0], key[1], now, app.Config.LoginThrottle)
+		if err != nil {
+			return err
+		}
+		if !lock.LockedUntil.IsZero() {
+			log.Printf("BLOQUEO: %s %q bloqueado hasta %s tras %d intentos fallidos (usuario %q, dirección %s)",
+				key[0], key[1], lock.LockedUntil.Format(time.RFC3339), lock.Failures, username, ip)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	throttle := LoginThrottle{
+		BaseDelay: Duration{time.Second},
+		MaxDelay:  Duration{30 * time.Second},
+	}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{5, 16 * time.Second},
+		{6, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := throttle.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginFailureStoreRecordFailure(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	throttle := LoginThrottle{MaxFailures: 3, LockDuration: Duration{15 * time.Minute}}
+	now := time.Now().Truncate(time.Second)
+	record := func(at time.Time) LoginLock {
+		t.Helper()
+		lock, err := app.LoginFailures.RecordFailure(ctx, throttleScopeUsername, "lector", at, throttle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lock
+	}
+
+	for want := 1; want < 3; want++ {
+		if lock := record(now); lock.Failures != want || !lock.LockedUntil.IsZero() {
+			t.Fatalf("fallo %d: %+v", want, lock)
+		}
+	}
+	lock := record(now)
+	if want := now.Add(15 * time.Minute); lock.Failures != 3 || !lock.LockedUntil.Equal(want) {
+		t.Fatalf("tercer fallo: %+v, want bloqueado hasta %v", lock, want)
+	}
+	if stored, err := app.LoginFailures.Get(ctx, throttleScopeUsername, "lector"); err != nil || !stored.LockedUntil.Equal(lock.LockedUntil) {
+		t.Errorf("Get = %+v, %v", stored, err)
+	}
+
+	// Vencido el bloqueo, el contador vuelve a empezar
+	after := lock.LockedUntil.Add(time.Second)
+	if lock := record(after); lock.Failures != 1 || !lock.LockedUntil.IsZero() {
+		t.Errorf("fallo tras el bloqueo: %+v, want 1 sin bloqueo", lock)
+	}
+	// Y también sin fallos recientes
+	if lock := record(after.Add(time.Hour)); lock.Failures != 1 {
+		t.Errorf("fallo tras una hora: %+v, want 1", lock)
+	}
+}
+
+func TestRecordLoginFailureConcurrent(t *testing.T) {
+	app := newSQLTestApp(t)
+	app.Config.LoginThrottle.MaxFailures = 100
+	ctx := context.Background()
+	now := time.Now()
+	const attempts = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- app.recordLoginFailure(ctx, "Lector", "192.0.2.1", now)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, key := range throttleKeys("Lector", "192.0.2.1") {
+		lock, err := app.LoginFailures.Get(ctx, key[0], key[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lock.Failures != attempts {
+			t.Errorf("%s %q: %d fallos, want %d", key[0], key[1], lock.Failures, attempts)
+		}
+	}
+}
@@ -1,43 +1,86 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
-	"time"
+	"os"
 
 	"github.com/alexedwards/scs/v2"
 )
 
 type App struct {
-	DB             *sql.DB
+	Config         *Config
+	DB             *sqlDB // Solo para migraciones; los handlers usan los stores
 	SessionManager *scs.SessionManager
+	Books          BookStore
+	Authors        AuthorStore
+	Series         SeriesStore
+	Genres         GenreStore
+	Reviews        ReviewStore
+	Users          UserStore
+	Loans          LoanStore
+	Holds          HoldStore
+	Copies         CopyStore
+	Inventory      InventoryStore
+	Preorders      PreorderStore
+	LoginFailures  LoginFailureStore
+	Search         *searchIndex // Índice de búsqueda del catálogo, en memoria
 }
 
 func main() {
+	if err := runCLI(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatal(err)
+	}
+}
+
+// newApp abre la base de datos y prepara el gestor de sesiones a partir de la configuración.
+func newApp(cfg *Config) (*App, error) {
+	sameSite, _ := cfg.Session.sameSiteMode() // Ya validado en LoadConfig
 	sessionManager := scs.New()
-	sessionManager.Lifetime = 24 * time.Hour
-	sessionManager.Cookie.Persist = true
-	sessionManager.Cookie.SameSite = http.SameSiteLaxMode
-	sessionManager.Cookie.Secure = false
+	sessionManager.Lifetime = cfg.Session.Lifetime.Duration
+	sessionManager.Cookie.Name = cfg.Session.CookieName
+	sessionManager.Cookie.Persist = cfg.Session.CookiePersist
+	sessionManager.Cookie.SameSite = sameSite
+	sessionManager.Cookie.Secure = cfg.Session.CookieSecure
 
-	db, err := InitDB()
+	db, err := InitDB(cfg.Database)
 	if err != nil {
-		log.Fatalf("No se pudo conectar a la base de datos: %v", err)
+		return nil, err
 	}
-	defer db.Close()
 
-	app := &App{
+	return &App{
+		Config:         cfg,
 		DB:             db,
 		SessionManager: sessionManager,
-	}
-
-	// app.seedDatabase()
+		Books:          &sqlBookStore{db: db},
+		Authors:        &sqlAuthorStore{db: db},
+		Series:         &sqlSeriesStore{db: db},
+		Genres:         &sqlGenreStore{db: db},
+		Reviews:        &sqlReviewStore{db: db},
+		Users:          &sqlUserStore{db: db},
+		Loans:          &sqlLoanStore{db: db, holdPickupWindow: cfg.Loans.HoldPickupWindow.Duration},
+		Holds:          &sqlHoldStore{db: db, holdPickupWindow: cfg.Loans.HoldPickupWindow.Duration},
+		Copies:         &sqlCopyStore{db: db, holdPickupWindow: cfg.Loans.HoldPickupWindow.Duration},
+		Inventory:      &sqlInventoryStore{db: db, holdPickupWindow: cfg.Loans.HoldPickupWindow.Duration},
+		Search:         newSearchIndex(),
+		Preorders:      &sqlPreorderStore{db: db},
+		LoginFailures:  &sqlLoginFailureStore{db: db},
+	}, nil
+}
 
+// routes registra todas las rutas de la aplicación y sus middlewares.
+func (app *App) routes() http.Handler {
 	mux := http.NewServeMux()
-	fileServer := http.FileServer(http.Dir("./static/"))
-	mux.Handle("/static/", http.StripPrefix("/static/", fileServer))
+	fileServer := http.FileServer(http.Dir(app.Config.Paths.Static))
+	mux.Handle("/static/", http.StripPrefix("/static/", hideLegacyPDFs(fileServer)))
+	// Las portadas se sirven desde su directorio configurado, aunque esté fuera de static.
+	// Los PDFs no son públicos: solo se entregan con /read a quien tenga el libro prestado.
+	mux.Handle("/static/book_covers/", http.StripPrefix("/static/book_covers/", http.FileServer(http.Dir(app.Config.Paths.Covers))))
 
 	// --- Rutas Públicas ---
 	mux.HandleFunc("/login", app.loginHandler)
@@ -48,9 +91,18 @@ func main() {
 	mux.Handle("/catalog", app.requireAuthentication(http.HandlerFunc(app.catalogHandler)))
 	mux.Handle("/upcoming", app.requireAuthentication(http.HandlerFunc(app.upcomingReleasesHandler)))
 	mux.Handle("/book", app.requireAuthentication(http.HandlerFunc(app.bookDetailHandler)))
+	mux.Handle("/author", app.requireAuthentication(http.HandlerFunc(app.authorHandler)))
 	mux.Handle("/loan/create", app.requireAuthentication(http.HandlerFunc(app.createLoanHandler)))
 	mux.Handle("/loan/return", app.requireAuthentication(http.HandlerFunc(app.returnLoanHandler)))
+	mux.Handle("/loan/renew", app.requireAuthentication(http.HandlerFunc(app.renewLoanHandler)))
 	mux.Handle("/my-loans", app.requireAuthentication(http.HandlerFunc(app.myLoansHandler)))
+	mux.Handle("/hold/create", app.requireAuthentication(http.HandlerFunc(app.createHoldHandler)))
+	mux.Handle("/hold/cancel", app.requireAuthentication(http.HandlerFunc(app.cancelHoldHandler)))
+	mux.Handle("/my-holds", app.requireAuthentication(http.HandlerFunc(app.myHoldsHandler)))
+	mux.Handle("/preorder/create", app.requireAuthentication(http.HandlerFunc(app.createPreorderHandler)))
+	mux.Handle("/preorder/cancel", app.requireAuthentication(http.HandlerFunc(app.cancelPreorderHandler)))
+	mux.Handle("/review/save", app.requireAuthentication(http.HandlerFunc(app.saveReviewHandler)))
+	mux.Handle("/read", app.requireAuthentication(http.HandlerFunc(app.readBookHandler)))
 
 	// --- Rutas de Admin ---
 	adminRouter := http.NewServeMux()
@@ -58,16 +110,22 @@ func main() {
 	adminRouter.HandleFunc("/admin/books/new", app.adminBookFormHandler)
 	adminRouter.HandleFunc("/admin/books/save", app.adminBookSaveHandler)
 	adminRouter.HandleFunc("/admin/books/delete", app.adminBookDeleteHandler)
+	adminRouter.HandleFunc("/admin/copies", app.adminCopiesHandler)
+	adminRouter.HandleFunc("/admin/copies/add", app.adminCopiesAddHandler)
+	adminRouter.HandleFunc("/admin/copies/retire", app.adminCopyRetireHandler)
+	adminRouter.HandleFunc("/admin/genres", app.adminGenresHandler)
+	adminRouter.HandleFunc("/admin/genres/save", app.adminGenreSaveHandler)
+	adminRouter.HandleFunc("/admin/genres/merge", app.adminGenreMergeHandler)
+	adminRouter.HandleFunc("/admin/reviews", app.adminReviewsHandler)
+	adminRouter.HandleFunc("/admin/reviews/moderate", app.adminReviewModerateHandler)
+	adminRouter.HandleFunc("/admin/inventory", app.adminInventoryHandler)
+	adminRouter.HandleFunc("/admin/inventory/reconcile", app.adminInventoryReconcileHandler)
 	adminRouter.HandleFunc("/admin/users/new", app.adminUserFormHandler)
 	adminRouter.HandleFunc("/admin/users/edit", app.adminUserFormHandler)
 	adminRouter.HandleFunc("/admin/users/save", app.adminUserSaveHandler)
 	adminRouter.HandleFunc("/admin/users/delete", app.adminUserDeleteHandler)
+	adminRouter.HandleFunc("/admin/locks/clear", app.adminLoginLockClearHandler)
 	mux.Handle("/admin/", app.requireAuthentication(app.requireAdmin(adminRouter)))
 
-	port := ":8080"
-	fmt.Printf("Servidor escuchando en http://localhost%s\n", port)
-	err = http.ListenAndServe(port, app.SessionManager.LoadAndSave(mux))
-	if err != nil {
-		log.Fatalf("No se pudo iniciar el servidor: %v", err)
-	}
+	return app.SessionManager.LoadAndSave(app.csrfProtect(mux))
 }
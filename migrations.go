@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles contiene los archivos NNNN_nombre.up.sql / NNNN_nombre.down.sql
+// embebidos en el binario, en un subdirectorio por dialecto (migrations/mysql,
+// migrations/sqlite...).
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration es una versión del esquema con su SQL de subida y de bajada.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus indica si una migración ya se aplicó y cuándo.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// loadMigrations lee las migraciones embebidas del dialecto ordenadas por versión.
+func loadMigrations(d *dialect) ([]Migration, error) {
+	dir := path.Join("migrations", d.name)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer las migraciones: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("nombre de migración inválido: %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error al leer la migración %s: %w", entry.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("la versión %d tiene nombres distintos: %s y %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(content)
+		} else {
+			mig.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("a la migración %04d_%s le falta el archivo up o down", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ensureMigrationsTable crea la tabla schema_migrations si no existe.
+func ensureMigrationsTable(db *sqlDB) error {
+	_, err := db.ExecContext(context.Background(), `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at `+db.dialect.timestampType+` NOT NULL
+		)`)
+	if err != nil {
+		return fmt.Errorf("error al crear la tabla schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations devuelve las versiones ya aplicadas y su fecha.
+func appliedMigrations(db *sqlDB) (map[int]time.Time, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(context.Background(), "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error al consultar schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// migrationStatus devuelve todas las migraciones conocidas indicando si están aplicadas.
+func migrationStatus(db *sqlDB) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(db.dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, mig := range migrations {
+		appliedAt, ok := applied[mig.Version]
+		status[i] = MigrationStatus{Migration: mig, Applied: ok, AppliedAt: appliedAt}
+	}
+	return status, nil
+}
+
+// migrateUp aplica en orden todas las migraciones pendientes y devuelve cuántas aplicó.
+func migrateUp(db *sqlDB) (int, error) {
+	status, err := migrationStatus(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, s := range status {
+		if s.Applied {
+			continue
+		}
+		log.Printf("Aplicando migración %04d_%s...", s.Version, s.Name)
+		if err := runMigration(db, s.Up, func(tx *sqlTx) error {
+			_, err := tx.ExecContext(context.Background(), "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", s.Version, s.Name, time.Now())
+			return err
+		}); err != nil {
+			return count, fmt.Errorf("error en la migración %04d_%s: %w", s.Version, s.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// migrateDown revierte las últimas migraciones aplicadas, como máximo steps.
+func migrateDown(db *sqlDB, steps int) (int, error) {
+	status, err := migrationStatus(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(status) - 1; i >= 0 && count < steps; i-- {
+		s := status[i]
+		if !s.Applied {
+			continue
+		}
+		log.Printf("Revirtiendo migración %04d_%s...", s.Version, s.Name)
+		if err := runMigration(db, s.Down, func(tx *sqlTx) error {
+			_, err := tx.ExecContext(context.Background(), "DELETE FROM schema_migrations WHERE version = ?", s.Version)
+			return err
+		}); err != nil {
+			return count, fmt.Errorf("error al revertir la migración %04d_%s: %w", s.Version, s.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// runMigration ejecuta cada sentencia del script y después record dentro de
+// una misma transacción. MySQL confirma implícitamente las sentencias DDL, por
+// lo que una migración fallida a medias puede requerir intervención manual;
+// PostgreSQL y SQLite la revierten por completo. Los scripts se envían tal cual,
+// sin traducir marcadores.
+func runMigration(db *sqlDB, script string, record func(tx *sqlTx) error) error {
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range splitSQLStatements(script) {
+		if _, err := tx.Tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%w\n%s", err, stmt)
+		}
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// splitSQLStatements separa un script en sentencias por ';', ignorando los
+// ';' dentro de comillas y los comentarios de línea "--".
+func splitSQLStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	var quote rune
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote != 0:
+			current.WriteRune(c)
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			current.WriteRune(c)
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			current.WriteRune('\n')
+		case c == ';':
+			if stmt := strings.TrimSpace(current.String()); stmt != "" {
+				statements = append(statements, stmt)
+			}
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+	if stmt := strings.TrimSpace(current.String()); stmt != "" {
+		statements = append(statements, stmt)
+	}
+	return statements
+}
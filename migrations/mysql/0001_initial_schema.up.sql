@@ -0,0 +1,42 @@
+-- Tablas base usadas por los handlers y por seedDatabase.
+-- IF NOT EXISTS permite adoptar bases de datos creadas a mano antes de las migraciones.
+CREATE TABLE IF NOT EXISTS users (
+    id INT NOT NULL AUTO_INCREMENT,
+    username VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'user',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_users_username (username)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS books (
+    id INT NOT NULL AUTO_INCREMENT,
+    title VARCHAR(255) NOT NULL,
+    author VARCHAR(255) NOT NULL,
+    genre VARCHAR(100) NOT NULL DEFAULT '',
+    stock INT NOT NULL DEFAULT 0,
+    description TEXT NOT NULL,
+    cover_image_path VARCHAR(255) NOT NULL DEFAULT '',
+    pdf_file_path VARCHAR(255) NOT NULL DEFAULT '',
+    release_date DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_books_release_date (release_date),
+    KEY idx_books_title (title)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS loans (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    book_id INT NOT NULL,
+    loan_date DATETIME NOT NULL,
+    return_date DATETIME NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    PRIMARY KEY (id),
+    KEY idx_loans_user_book_status (user_id, book_id, status),
+    KEY idx_loans_book (book_id),
+    CONSTRAINT fk_loans_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_loans_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
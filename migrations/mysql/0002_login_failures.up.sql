@@ -0,0 +1,10 @@
+-- Contadores de intentos de login fallidos por usuario y por IP
+CREATE TABLE IF NOT EXISTS login_failures (
+    scope VARCHAR(16) NOT NULL,
+    identifier VARCHAR(255) NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at DATETIME NOT NULL,
+    locked_until DATETIME NULL,
+    PRIMARY KEY (scope, identifier),
+    KEY idx_login_failures_locked_until (locked_until)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,2 @@
+DROP INDEX idx_loans_status_due_date ON loans;
+ALTER TABLE loans DROP COLUMN due_date;
@@ -0,0 +1,6 @@
+-- Fecha de vencimiento de cada préstamo. Los préstamos existentes reciben el
+-- periodo por defecto (14 días) contado desde su fecha de préstamo.
+ALTER TABLE loans ADD COLUMN due_date DATETIME NULL AFTER loan_date;
+UPDATE loans SET due_date = DATE_ADD(loan_date, INTERVAL 14 DAY);
+ALTER TABLE loans MODIFY due_date DATETIME NOT NULL;
+CREATE INDEX idx_loans_status_due_date ON loans (status, due_date);
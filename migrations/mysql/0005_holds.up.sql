@@ -0,0 +1,17 @@
+-- Cola de reservas (FIFO por libro). status: waiting (en cola), ready (copia
+-- apartada hasta expires_at), fulfilled, cancelled o expired.
+CREATE TABLE IF NOT EXISTS holds (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    book_id INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting',
+    created_at DATETIME NOT NULL,
+    ready_at DATETIME NULL,
+    expires_at DATETIME NULL,
+    PRIMARY KEY (id),
+    KEY idx_holds_book_status_created (book_id, status, created_at),
+    KEY idx_holds_user_status (user_id, status),
+    KEY idx_holds_status_expires (status, expires_at),
+    CONSTRAINT fk_holds_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_holds_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
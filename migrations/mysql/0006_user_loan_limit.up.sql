@@ -0,0 +1,2 @@
+-- Límite propio de préstamos activos del usuario; NULL usa el de su rol
+ALTER TABLE users ADD COLUMN max_active_loans INT NULL;
@@ -0,0 +1,15 @@
+-- Preventas de libros aún no publicados. status: pending, fulfilled (se
+-- convirtió en préstamo), queued (pasó a la cola de reservas) o cancelled.
+CREATE TABLE IF NOT EXISTS preorders (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    book_id INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at DATETIME NOT NULL,
+    processed_at DATETIME NULL,
+    PRIMARY KEY (id),
+    KEY idx_preorders_status_book (status, book_id, created_at),
+    KEY idx_preorders_user_status (user_id, status),
+    CONSTRAINT fk_preorders_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_preorders_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,7 @@
+DROP INDEX idx_books_isbn ON books;
+ALTER TABLE books
+    DROP COLUMN isbn,
+    DROP COLUMN publisher,
+    DROP COLUMN language,
+    DROP COLUMN page_count,
+    DROP COLUMN edition;
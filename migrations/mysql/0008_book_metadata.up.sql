@@ -0,0 +1,9 @@
+-- Metadatos editables desde el panel de administración. El ISBN se guarda
+-- normalizado (solo dígitos y la X final del ISBN-10); page_count 0 es desconocido.
+ALTER TABLE books
+    ADD COLUMN isbn VARCHAR(13) NOT NULL DEFAULT '' AFTER author,
+    ADD COLUMN publisher VARCHAR(255) NOT NULL DEFAULT '' AFTER isbn,
+    ADD COLUMN language VARCHAR(50) NOT NULL DEFAULT '' AFTER publisher,
+    ADD COLUMN page_count INT NOT NULL DEFAULT 0 AFTER language,
+    ADD COLUMN edition VARCHAR(100) NOT NULL DEFAULT '' AFTER page_count;
+CREATE INDEX idx_books_isbn ON books (isbn);
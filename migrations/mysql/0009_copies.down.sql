@@ -0,0 +1,5 @@
+ALTER TABLE books ADD COLUMN stock INT NOT NULL DEFAULT 0 AFTER genre;
+UPDATE books SET stock = (SELECT COUNT(*) FROM copies c WHERE c.book_id = books.id AND c.status = 'available');
+ALTER TABLE holds DROP FOREIGN KEY fk_holds_copy, DROP COLUMN copy_id;
+ALTER TABLE loans DROP FOREIGN KEY fk_loans_copy, DROP COLUMN copy_id;
+DROP TABLE IF EXISTS copies;
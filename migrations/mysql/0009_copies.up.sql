@@ -0,0 +1,53 @@
+-- Cada unidad prestable de un libro: una copia propia o una licencia de la
+-- editorial. licence_loans_remaining NULL significa préstamos ilimitados y
+-- licence_expires_at NULL que la licencia no caduca. status es available,
+-- loaned, reserved (apartada para una reserva) o retired.
+CREATE TABLE IF NOT EXISTS copies (
+    id INT NOT NULL AUTO_INCREMENT,
+    book_id INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'available',
+    acquired_at DATETIME NOT NULL,
+    licence_loans_remaining INT NULL,
+    licence_expires_at DATETIME NULL,
+    retired_at DATETIME NULL,
+    source_loan_id INT NULL,
+    source_hold_id INT NULL,
+    PRIMARY KEY (id),
+    KEY idx_copies_book_status (book_id, status),
+    KEY idx_copies_status_licence_expires (status, licence_expires_at),
+    CONSTRAINT fk_copies_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+ALTER TABLE loans
+    ADD COLUMN copy_id INT NULL AFTER book_id,
+    ADD CONSTRAINT fk_loans_copy FOREIGN KEY (copy_id) REFERENCES copies (id) ON DELETE SET NULL;
+ALTER TABLE holds
+    ADD COLUMN copy_id INT NULL AFTER book_id,
+    ADD CONSTRAINT fk_holds_copy FOREIGN KEY (copy_id) REFERENCES copies (id) ON DELETE SET NULL;
+
+-- Una copia por préstamo activo y por reserva apartada, enlazada a ellos
+INSERT INTO copies (book_id, status, acquired_at, source_loan_id)
+    SELECT book_id, 'loaned', loan_date, id FROM loans WHERE status = 'active';
+UPDATE loans SET copy_id = (SELECT c.id FROM copies c WHERE c.source_loan_id = loans.id) WHERE status = 'active';
+INSERT INTO copies (book_id, status, acquired_at, source_hold_id)
+    SELECT book_id, 'reserved', ready_at, id FROM holds WHERE status = 'ready';
+UPDATE holds SET copy_id = (SELECT c.id FROM copies c WHERE c.source_hold_id = holds.id) WHERE status = 'ready';
+
+-- Y una copia disponible por cada unidad de stock. Sin CTE recursiva, cuyo
+-- límite de recursión solo se puede subir en MySQL 8: los números salen de
+-- cruzar cinco tablas de dígitos, lo que cubre hasta 100000 unidades por libro
+CREATE TEMPORARY TABLE copies_seq (n INT NOT NULL PRIMARY KEY);
+INSERT INTO copies_seq (n)
+    SELECT 1 + d0.d + 10 * d1.d + 100 * d2.d + 1000 * d3.d + 10000 * d4.d
+    FROM (SELECT 0 AS d UNION ALL SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4 UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7 UNION ALL SELECT 8 UNION ALL SELECT 9) d0
+    CROSS JOIN (SELECT 0 AS d UNION ALL SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4 UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7 UNION ALL SELECT 8 UNION ALL SELECT 9) d1
+    CROSS JOIN (SELECT 0 AS d UNION ALL SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4 UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7 UNION ALL SELECT 8 UNION ALL SELECT 9) d2
+    CROSS JOIN (SELECT 0 AS d UNION ALL SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4 UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7 UNION ALL SELECT 8 UNION ALL SELECT 9) d3
+    CROSS JOIN (SELECT 0 AS d UNION ALL SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4 UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7 UNION ALL SELECT 8 UNION ALL SELECT 9) d4;
+INSERT INTO copies (book_id, status, acquired_at)
+    SELECT b.id, 'available', UTC_TIMESTAMP() FROM books b JOIN copies_seq seq ON seq.n <= b.stock;
+DROP TEMPORARY TABLE copies_seq;
+
+ALTER TABLE copies DROP COLUMN source_loan_id, DROP COLUMN source_hold_id;
+-- El stock pasa a calcularse a partir de las copias disponibles
+ALTER TABLE books DROP COLUMN stock;
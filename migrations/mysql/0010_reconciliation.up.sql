@@ -0,0 +1,26 @@
+-- Historial de conciliaciones de inventario (comando, tarea programada o
+-- panel de administración) y las discrepancias encontradas en cada una.
+CREATE TABLE IF NOT EXISTS reconciliation_runs (
+    id INT NOT NULL AUTO_INCREMENT,
+    source VARCHAR(20) NOT NULL,
+    fix TINYINT(1) NOT NULL DEFAULT 0,
+    started_at DATETIME NOT NULL,
+    books_checked INT NOT NULL DEFAULT 0,
+    issues_found INT NOT NULL DEFAULT 0,
+    issues_fixed INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (id),
+    KEY idx_reconciliation_runs_started_at (started_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS reconciliation_issues (
+    id INT NOT NULL AUTO_INCREMENT,
+    run_id INT NOT NULL,
+    book_id INT NOT NULL,
+    book_title VARCHAR(255) NOT NULL,
+    kind VARCHAR(50) NOT NULL,
+    description VARCHAR(500) NOT NULL,
+    fixed TINYINT(1) NOT NULL DEFAULT 0,
+    PRIMARY KEY (id),
+    KEY idx_reconciliation_issues_run (run_id),
+    CONSTRAINT fk_reconciliation_issues_run FOREIGN KEY (run_id) REFERENCES reconciliation_runs (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
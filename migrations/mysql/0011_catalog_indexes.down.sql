@@ -0,0 +1,2 @@
+DROP INDEX idx_books_author_title ON books;
+DROP INDEX idx_books_genre ON books;
@@ -0,0 +1,3 @@
+-- Índices para los filtros y la ordenación del catálogo.
+CREATE INDEX idx_books_genre ON books (genre);
+CREATE INDEX idx_books_author_title ON books (author, title);
@@ -0,0 +1,30 @@
+-- Autores como entidades, enlazados con los libros (N:M). books.author se
+-- mantiene con los nombres unidos por comas para ordenar, mostrar y buscar.
+CREATE TABLE IF NOT EXISTS authors (
+    id INT NOT NULL AUTO_INCREMENT,
+    name VARCHAR(255) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_authors_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS book_authors (
+    book_id INT NOT NULL,
+    author_id INT NOT NULL,
+    author_order INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, author_id),
+    KEY idx_book_authors_author (author_id),
+    CONSTRAINT fk_book_authors_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    CONSTRAINT fk_book_authors_author FOREIGN KEY (author_id) REFERENCES authors (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Un autor por cada nombre distinto, sin espacios sobrantes ni distinguir
+-- mayúsculas (ni acentos, por la intercalación)
+INSERT INTO authors (name)
+SELECT MIN(TRIM(author)) FROM books WHERE TRIM(author) <> '' GROUP BY LOWER(TRIM(author));
+
+INSERT INTO book_authors (book_id, author_id, author_order)
+SELECT b.id, a.id, 0 FROM books b JOIN authors a ON LOWER(a.name) = LOWER(TRIM(b.author));
+
+UPDATE books SET author = (
+    SELECT a.name FROM book_authors ba JOIN authors a ON a.id = ba.author_id WHERE ba.book_id = books.id
+) WHERE id IN (SELECT book_id FROM book_authors);
@@ -0,0 +1,6 @@
+ALTER TABLE books DROP FOREIGN KEY fk_books_series;
+DROP INDEX uq_books_series_volume ON books;
+ALTER TABLE books
+    DROP COLUMN series_id,
+    DROP COLUMN series_volume;
+DROP TABLE IF EXISTS series;
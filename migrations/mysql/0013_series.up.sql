@@ -0,0 +1,13 @@
+-- Series de libros: cada libro puede ser un volumen numerado de una serie.
+CREATE TABLE IF NOT EXISTS series (
+    id INT NOT NULL AUTO_INCREMENT,
+    name VARCHAR(255) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_series_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+ALTER TABLE books
+    ADD COLUMN series_id INT NULL AFTER edition,
+    ADD COLUMN series_volume INT NULL AFTER series_id,
+    ADD CONSTRAINT fk_books_series FOREIGN KEY (series_id) REFERENCES series (id) ON DELETE SET NULL;
+CREATE UNIQUE INDEX uq_books_series_volume ON books (series_id, series_volume);
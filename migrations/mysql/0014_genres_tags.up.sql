@@ -0,0 +1,50 @@
+-- Géneros normalizados en dos niveles (Terror > Gótico), varios por libro, y
+-- etiquetas libres. books.genre se mantiene con los géneros unidos por comas
+-- para mostrar y buscar.
+CREATE TABLE IF NOT EXISTS genres (
+    id INT NOT NULL AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    parent_id INT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_genres_name (name),
+    KEY idx_genres_parent (parent_id),
+    CONSTRAINT fk_genres_parent FOREIGN KEY (parent_id) REFERENCES genres (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS book_genres (
+    book_id INT NOT NULL,
+    genre_id INT NOT NULL,
+    genre_order INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, genre_id),
+    KEY idx_book_genres_genre (genre_id),
+    CONSTRAINT fk_book_genres_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    CONSTRAINT fk_book_genres_genre FOREIGN KEY (genre_id) REFERENCES genres (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS tags (
+    id INT NOT NULL AUTO_INCREMENT,
+    name VARCHAR(50) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_tags_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS book_tags (
+    book_id INT NOT NULL,
+    tag_id INT NOT NULL,
+    PRIMARY KEY (book_id, tag_id),
+    KEY idx_book_tags_tag (tag_id),
+    CONSTRAINT fk_book_tags_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    CONSTRAINT fk_book_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE RESTRICT
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Un género principal por cada valor distinto, sin espacios sobrantes ni
+-- distinguir mayúsculas (ni acentos, por la intercalación)
+INSERT INTO genres (name)
+SELECT MIN(TRIM(genre)) FROM books WHERE TRIM(genre) <> '' GROUP BY LOWER(TRIM(genre));
+
+INSERT INTO book_genres (book_id, genre_id, genre_order)
+SELECT b.id, g.id, 0 FROM books b JOIN genres g ON LOWER(g.name) = LOWER(TRIM(b.genre));
+
+UPDATE books SET genre = (
+    SELECT g.name FROM book_genres bg JOIN genres g ON g.id = bg.genre_id WHERE bg.book_id = books.id
+) WHERE id IN (SELECT book_id FROM book_genres);
@@ -0,0 +1,21 @@
+-- Valoraciones (1 a 5 estrellas) y reseñas de los libros, una por usuario y
+-- libro. Solo las aprobadas por un administrador se muestran y cuentan en la
+-- valoración media.
+CREATE TABLE IF NOT EXISTS reviews (
+    id INT NOT NULL AUTO_INCREMENT,
+    book_id INT NOT NULL,
+    user_id INT NOT NULL,
+    rating INT NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    moderated_at DATETIME NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_reviews_book_user (book_id, user_id),
+    KEY idx_reviews_book_status (book_id, status),
+    KEY idx_reviews_status (status, updated_at),
+    CONSTRAINT chk_reviews_rating CHECK (rating BETWEEN 1 AND 5),
+    CONSTRAINT fk_reviews_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    CONSTRAINT fk_reviews_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,41 @@
+-- Tablas base usadas por los handlers y por seedDatabase.
+-- CITEXT replica la comparación sin mayúsculas de utf8mb4_unicode_ci (también en LIKE).
+CREATE EXTENSION IF NOT EXISTS citext;
+
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    username CITEXT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'user',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_users_username UNIQUE (username)
+);
+
+CREATE TABLE IF NOT EXISTS books (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    title CITEXT NOT NULL,
+    author CITEXT NOT NULL,
+    genre VARCHAR(100) NOT NULL DEFAULT '',
+    stock INTEGER NOT NULL DEFAULT 0,
+    description TEXT NOT NULL,
+    cover_image_path VARCHAR(255) NOT NULL DEFAULT '',
+    pdf_file_path VARCHAR(255) NOT NULL DEFAULT '',
+    release_date TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_books_release_date ON books (release_date);
+CREATE INDEX IF NOT EXISTS idx_books_title ON books (title);
+
+CREATE TABLE IF NOT EXISTS loans (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    book_id INTEGER NOT NULL,
+    loan_date TIMESTAMPTZ NOT NULL,
+    return_date TIMESTAMPTZ NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    CONSTRAINT fk_loans_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_loans_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_loans_user_book_status ON loans (user_id, book_id, status);
+CREATE INDEX IF NOT EXISTS idx_loans_book ON loans (book_id);
@@ -0,0 +1,10 @@
+-- Contadores de intentos de login fallidos por usuario y por IP
+CREATE TABLE IF NOT EXISTS login_failures (
+    scope VARCHAR(16) NOT NULL,
+    identifier VARCHAR(255) NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ NULL,
+    PRIMARY KEY (scope, identifier)
+);
+CREATE INDEX IF NOT EXISTS idx_login_failures_locked_until ON login_failures (locked_until);
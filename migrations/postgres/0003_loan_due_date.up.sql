@@ -0,0 +1,6 @@
+-- Fecha de vencimiento de cada préstamo. Los préstamos existentes reciben el
+-- periodo por defecto (14 días) contado desde su fecha de préstamo.
+ALTER TABLE loans ADD COLUMN due_date TIMESTAMPTZ NULL;
+UPDATE loans SET due_date = loan_date + INTERVAL '14 days';
+ALTER TABLE loans ALTER COLUMN due_date SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_loans_status_due_date ON loans (status, due_date);
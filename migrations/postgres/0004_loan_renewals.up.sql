@@ -0,0 +1,2 @@
+-- Número de veces que se ha renovado cada préstamo
+ALTER TABLE loans ADD COLUMN renewal_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+-- Cola de reservas (FIFO por libro). status: waiting (en cola), ready (copia
+-- apartada hasta expires_at), fulfilled, cancelled o expired.
+CREATE TABLE IF NOT EXISTS holds (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    book_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting',
+    created_at TIMESTAMPTZ NOT NULL,
+    ready_at TIMESTAMPTZ NULL,
+    expires_at TIMESTAMPTZ NULL,
+    CONSTRAINT fk_holds_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_holds_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_holds_book_status_created ON holds (book_id, status, created_at);
+CREATE INDEX IF NOT EXISTS idx_holds_user_status ON holds (user_id, status);
+CREATE INDEX IF NOT EXISTS idx_holds_status_expires ON holds (status, expires_at);
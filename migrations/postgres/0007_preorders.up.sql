@@ -0,0 +1,14 @@
+-- Preventas de libros aún no publicados. status: pending, fulfilled (se
+-- convirtió en préstamo), queued (pasó a la cola de reservas) o cancelled.
+CREATE TABLE IF NOT EXISTS preorders (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    book_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL,
+    processed_at TIMESTAMPTZ NULL,
+    CONSTRAINT fk_preorders_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_preorders_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_preorders_status_book ON preorders (status, book_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_preorders_user_status ON preorders (user_id, status);
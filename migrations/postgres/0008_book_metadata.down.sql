@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_books_isbn;
+ALTER TABLE books
+    DROP COLUMN isbn,
+    DROP COLUMN publisher,
+    DROP COLUMN language,
+    DROP COLUMN page_count,
+    DROP COLUMN edition;
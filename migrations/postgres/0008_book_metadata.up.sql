@@ -0,0 +1,9 @@
+-- Metadatos editables desde el panel de administración. El ISBN se guarda
+-- normalizado (solo dígitos y la X final del ISBN-10); page_count 0 es desconocido.
+ALTER TABLE books
+    ADD COLUMN isbn VARCHAR(13) NOT NULL DEFAULT '',
+    ADD COLUMN publisher VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN language VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN page_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN edition VARCHAR(100) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_books_isbn ON books (isbn);
@@ -0,0 +1,36 @@
+-- Cada unidad prestable de un libro: una copia propia o una licencia de la
+-- editorial. licence_loans_remaining NULL significa préstamos ilimitados y
+-- licence_expires_at NULL que la licencia no caduca. status es available,
+-- loaned, reserved (apartada para una reserva) o retired.
+CREATE TABLE IF NOT EXISTS copies (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'available',
+    acquired_at TIMESTAMPTZ NOT NULL,
+    licence_loans_remaining INTEGER NULL,
+    licence_expires_at TIMESTAMPTZ NULL,
+    retired_at TIMESTAMPTZ NULL,
+    source_loan_id INTEGER NULL,
+    source_hold_id INTEGER NULL
+);
+CREATE INDEX IF NOT EXISTS idx_copies_book_status ON copies (book_id, status);
+CREATE INDEX IF NOT EXISTS idx_copies_status_licence_expires ON copies (status, licence_expires_at);
+
+ALTER TABLE loans ADD COLUMN copy_id INTEGER NULL REFERENCES copies (id) ON DELETE SET NULL;
+ALTER TABLE holds ADD COLUMN copy_id INTEGER NULL REFERENCES copies (id) ON DELETE SET NULL;
+
+-- Una copia por préstamo activo y por reserva apartada, enlazada a ellos
+INSERT INTO copies (book_id, status, acquired_at, source_loan_id)
+    SELECT book_id, 'loaned', loan_date, id FROM loans WHERE status = 'active';
+UPDATE loans SET copy_id = (SELECT c.id FROM copies c WHERE c.source_loan_id = loans.id) WHERE status = 'active';
+INSERT INTO copies (book_id, status, acquired_at, source_hold_id)
+    SELECT book_id, 'reserved', ready_at, id FROM holds WHERE status = 'ready';
+UPDATE holds SET copy_id = (SELECT c.id FROM copies c WHERE c.source_hold_id = holds.id) WHERE status = 'ready';
+
+-- Y una copia disponible por cada unidad de stock
+INSERT INTO copies (book_id, status, acquired_at)
+    SELECT b.id, 'available', CURRENT_TIMESTAMP FROM books b CROSS JOIN generate_series(1, b.stock) AS seq (n);
+
+ALTER TABLE copies DROP COLUMN source_loan_id, DROP COLUMN source_hold_id;
+-- El stock pasa a calcularse a partir de las copias disponibles
+ALTER TABLE books DROP COLUMN stock;
@@ -0,0 +1,23 @@
+-- Historial de conciliaciones de inventario (comando, tarea programada o
+-- panel de administración) y las discrepancias encontradas en cada una.
+CREATE TABLE IF NOT EXISTS reconciliation_runs (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    source VARCHAR(20) NOT NULL,
+    fix BOOLEAN NOT NULL DEFAULT FALSE,
+    started_at TIMESTAMPTZ NOT NULL,
+    books_checked INTEGER NOT NULL DEFAULT 0,
+    issues_found INTEGER NOT NULL DEFAULT 0,
+    issues_fixed INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_reconciliation_runs_started_at ON reconciliation_runs (started_at);
+
+CREATE TABLE IF NOT EXISTS reconciliation_issues (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    run_id INTEGER NOT NULL REFERENCES reconciliation_runs (id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL,
+    book_title VARCHAR(255) NOT NULL,
+    kind VARCHAR(50) NOT NULL,
+    description VARCHAR(500) NOT NULL,
+    fixed BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS idx_reconciliation_issues_run ON reconciliation_issues (run_id);
@@ -0,0 +1,28 @@
+-- Autores como entidades, enlazados con los libros (N:M). books.author se
+-- mantiene con los nombres unidos por comas para ordenar, mostrar y buscar.
+CREATE TABLE IF NOT EXISTS authors (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name CITEXT NOT NULL,
+    CONSTRAINT uq_authors_name UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS book_authors (
+    book_id INTEGER NOT NULL,
+    author_id INTEGER NOT NULL,
+    author_order INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, author_id),
+    CONSTRAINT fk_book_authors_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    CONSTRAINT fk_book_authors_author FOREIGN KEY (author_id) REFERENCES authors (id) ON DELETE RESTRICT
+);
+CREATE INDEX IF NOT EXISTS idx_book_authors_author ON book_authors (author_id);
+
+-- Un autor por cada nombre distinto, sin espacios sobrantes ni distinguir mayúsculas
+INSERT INTO authors (name)
+SELECT MIN(TRIM(author::text)) FROM books WHERE TRIM(author::text) <> '' GROUP BY LOWER(TRIM(author::text));
+
+INSERT INTO book_authors (book_id, author_id, author_order)
+SELECT b.id, a.id, 0 FROM books b JOIN authors a ON LOWER(a.name::text) = LOWER(TRIM(b.author::text));
+
+UPDATE books SET author = (
+    SELECT a.name FROM book_authors ba JOIN authors a ON a.id = ba.author_id WHERE ba.book_id = books.id
+) WHERE id IN (SELECT book_id FROM book_authors);
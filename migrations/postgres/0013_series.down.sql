@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS uq_books_series_volume;
+ALTER TABLE books
+    DROP COLUMN series_id,
+    DROP COLUMN series_volume;
+DROP TABLE IF EXISTS series;
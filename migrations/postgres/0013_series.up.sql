@@ -0,0 +1,12 @@
+-- Series de libros: cada libro puede ser un volumen numerado de una serie.
+CREATE TABLE IF NOT EXISTS series (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name CITEXT NOT NULL,
+    CONSTRAINT uq_series_name UNIQUE (name)
+);
+
+ALTER TABLE books
+    ADD COLUMN series_id INTEGER NULL,
+    ADD COLUMN series_volume INTEGER NULL,
+    ADD CONSTRAINT fk_books_series FOREIGN KEY (series_id) REFERENCES series (id) ON DELETE SET NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_books_series_volume ON books (series_id, series_volume);
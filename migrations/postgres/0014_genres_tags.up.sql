@@ -0,0 +1,47 @@
+-- Géneros normalizados en dos niveles (Terror > Gótico), varios por libro, y
+-- etiquetas libres. books.genre se mantiene con los géneros unidos por comas
+-- para mostrar y buscar.
+CREATE TABLE IF NOT EXISTS genres (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name CITEXT NOT NULL,
+    parent_id INTEGER NULL,
+    CONSTRAINT uq_genres_name UNIQUE (name),
+    CONSTRAINT fk_genres_parent FOREIGN KEY (parent_id) REFERENCES genres (id) ON DELETE RESTRICT
+);
+CREATE INDEX IF NOT EXISTS idx_genres_parent ON genres (parent_id);
+
+CREATE TABLE IF NOT EXISTS book_genres (
+    book_id INTEGER NOT NULL,
+    genre_id INTEGER NOT NULL,
+    genre_order INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, genre_id),
+    CONSTRAINT fk_book_genres_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    CONSTRAINT fk_book_genres_genre FOREIGN KEY (genre_id) REFERENCES genres (id) ON DELETE RESTRICT
+);
+CREATE INDEX IF NOT EXISTS idx_book_genres_genre ON book_genres (genre_id);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name CITEXT NOT NULL,
+    CONSTRAINT uq_tags_name UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS book_tags (
+    book_id INTEGER NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (book_id, tag_id),
+    CONSTRAINT fk_book_tags_book FOREIGN KEY (book_id) REFERENCES books (id) ON DELETE CASCADE,
+    CONSTRAINT fk_book_tags_tag FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE RESTRICT
+);
+CREATE INDEX IF NOT EXISTS idx_book_tags_tag ON book_tags (tag_id);
+
+-- Un género principal por cada valor distinto, sin espacios sobrantes ni distinguir mayúsculas
+INSERT INTO genres (name)
+SELECT MIN(TRIM(genre::text)) FROM books WHERE TRIM(genre::text) <> '' GROUP BY LOWER(TRIM(genre::text));
+
+INSERT INTO book_genres (book_id, genre_id, genre_order)
+SELECT b.id, g.id, 0 FROM books b JOIN genres g ON LOWER(g.name::text) = LOWER(TRIM(b.genre::text));
+
+UPDATE books SET genre = (
+    SELECT g.name FROM book_genres bg JOIN genres g ON g.id = bg.genre_id WHERE bg.book_id = books.id
+) WHERE id IN (SELECT book_id FROM book_genres);
@@ -0,0 +1,18 @@
+-- Valoraciones (1 a 5 estrellas) y reseñas de los libros, una por usuario y
+-- libro. Solo las aprobadas por un administrador se muestran y cuentan en la
+-- valoración media.
+CREATE TABLE IF NOT EXISTS reviews (
+    id INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    rating INTEGER NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    moderated_at TIMESTAMPTZ NULL,
+    CONSTRAINT uq_reviews_book_user UNIQUE (book_id, user_id),
+    CONSTRAINT chk_reviews_rating CHECK (rating BETWEEN 1 AND 5)
+);
+CREATE INDEX IF NOT EXISTS idx_reviews_book_status ON reviews (book_id, status);
+CREATE INDEX IF NOT EXISTS idx_reviews_status ON reviews (status, updated_at);
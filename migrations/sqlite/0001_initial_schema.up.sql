@@ -0,0 +1,36 @@
+-- Tablas base usadas por los handlers y por seedDatabase.
+-- COLLATE NOCASE replica la comparación sin mayúsculas de utf8mb4_unicode_ci.
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL COLLATE NOCASE UNIQUE,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    password TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'user',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS books (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL COLLATE NOCASE,
+    author TEXT NOT NULL COLLATE NOCASE,
+    genre TEXT NOT NULL DEFAULT '',
+    stock INTEGER NOT NULL DEFAULT 0,
+    description TEXT NOT NULL,
+    cover_image_path TEXT NOT NULL DEFAULT '',
+    pdf_file_path TEXT NOT NULL DEFAULT '',
+    release_date DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_books_release_date ON books (release_date);
+CREATE INDEX IF NOT EXISTS idx_books_title ON books (title);
+
+CREATE TABLE IF NOT EXISTS loans (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    loan_date DATETIME NOT NULL,
+    return_date DATETIME NULL,
+    status TEXT NOT NULL DEFAULT 'active'
+);
+CREATE INDEX IF NOT EXISTS idx_loans_user_book_status ON loans (user_id, book_id, status);
+CREATE INDEX IF NOT EXISTS idx_loans_book ON loans (book_id);
@@ -0,0 +1,10 @@
+-- Contadores de intentos de login fallidos por usuario y por IP
+CREATE TABLE IF NOT EXISTS login_failures (
+    scope TEXT NOT NULL,
+    identifier TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at DATETIME NOT NULL,
+    locked_until DATETIME NULL,
+    PRIMARY KEY (scope, identifier)
+);
+CREATE INDEX IF NOT EXISTS idx_login_failures_locked_until ON login_failures (locked_until);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_loans_status_due_date;
+ALTER TABLE loans DROP COLUMN due_date;
@@ -0,0 +1,7 @@
+-- Fecha de vencimiento de cada préstamo. Los préstamos existentes reciben el
+-- periodo por defecto (14 días) contado desde su fecha de préstamo.
+-- SQLite exige un valor por defecto para añadir una columna NOT NULL. substr
+-- toma solo "AAAA-MM-DD HH:MM:SS" para admitir cualquier formato de fecha guardado.
+ALTER TABLE loans ADD COLUMN due_date DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE loans SET due_date = datetime(substr(loan_date, 1, 19), '+14 days');
+CREATE INDEX IF NOT EXISTS idx_loans_status_due_date ON loans (status, due_date);
@@ -0,0 +1,14 @@
+-- Cola de reservas (FIFO por libro). status: waiting (en cola), ready (copia
+-- apartada hasta expires_at), fulfilled, cancelled o expired.
+CREATE TABLE IF NOT EXISTS holds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'waiting',
+    created_at DATETIME NOT NULL,
+    ready_at DATETIME NULL,
+    expires_at DATETIME NULL
+);
+CREATE INDEX IF NOT EXISTS idx_holds_book_status_created ON holds (book_id, status, created_at);
+CREATE INDEX IF NOT EXISTS idx_holds_user_status ON holds (user_id, status);
+CREATE INDEX IF NOT EXISTS idx_holds_status_expires ON holds (status, expires_at);
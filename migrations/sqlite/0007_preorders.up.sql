@@ -0,0 +1,12 @@
+-- Preventas de libros aún no publicados. status: pending, fulfilled (se
+-- convirtió en préstamo), queued (pasó a la cola de reservas) o cancelled.
+CREATE TABLE IF NOT EXISTS preorders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at DATETIME NOT NULL,
+    processed_at DATETIME NULL
+);
+CREATE INDEX IF NOT EXISTS idx_preorders_status_book ON preorders (status, book_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_preorders_user_status ON preorders (user_id, status);
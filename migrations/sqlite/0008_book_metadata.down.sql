@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_books_isbn;
+ALTER TABLE books DROP COLUMN isbn;
+ALTER TABLE books DROP COLUMN publisher;
+ALTER TABLE books DROP COLUMN language;
+ALTER TABLE books DROP COLUMN page_count;
+ALTER TABLE books DROP COLUMN edition;
@@ -0,0 +1,8 @@
+-- Metadatos editables desde el panel de administración. El ISBN se guarda
+-- normalizado (solo dígitos y la X final del ISBN-10); page_count 0 es desconocido.
+ALTER TABLE books ADD COLUMN isbn TEXT NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN publisher TEXT NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN language TEXT NOT NULL DEFAULT '';
+ALTER TABLE books ADD COLUMN page_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE books ADD COLUMN edition TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_books_isbn ON books (isbn);
@@ -0,0 +1,5 @@
+ALTER TABLE books ADD COLUMN stock INTEGER NOT NULL DEFAULT 0;
+UPDATE books SET stock = (SELECT COUNT(*) FROM copies c WHERE c.book_id = books.id AND c.status = 'available');
+ALTER TABLE holds DROP COLUMN copy_id;
+ALTER TABLE loans DROP COLUMN copy_id;
+DROP TABLE IF EXISTS copies;
@@ -0,0 +1,23 @@
+-- Historial de conciliaciones de inventario (comando, tarea programada o
+-- panel de administración) y las discrepancias encontradas en cada una.
+CREATE TABLE IF NOT EXISTS reconciliation_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    source TEXT NOT NULL,
+    fix INTEGER NOT NULL DEFAULT 0,
+    started_at DATETIME NOT NULL,
+    books_checked INTEGER NOT NULL DEFAULT 0,
+    issues_found INTEGER NOT NULL DEFAULT 0,
+    issues_fixed INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_reconciliation_runs_started_at ON reconciliation_runs (started_at);
+
+CREATE TABLE IF NOT EXISTS reconciliation_issues (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL REFERENCES reconciliation_runs (id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL,
+    book_title TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    description TEXT NOT NULL,
+    fixed INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_reconciliation_issues_run ON reconciliation_issues (run_id);
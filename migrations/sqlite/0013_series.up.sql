@@ -0,0 +1,10 @@
+-- Series de libros: cada libro puede ser un volumen numerado de una serie.
+CREATE TABLE IF NOT EXISTS series (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL COLLATE NOCASE UNIQUE
+);
+
+-- Sin REFERENCES: SQLite no permite eliminar columnas con clave foránea en el down
+ALTER TABLE books ADD COLUMN series_id INTEGER NULL;
+ALTER TABLE books ADD COLUMN series_volume INTEGER NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_books_series_volume ON books (series_id, series_volume);
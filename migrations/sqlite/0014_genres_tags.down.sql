@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS book_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS book_genres;
+-- SQLite vacía la tabla antes de eliminarla y comprobaría parent_id fila a fila
+UPDATE genres SET parent_id = NULL;
+DROP TABLE IF EXISTS genres;
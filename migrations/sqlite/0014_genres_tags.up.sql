@@ -0,0 +1,40 @@
+-- Géneros normalizados en dos niveles (Terror > Gótico), varios por libro, y
+-- etiquetas libres. books.genre se mantiene con los géneros unidos por comas
+-- para mostrar y buscar.
+CREATE TABLE IF NOT EXISTS genres (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL COLLATE NOCASE UNIQUE,
+    parent_id INTEGER REFERENCES genres (id) ON DELETE RESTRICT
+);
+CREATE INDEX IF NOT EXISTS idx_genres_parent ON genres (parent_id);
+
+CREATE TABLE IF NOT EXISTS book_genres (
+    book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    genre_id INTEGER NOT NULL REFERENCES genres (id) ON DELETE RESTRICT,
+    genre_order INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, genre_id)
+);
+CREATE INDEX IF NOT EXISTS idx_book_genres_genre ON book_genres (genre_id);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL COLLATE NOCASE UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS book_tags (
+    book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE RESTRICT,
+    PRIMARY KEY (book_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS idx_book_tags_tag ON book_tags (tag_id);
+
+-- Un género principal por cada valor distinto, sin espacios sobrantes ni distinguir mayúsculas
+INSERT INTO genres (name)
+SELECT MIN(TRIM(genre)) FROM books WHERE TRIM(genre) <> '' GROUP BY LOWER(TRIM(genre));
+
+INSERT INTO book_genres (book_id, genre_id, genre_order)
+SELECT b.id, g.id, 0 FROM books b JOIN genres g ON LOWER(g.name) = LOWER(TRIM(b.genre));
+
+UPDATE books SET genre = (
+    SELECT g.name FROM book_genres bg JOIN genres g ON g.id = bg.genre_id WHERE bg.book_id = books.id
+) WHERE id IN (SELECT book_id FROM book_genres);
@@ -0,0 +1,17 @@
+-- Valoraciones (1 a 5 estrellas) y reseñas de los libros, una por usuario y
+-- libro. Solo las aprobadas por un administrador se muestran y cuentan en la
+-- valoración media.
+CREATE TABLE IF NOT EXISTS reviews (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    rating INTEGER NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    body TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    moderated_at DATETIME NULL,
+    UNIQUE (book_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_reviews_book_status ON reviews (book_id, status);
+CREATE INDEX IF NOT EXISTS idx_reviews_status ON reviews (status, updated_at);
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"vacío", "", nil},
+		{"solo comentarios", "-- nada que hacer;\n", nil},
+		{"varias sentencias", "CREATE TABLE a (id INT);\nDROP TABLE b;", []string{"CREATE TABLE a (id INT)", "DROP TABLE b"}},
+		{"última sin punto y coma", "SELECT 1;\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"punto y coma entre comillas simples", "INSERT INTO t VALUES ('a;b');", []string{"INSERT INTO t VALUES ('a;b')"}},
+		{"punto y coma entre comillas dobles", `SELECT "x;y" FROM t;`, []string{`SELECT "x;y" FROM t`}},
+		{"punto y coma entre comillas invertidas", "SELECT `a;b` FROM t;", []string{"SELECT `a;b` FROM t"}},
+		{"comentario de línea con punto y coma", "-- paso 1; paso 2\nSELECT 1;", []string{"SELECT 1"}},
+		{"comentario al final de una línea", "SELECT 1 -- uno;\n, 2;", []string{"SELECT 1 \n, 2"}},
+		{"guiones dentro de comillas", "SELECT '--;';", []string{"SELECT '--;'"}},
+		{"sentencias vacías", ";;SELECT 1;;", []string{"SELECT 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitSQLStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSQLStatements(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
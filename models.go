@@ -13,29 +13,275 @@ type User struct {
 	Password  string
 	Role      string
 	CreatedAt time.Time
+	// MaxActiveLoans sustituye al límite de préstamos activos del rol si es válido
+	MaxActiveLoans sql.NullInt64
 }
 
 type Book struct {
-	ID             int
-	Title          string
-	Author         string
-	Genre          string
-	Stock          int
+	ID    int
+	Title string
+	// Author son los nombres de Authors unidos por comas. Lo mantiene el store
+	// para ordenar, mostrar y buscar sin consultar los autores
+	Author       string
+	Authors      []Author // En orden; solo lo rellenan Get y el formulario
+	ISBN         string   // ISBN-10 o ISBN-13 normalizado, sin guiones; vacío si no se conoce
+	Publisher    string
+	Language     string
+	PageCount    int // 0 si no se conoce
+	Edition      string
+	SeriesID     int // 0 si no pertenece a ninguna serie
+	SeriesName   string
+	SeriesVolume int // Número de volumen dentro de la serie
+	// SeriesCount es el número de volúmenes publicados de la serie; solo lo
+	// rellena el catálogo al agrupar las series
+	SeriesCount int
+	// Genre son las rutas de Genres unidas por comas ("Terror > Gótico,
+	// Clásico"). Lo mantiene el store para mostrar y buscar sin consultar los
+	// géneros
+	Genre  string
+	Genres []Genre  // En orden; solo lo rellenan Get y el formulario
+	Tags   []string // Etiquetas, por nombre; solo las rellenan Get y el formulario
+	Stock  int
+	// Rating es la media de las valoraciones aprobadas (0 si no hay ninguna) y
+	// ReviewCount cuántas son
+	Rating         float64
+	ReviewCount    int
 	Description    string
 	CoverImagePath string
 	PdfFilePath    string
-	ReleaseDate    string
+	ReleaseAt      time.Time // Fecha y hora de lanzamiento
+	ReleaseDate    string    // Fecha de lanzamiento formateada para las plantillas
 	IsAvailable    bool
 }
 
+// Series es una serie de libros, cuyos volúmenes se numeran en
+// Book.SeriesVolume.
+type Series struct {
+	ID   int
+	Name string
+}
+
+// Genre es un género del catálogo. Hay dos niveles: un género principal
+// (ParentID 0) puede agrupar subgéneros, como Terror > Gótico.
+type Genre struct {
+	ID         int
+	Name       string
+	ParentID   int // 0 si es un género principal
+	ParentName string
+	BookCount  int // Libros enlazados directamente; solo lo rellena List
+}
+
+// Path devuelve el nombre del género precedido del de su género principal.
+func (g Genre) Path() string {
+	if g.ParentName == "" {
+		return g.Name
+	}
+	return g.ParentName + " > " + g.Name
+}
+
+// Author es un autor de uno o más libros. BookCount solo lo rellena List.
+type Author struct {
+	ID        int
+	Name      string
+	BookCount int
+}
+
+// Ordenaciones del catálogo. catalogSortRelevance solo se usa con búsqueda.
+const (
+	catalogSortTitle        = "title"
+	catalogSortAuthor       = "author"
+	catalogSortNewest       = "newest"
+	catalogSortMostBorrowed = "most_borrowed"
+	catalogSortRelevance    = "relevance"
+)
+
+// CatalogFilter son los filtros, la ordenación y la página pedidos al
+// catálogo. Los campos vacíos o a 0 no filtran.
+type CatalogFilter struct {
+	// GenreID incluye los libros de sus subgéneros
+	GenreID   int
+	Tag       string
+	AuthorID  int
+	YearFrom  int  // Año de lanzamiento mínimo, en hora local
+	YearTo    int  // Año de lanzamiento máximo, incluido
+	Available bool // Solo libros con copias disponibles
+	SeriesID  int
+	// CollapseSeries muestra cada serie como un solo libro: el volumen más
+	// bajo que cumple el resto de filtros
+	CollapseSeries bool
+	Sort           string
+	// After es el ID del último libro de la página anterior (0 para la primera)
+	After int
+	Limit int
+	// BookIDs restringe el catálogo a estos libros, en orden de relevancia;
+	// nil no restringe. Lo rellena la búsqueda.
+	BookIDs []int
+}
+
+// FacetCount es un valor de una faceta y cuántos libros lo tienen con el resto
+// de filtros aplicados.
+type FacetCount struct {
+	ID       int // ID del valor si es una entidad (géneros, autores); 0 si no
+	ParentID int // Género principal de un subgénero
+	Value    string
+	Count    int
+	Selected bool
+}
+
+// CatalogFacets son los recuentos que permiten acotar el catálogo. Cada faceta
+// se calcula con todos los filtros salvo el suyo.
+type CatalogFacets struct {
+	// Genres tiene cada género principal seguido de sus subgéneros. Un libro
+	// de un subgénero cuenta también en su género principal
+	Genres    []FacetCount
+	Tags      []FacetCount // Las etiquetas con más libros
+	Authors   []FacetCount // Los autores con más libros
+	Years     []FacetCount // Por año, del más reciente al más antiguo
+	Available int          // Libros con copias disponibles
+}
+
+// CatalogPage es una página del catálogo.
+type CatalogPage struct {
+	Books []Book
+	Total int // Libros que cumplen los filtros, en todas las páginas
+	// NextAfter es el valor de After para la página siguiente; 0 si es la última
+	NextAfter int
+	Facets    CatalogFacets
+}
+
 type Loan struct {
 	ID                  int
 	UserID              int
 	BookID              int
+	CopyID              sql.NullInt64 // Copia o licencia que ocupa el préstamo
 	Book                Book
 	LoanDate            time.Time
+	DueDate             time.Time // Fecha en que el préstamo expira
 	ReturnDate          sql.NullTime
-	Status              string
+	Status              string // active, returned o expired
+	RenewalCount        int
+	CanRenew            bool // El préstamo está activo y no alcanzó el límite de renovaciones
 	LoanDateFormatted   string
+	DueDateFormatted    string
 	ReturnDateFormatted string
+	TimeRemaining       string // Tiempo hasta DueDate, para las plantillas
+}
+
+// Copy es una unidad prestable de un libro: una copia propia o una licencia de
+// la editorial. Status es available, loaned, reserved (apartada para una
+// reserva) o retired. Una licencia se retira al agotar LicenceLoansRemaining
+// préstamos o al llegar LicenceExpiresAt; si no son válidos no tiene límite.
+type Copy struct {
+	ID                        int
+	BookID                    int
+	Status                    string
+	AcquiredAt                time.Time
+	LicenceLoansRemaining     sql.NullInt64
+	LicenceExpiresAt          sql.NullTime
+	RetiredAt                 sql.NullTime
+	AcquiredAtFormatted       string
+	LicenceExpiresAtFormatted string
+	RetiredAtFormatted        string
+}
+
+// BookInventory es el resultado de conciliar las copias de un libro con sus
+// préstamos y reservas. Los recuentos son los encontrados antes de corregir.
+type BookInventory struct {
+	BookID         int
+	Title          string
+	Capacity       int // Copias no retiradas
+	Available      int // Copias disponibles (el stock)
+	LoanedCopies   int
+	ReservedCopies int
+	ActiveLoans    int
+	ReadyHolds     int
+	WaitingHolds   int
+	// Balanced indica si stock + préstamos activos + reservas apartadas
+	// coincide con la capacidad
+	Balanced bool
+	Issues   []InventoryIssue
+}
+
+// InventoryIssue es una discrepancia encontrada al conciliar el inventario.
+// Kind es un código estable, por ejemplo copia_prestada_sin_prestamo.
+type InventoryIssue struct {
+	BookID      int
+	BookTitle   string
+	Kind        string
+	Description string
+	Fixed       bool
+}
+
+// ReconciliationRun es una ejecución registrada de la conciliación. Source es
+// command, job o admin.
+type ReconciliationRun struct {
+	ID                 int
+	Source             string
+	Fix                bool
+	StartedAt          time.Time
+	BooksChecked       int
+	IssuesFound        int
+	IssuesFixed        int
+	Issues             []InventoryIssue
+	StartedAtFormatted string
+}
+
+// Review es la valoración (de 1 a 5 estrellas) y la reseña de un usuario
+// sobre un libro que ha tomado prestado. Status es pending (pendiente de
+// moderar), approved o rejected; solo las aprobadas se muestran y cuentan en
+// Book.Rating.
+type Review struct {
+	ID                 int
+	BookID             int
+	UserID             int
+	UserName           string // Nombre de quien escribe la reseña
+	BookTitle          string
+	Rating             int
+	Body               string // Vacío si solo hay valoración
+	Status             string
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	ModeratedAt        sql.NullTime
+	UpdatedAtFormatted string
+}
+
+// Hold es una reserva de un libro sin stock. Status es waiting (en cola),
+// ready (copia apartada hasta ExpiresAt), fulfilled, cancelled o expired.
+type Hold struct {
+	ID                 int
+	UserID             int
+	BookID             int
+	CopyID             sql.NullInt64 // Copia apartada (solo en ready)
+	Book               Book
+	Status             string
+	CreatedAt          time.Time
+	ReadyAt            sql.NullTime
+	ExpiresAt          sql.NullTime
+	Position           int // Posición en la cola (solo en waiting)
+	CreatedAtFormatted string
+	ExpiresAtFormatted string
+	TimeRemaining      string // Tiempo para recoger la copia apartada
+}
+
+// Preorder es una preventa de un libro aún no publicado. Status es pending,
+// fulfilled (se convirtió en préstamo), queued (pasó a la cola de reservas) o
+// cancelled.
+type Preorder struct {
+	ID                 int
+	UserID             int
+	BookID             int
+	Book               Book
+	Status             string
+	CreatedAt          time.Time
+	ProcessedAt        sql.NullTime
+	CreatedAtFormatted string
+}
+
+// LoginLock representa un contador de intentos de login fallidos por usuario o por IP
+type LoginLock struct {
+	Scope         string
+	Identifier    string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
 }
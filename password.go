@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordPolicy define las reglas que debe cumplir toda contraseña nueva.
+type PasswordPolicy struct {
+	MinLength     int      `json:"min_length"`
+	RequireUpper  bool     `json:"require_upper"`
+	RequireLower  bool     `json:"require_lower"`
+	RequireDigit  bool     `json:"require_digit"`
+	RequireSymbol bool     `json:"require_symbol"`
+	Banned        []string `json:"banned"`
+}
+
+// defaultPasswordPolicy es la politica usada si no se configura otra.
+var defaultPasswordPolicy = PasswordPolicy{
+	MinLength:    8,
+	RequireLower: true,
+	RequireDigit: true,
+	Banned: []string{
+		"password", "password1", "12345678", "123456789", "qwerty123",
+		"contraseña", "admin123", "admin1234", "usuario123", "ebooks123",
+	},
+}
+
+// ErrWeakPassword se devuelve cuando una contraseña no cumple la politica.
+var ErrWeakPassword = errors.New("la contraseña no cumple la política de seguridad")
+
+// Validate comprueba la contraseña contra la politica y devuelve un error
+// que envuelve ErrWeakPassword describiendo la primera regla incumplida.
+func (p PasswordPolicy) Validate(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: debe tener al menos %d caracteres", ErrWeakPassword, p.MinLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		return fmt.Errorf("%w: debe contener al menos una mayúscula", ErrWeakPassword)
+	}
+	if p.RequireLower && !hasLower {
+		return fmt.Errorf("%w: debe contener al menos una minúscula", ErrWeakPassword)
+	}
+	if p.RequireDigit && !hasDigit {
+		return fmt.Errorf("%w: debe contener al menos un número", ErrWeakPassword)
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return fmt.Errorf("%w: debe contener al menos un símbolo", ErrWeakPassword)
+	}
+
+	for _, banned := range p.Banned {
+		if strings.EqualFold(password, banned) {
+			return fmt.Errorf("%w: es una contraseña demasiado común", ErrWeakPassword)
+		}
+	}
+	return nil
+}
+
+// dummyPasswordHash se compara cuando el usuario no existe, para que el tiempo
+// de respuesta del login no revele qué nombres de usuario son válidos.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("usuario-inexistente"), bcrypt.DefaultCost)
+
+// checkPassword compara una contraseña en texto plano con su hash bcrypt.
+func checkPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// hashPassword genera el hash bcrypt que se guarda en users.password.
+func hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	strict := PasswordPolicy{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		wantErr  bool
+	}{
+		{"política por defecto válida", defaultPasswordPolicy, "lectura2024", false},
+		{"demasiado corta", defaultPasswordPolicy, "abc123", true},
+		{"longitud en caracteres, no en bytes", PasswordPolicy{MinLength: 4}, "ñññ", true},
+		{"sin número", defaultPasswordPolicy, "solamente", true},
+		{"sin minúscula", defaultPasswordPolicy, "LECTURA2024", true},
+		{"prohibida", defaultPasswordPolicy, "password1", true},
+		{"prohibida sin distinguir mayúsculas", defaultPasswordPolicy, "Admin123", true},
+		{"estricta válida", strict, "Lectura-2024", false},
+		{"estricta sin mayúscula", strict, "lectura-2024", true},
+		{"estricta sin símbolo", strict, "Lectura2024x", true},
+		{"el espacio cuenta como símbolo", strict, "Lectura 2024", false},
+		{"política vacía", PasswordPolicy{}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate(%q) error = %v, wantErr %v", tt.password, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrWeakPassword) {
+				t.Errorf("Validate(%q) error = %v, no envuelve ErrWeakPassword", tt.password, err)
+			}
+		})
+	}
+}
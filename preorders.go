@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// createPreorderHandler registra una preventa de un libro que aún no se ha publicado.
+func (app *App) createPreorderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	bookID, err := strconv.Atoi(r.FormValue("book_id"))
+	if err != nil {
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		return
+	}
+	userID := app.SessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if userID == 0 { // Seguridad extra
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	err = app.Preorders.Create(r.Context(), userID, bookID, time.Now())
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, ErrAlreadyReleased):
+		app.SessionManager.Put(r.Context(), "flashError", "Este libro ya está publicado: puedes tomarlo prestado desde su ficha.")
+		http.Redirect(w, r, "/upcoming", http.StatusSeeOther)
+		return
+	case errors.Is(err, ErrAlreadyPreordered):
+		app.SessionManager.Put(r.Context(), "flashError", "Ya tienes una preventa de este libro.")
+		http.Redirect(w, r, "/upcoming", http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Println(err)
+		http.Error(w, "Error de servidor al registrar la preventa", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Preventa: usuario %d, libro %d", userID, bookID)
+	app.SessionManager.Put(r.Context(), "flashSuccess", "¡Preventa registrada! Recibirás el préstamo en cuanto se publique el libro.")
+	http.Redirect(w, r, "/upcoming", http.StatusSeeOther)
+}
+
+// cancelPreorderHandler cancela una preventa pendiente del usuario.
+func (app *App) cancelPreorderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	preorderID, err := strconv.Atoi(r.FormValue("preorder_id"))
+	if err != nil {
+		http.Error(w, "ID de preventa inválido", http.StatusBadRequest)
+		return
+	}
+	userID := app.SessionManager.GetInt(r.Context(), "authenticatedUserID")
+	if userID == 0 { // Seguridad extra
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	err = app.Preorders.Cancel(r.Context(), userID, preorderID, time.Now())
+	if errors.Is(err, ErrNotFound) {
+		app.SessionManager.Put(r.Context(), "flashError", "No se encontró una preventa pendiente para cancelar.")
+		http.Redirect(w, r, "/my-holds", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cancelar la preventa", http.StatusInternalServerError)
+		return
+	}
+
+	app.SessionManager.Put(r.Context(), "flashSuccess", "Preventa cancelada.")
+	http.Redirect(w, r, "/my-holds", http.StatusSeeOther)
+}
+
+// processDuePreorders es la tarea programada que atiende las preventas de los
+// libros ya publicados. Por libro y en orden de llegada, cada preventa se
+// convierte en préstamo mientras haya stock; las demás pasan a la cola de
+// reservas conservando su fecha, de modo que mantienen el orden.
+func (app *App) processDuePreorders(ctx context.Context, now time.Time) error {
+	preorders, err := app.Preorders.ListDue(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, p := range preorders {
+		status, err := app.convertPreorder(ctx, p, now)
+		if err != nil {
+			log.Printf("Error al convertir la preventa %d: %v", p.ID, err)
+			continue
+		}
+		if status == "pending" {
+			// Se reintenta en la siguiente ejecución, pero ya sin retener las copias
+			if err := app.Preorders.MarkAttempted(ctx, p.ID, now); err != nil {
+				log.Printf("Error al registrar el intento de la preventa %d: %v", p.ID, err)
+			}
+			continue
+		}
+		if err := app.Preorders.MarkProcessed(ctx, p.ID, status, now); err != nil {
+			log.Printf("Error al cerrar la preventa %d: %v", p.ID, err)
+			continue
+		}
+		log.Printf("Preventa %d (usuario %d, libro %d): %s", p.ID, p.UserID, p.BookID, status)
+	}
+	return nil
+}
+
+// convertPreorder intenta prestar el libro de la preventa y, si no hay stock
+// o el usuario está en su límite, lo pone en la cola de reservas. Devuelve el
+// estado con el que debe cerrarse la preventa, o pending si hay que reintentar.
+func (app *App) convertPreorder(ctx context.Context, p Preorder, now time.Time) (string, error) {
+	user, err := app.Users.Get(ctx, p.UserID)
+	if err != nil {
+		return "", err
+	}
+	err = app.Loans.CreateFromPreorder(ctx, p.UserID, p.BookID, now, app.loanDueDate(now), app.loanLimit(user))
+	switch {
+	case err == nil, errors.Is(err, ErrAlreadyLoaned):
+		return "fulfilled", nil
+	case errors.Is(err, ErrNoStock), errors.Is(err, ErrLoanLimit):
+		// Fuera de préstamo: se guarda su turno en la cola de reservas
+	default:
+		return "", err
+	}
+
+	_, err = app.Holds.Create(ctx, p.UserID, p.BookID, p.CreatedAt)
+	switch {
+	case err == nil, errors.Is(err, ErrAlreadyOnHold):
+		return "queued", nil
+	case errors.Is(err, ErrStockAvailable):
+		// Hay stock pero el usuario está en su límite de préstamos
+		return "pending", nil
+	}
+	return "", err
+}
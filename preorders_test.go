@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPreorderStoreCreateAndCancel(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	user := addTestUser(t, app, User{Username: "lector", Name: "Lector"})
+	now := time.Now()
+	released := addTestBook(t, app, Book{Title: "Publicado"})
+	upcoming := addTestBook(t, app, Book{Title: "Próximamente", ReleaseAt: now.Add(24 * time.Hour)})
+
+	if err := app.Preorders.Create(ctx, user.ID, released.ID, now); !errors.Is(err, ErrAlreadyReleased) {
+		t.Errorf("preventa de un libro publicado: error = %v, want ErrAlreadyReleased", err)
+	}
+	if err := app.Preorders.Create(ctx, user.ID, 9999, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("preventa de un libro inexistente: error = %v, want ErrNotFound", err)
+	}
+	if err := app.Preorders.Create(ctx, user.ID, upcoming.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Preorders.Create(ctx, user.ID, upcoming.ID, now); !errors.Is(err, ErrAlreadyPreordered) {
+		t.Errorf("preventa repetida: error = %v, want ErrAlreadyPreordered", err)
+	}
+	preorders, err := app.Preorders.ListByUser(ctx, user.ID)
+	if err != nil || len(preorders) != 1 || preorders[0].Book.Title != "Próximamente" {
+		t.Fatalf("ListByUser = %+v, %v", preorders, err)
+	}
+
+	other := addTestUser(t, app, User{Username: "otra", Name: "Otra"})
+	if err := app.Preorders.Cancel(ctx, other.ID, preorders[0].ID, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Cancel de otro usuario: error = %v, want ErrNotFound", err)
+	}
+	if err := app.Preorders.Cancel(ctx, user.ID, preorders[0].ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if preorders, _ := app.Preorders.ListByUser(ctx, user.ID); len(preorders) != 0 {
+		t.Errorf("ListByUser tras cancelar = %+v", preorders)
+	}
+	// Cancelada, se puede volver a reservar
+	if err := app.Preorders.Create(ctx, user.ID, upcoming.ID, now); err != nil {
+		t.Errorf("preventa tras cancelar: %v", err)
+	}
+}
+
+func TestProcessDuePreorders(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	release := now.Add(time.Hour)
+	book := addTestBook(t, app, Book{Title: "Próximamente", ReleaseAt: release})
+	other := addTestBook(t, app, Book{Title: "Otro"})
+	addTestCopies(t, app, book.ID, 2)
+	addTestCopies(t, app, other.ID, 1)
+
+	first := addTestUser(t, app, User{Username: "primera", Name: "Primera"})
+	limited := addTestUser(t, app, User{Username: "limitada", Name: "Limitada", MaxActiveLoans: sql.NullInt64{Int64: 1, Valid: true}})
+	second := addTestUser(t, app, User{Username: "segunda", Name: "Segunda"})
+	last := addTestUser(t, app, User{Username: "ultima", Name: "Última"})
+	walkIn := addTestUser(t, app, User{Username: "visitante", Name: "Visitante"})
+	if err := app.Loans.Create(ctx, limited.ID, other.ID, now, now.Add(48*time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+	for i, user := range []User{first, limited, second, last} {
+		if err := app.Preorders.Create(ctx, user.ID, book.ID, now.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := app.Loans.Create(ctx, walkIn.ID, book.ID, now, now.Add(time.Hour), 0); !errors.Is(err, ErrNotReleased) {
+		t.Errorf("préstamo antes de publicarse: error = %v, want ErrNotReleased", err)
+	}
+	after := release.Add(time.Minute)
+	if err := app.Loans.Create(ctx, walkIn.ID, book.ID, after, after.Add(time.Hour), 0); !errors.Is(err, ErrPreordersPending) {
+		t.Errorf("préstamo con preventas pendientes: error = %v, want ErrPreordersPending", err)
+	}
+
+	if err := app.processDuePreorders(ctx, after); err != nil {
+		t.Fatal(err)
+	}
+	// Las dos copias van a la primera y a la segunda; la usuaria en su límite
+	// no se salta, sigue pendiente, y la última pasa a la cola de reservas
+	for _, user := range []User{first, second} {
+		if active, _ := app.Loans.HasActive(ctx, user.ID, book.ID); !active {
+			t.Errorf("%s no recibió el préstamo", user.Username)
+		}
+	}
+	if active, _ := app.Loans.HasActive(ctx, limited.ID, book.ID); active {
+		t.Error("la usuaria en su límite recibió el préstamo")
+	}
+	if preorders, _ := app.Preorders.ListByUser(ctx, limited.ID); len(preorders) != 1 || !preorders[0].ProcessedAt.Valid {
+		t.Errorf("preventa de la usuaria en su límite = %+v, want pendiente e intentada", preorders)
+	}
+	holds, err := app.Holds.ListByUser(ctx, last.ID)
+	if err != nil || len(holds) != 1 || holds[0].Status != "waiting" || holds[0].Position != 1 {
+		t.Fatalf("reservas de la última = %+v, %v; want primera en la cola", holds, err)
+	}
+	for _, user := range []User{first, second, last} {
+		if preorders, _ := app.Preorders.ListByUser(ctx, user.ID); len(preorders) != 0 {
+			t.Errorf("preventas de %s tras procesar = %+v", user.Username, preorders)
+		}
+	}
+
+	// La preventa ya intentada no bloquea otros préstamos: la copia devuelta
+	// se aparta para la cola de reservas y falla por falta de stock
+	if err := app.Loans.Return(ctx, first.ID, book.ID, after); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Loans.Create(ctx, walkIn.ID, book.ID, after, after.Add(time.Hour), 0); !errors.Is(err, ErrNoStock) {
+		t.Errorf("préstamo con la copia apartada: error = %v, want ErrNoStock", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// legacyPDFDir es el directorio de static donde se guardaban antes los PDFs.
+const legacyPDFDir = "book_pdfs"
+
+// hideLegacyPDFs responde 404 a las rutas de static/book_pdfs, para que los
+// PDFs que sigan allí de versiones anteriores no se descarguen sin préstamo.
+// Se compara sin distinguir mayúsculas porque en Windows el sistema de
+// ficheros tampoco las distingue.
+func hideLegacyPDFs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dir, _, _ := strings.Cut(strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/"), "/")
+		if strings.EqualFold(dir, legacyPDFDir) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readBookHandler entrega el PDF de un libro (/read?book_id=N) solo si el usuario
+// de la sesión tiene un préstamo activo del libro o es administrador. Los PDFs
+// están fuera de /static, así que esta es la única forma de descargarlos.
+// http.ServeContent atiende las peticiones Range para que el visor del
+// navegador pueda leer el documento por partes.
+func (app *App) readBookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	bookID, err := strconv.Atoi(r.URL.Query().Get("book_id"))
+	if err != nil || bookID < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	userID := app.SessionManager.GetInt(ctx, "authenticatedUserID")
+	userName := app.SessionManager.GetString(ctx, "userName")
+	isAdmin := app.SessionManager.GetString(ctx, "userRole") == "admin"
+	// Se registra cada acceso, también los denegados
+	logAccess := func(result string) {
+		log.Printf("LECTURA: usuario %d (%s) libro %d ip %s rango %q: %s", userID, userName, bookID, clientIP(r), r.Header.Get("Range"), result)
+	}
+
+	book, err := app.Books.Get(ctx, bookID)
+	if errors.Is(err, ErrNotFound) {
+		logAccess("libro no encontrado")
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar el libro", http.StatusInternalServerError)
+		return
+	}
+
+	if !isAdmin {
+		hasLoan, err := app.Loans.HasActive(ctx, userID, bookID)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Error de servidor al comprobar el préstamo", http.StatusInternalServerError)
+			return
+		}
+		if !hasLoan {
+			logAccess("denegado, sin préstamo activo")
+			http.Error(w, "Necesitas un préstamo activo para leer este libro", http.StatusForbidden)
+			return
+		}
+	}
+
+	if book.PdfFilePath == "" {
+		logAccess("el libro no tiene PDF")
+		http.NotFound(w, r)
+		return
+	}
+	// filepath.Base impide salir del directorio de PDFs con rutas guardadas en la BD
+	f, err := os.Open(filepath.Join(app.Config.Paths.PDFs, filepath.Base(book.PdfFilePath)))
+	if err != nil {
+		logAccess("archivo no disponible")
+		log.Println(err)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		logAccess("archivo no disponible")
+		http.NotFound(w, r)
+		return
+	}
+
+	logAccess("permitido")
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filepath.Base(book.PdfFilePath)))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
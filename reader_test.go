@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticHidesLegacyPDFs(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Paths.Static = t.TempDir()
+	for _, name := range []string{"book_pdfs/libro.pdf", "css/style.css"} {
+		file := filepath.Join(app.Config.Paths.Static, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("contenido"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := app.routes()
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/static/css/style.css", http.StatusOK},
+		{"/static/book_pdfs/libro.pdf", http.StatusNotFound},
+		{"/static/book_pdfs/", http.StatusNotFound},
+		{"/static/Book_PDFs/libro.pdf", http.StatusNotFound},
+		{"/static/css/../book_pdfs/libro.pdf", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		// ServeMux redirige las rutas sin limpiar; se sigue la redirección
+		if location := w.Header().Get("Location"); location != "" {
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, location, nil))
+		}
+		if w.Code != tt.want {
+			t.Errorf("GET %s: status = %d, want %d", tt.target, w.Code, tt.want)
+		}
+	}
+}
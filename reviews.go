@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxReviewLength limita los caracteres del texto de una reseña.
+const maxReviewLength = 2000
+
+// saveReviewHandler guarda la valoración y la reseña del usuario sobre un
+// libro que ha tomado prestado. La reseña queda pendiente de moderar.
+func (app *App) saveReviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	bookID, err := strconv.Atoi(r.FormValue("book_id"))
+	if err != nil || bookID < 1 {
+		http.Error(w, "ID de libro inválido", http.StatusBadRequest)
+		return
+	}
+	userID := app.SessionManager.GetInt(r.Context(), "authenticatedUserID")
+	bookURL := fmt.Sprintf("/book?id=%d", bookID)
+
+	rating, err := strconv.Atoi(r.FormValue("rating"))
+	if err != nil || rating < 1 || rating > 5 {
+		app.SessionManager.Put(r.Context(), "flashError", "Elige una valoración de 1 a 5 estrellas.")
+		http.Redirect(w, r, bookURL, http.StatusSeeOther)
+		return
+	}
+	body := strings.TrimSpace(r.FormValue("body"))
+	if utf8.RuneCountInString(body) > maxReviewLength {
+		app.SessionManager.Put(r.Context(), "flashError", fmt.Sprintf("La reseña no puede superar los %d caracteres.", maxReviewLength))
+		http.Redirect(w, r, bookURL, http.StatusSeeOther)
+		return
+	}
+
+	review := Review{BookID: bookID, UserID: userID, Rating: rating, Body: body}
+	err = app.Reviews.Save(r.Context(), &review, time.Now())
+	switch {
+	case errors.Is(err, ErrNotBorrowed):
+		app.SessionManager.Put(r.Context(), "flashError", "Solo puedes valorar los libros que has tomado prestados.")
+		http.Redirect(w, r, bookURL, http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("Error al guardar la reseña del usuario %d sobre el libro %d: %v", userID, bookID, err)
+		http.Error(w, "Error de servidor al guardar la reseña", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Reseña: usuario %d valoró el libro %d con %d estrellas", userID, bookID, rating)
+	app.SessionManager.Put(r.Context(), "flashSuccess", "¡Gracias por tu reseña! Se publicará cuando la revise un administrador.")
+	http.Redirect(w, r, bookURL, http.StatusSeeOther)
+}
+
+// adminReviewsHandler muestra las reseñas de un estado para moderarlas, por
+// defecto las pendientes.
+func (app *App) adminReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "approved" && status != "rejected" {
+		status = "pending"
+	}
+	reviews, err := app.Reviews.ListByStatus(r.Context(), status)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al cargar las reseñas", http.StatusInternalServerError)
+		return
+	}
+	for i := range reviews {
+		formatReview(&reviews[i])
+	}
+
+	data := AdminReviewsPageData{
+		UserName:       app.SessionManager.GetString(r.Context(), "userName"),
+		IsAdmin:        true,
+		Reviews:        reviews,
+		Status:         status,
+		SuccessMessage: r.URL.Query().Get("success"),
+		ErrorMessage:   r.URL.Query().Get("error"),
+		CSRFToken:      app.csrfToken(r),
+	}
+
+	files := app.templateFiles("admin_reviews.html", "partials/navbar.html")
+	ts, err := template.ParseFiles(files...)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Error de servidor al parsear plantillas de reseñas", http.StatusInternalServerError)
+		return
+	}
+	ts.ExecuteTemplate(w, "admin_reviews.html", data)
+}
+
+// adminReviewModerateHandler aprueba o rechaza una reseña.
+func (app *App) adminReviewModerateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	r.ParseForm()
+	reviewID, err := strconv.Atoi(r.FormValue("review_id"))
+	if err != nil {
+		http.Error(w, "ID de reseña inválido", http.StatusBadRequest)
+		return
+	}
+	var status, success string
+	switch r.FormValue("action") {
+	case "approve":
+		status, success = "approved", "resena_aprobada"
+	case "reject":
+		status, success = "rejected", "resena_rechazada"
+	default:
+		http.Error(w, "Acción inválida", http.StatusBadRequest)
+		return
+	}
+
+	err = app.Reviews.Moderate(r.Context(), reviewID, status, time.Now())
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Redirect(w, r, "/admin/reviews?error=resena_no_encontrada", http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("Error al moderar la reseña %d: %v", reviewID, err)
+		http.Error(w, "Error de servidor al moderar la reseña", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Reseñas: reseña %d marcada como %s por %s", reviewID, status, app.SessionManager.GetString(r.Context(), "userName"))
+	http.Redirect(w, r, "/admin/reviews?success="+success, http.StatusSeeOther)
+}
+
+// formatReview rellena los campos de presentación de una reseña.
+func formatReview(rv *Review) {
+	rv.UpdatedAtFormatted = rv.UpdatedAt.Local().Format("02/01/2006")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReviewStore(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	book := addTestBook(t, app, Book{Title: "Niebla", ReleaseAt: now.Add(-60 * 24 * time.Hour)})
+	addTestCopies(t, app, book.ID, 3)
+	returned := addTestUser(t, app, User{Username: "devuelto", Name: "Devuelto"})
+	active := addTestUser(t, app, User{Username: "activo", Name: "Activo"})
+	expired := addTestUser(t, app, User{Username: "vencido", Name: "Vencido"})
+	stranger := addTestUser(t, app, User{Username: "nuevo", Name: "Nuevo"})
+
+	for _, user := range []User{returned, active} {
+		if err := app.Loans.Create(ctx, user.ID, book.ID, now, now.Add(time.Hour), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := app.Loans.Return(ctx, returned.ID, book.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Loans.Create(ctx, expired.ID, book.ID, now.Add(-30*24*time.Hour), now.Add(-time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.Loans.ExpireOverdue(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Solo cuentan los préstamos activos o devueltos, no los vencidos
+	for _, tt := range []struct {
+		user User
+		want bool
+	}{{returned, true}, {active, true}, {expired, false}, {stranger, false}} {
+		if got, err := app.Reviews.CanReview(ctx, tt.user.ID, book.ID); err != nil || got != tt.want {
+			t.Errorf("CanReview(%s) = %v, %v; want %v", tt.user.Username, got, err, tt.want)
+		}
+		review := Review{BookID: book.ID, UserID: tt.user.ID, Rating: 3}
+		err := app.Reviews.Save(ctx, &review, now)
+		if tt.want && err != nil {
+			t.Errorf("Save de %s: %v", tt.user.Username, err)
+		}
+		if !tt.want && !errors.Is(err, ErrNotBorrowed) {
+			t.Errorf("Save de %s: error = %v, want ErrNotBorrowed", tt.user.Username, err)
+		}
+	}
+
+	// Las reseñas pendientes no se muestran ni cuentan en la valoración
+	if reviews, _ := app.Reviews.ListApproved(ctx, book.ID); len(reviews) != 0 {
+		t.Errorf("ListApproved antes de moderar = %+v", reviews)
+	}
+	pending, err := app.Reviews.ListByStatus(ctx, "pending")
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("ListByStatus(pending) = %+v, %v", pending, err)
+	}
+	first, err := app.Reviews.GetByUser(ctx, returned.ID, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := app.Reviews.GetByUser(ctx, active.ID, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Reviews.Moderate(ctx, first.ID, "approved", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Reviews.Moderate(ctx, second.ID, "rejected", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Reviews.Moderate(ctx, 9999, "approved", now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Moderate de una reseña inexistente: error = %v, want ErrNotFound", err)
+	}
+	reviews, err := app.Reviews.ListApproved(ctx, book.ID)
+	if err != nil || len(reviews) != 1 || reviews[0].UserName != "Devuelto" {
+		t.Fatalf("ListApproved = %+v, %v", reviews, err)
+	}
+	got, err := app.Books.Get(ctx, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Rating != 3 || got.ReviewCount != 1 {
+		t.Errorf("Rating = %v con %d reseñas, want 3 con 1", got.Rating, got.ReviewCount)
+	}
+
+	// Editar una reseña aprobada la sustituye y vuelve a dejarla pendiente
+	edited := Review{BookID: book.ID, UserID: returned.ID, Rating: 5, Body: "Releída"}
+	if err := app.Reviews.Save(ctx, &edited, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if edited.ID != first.ID || edited.Status != "pending" {
+		t.Errorf("reseña editada = %+v, want la misma pendiente", edited)
+	}
+	if reviews, _ := app.Reviews.ListApproved(ctx, book.ID); len(reviews) != 0 {
+		t.Errorf("ListApproved tras editar = %+v", reviews)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// scheduledJob es una tarea de mantenimiento que se ejecuta periódicamente
+// mientras el servidor está en marcha.
+type scheduledJob struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context, now time.Time) error
+}
+
+// scheduledJobs devuelve las tareas periódicas de la aplicación.
+func (app *App) scheduledJobs() []scheduledJob {
+	return []scheduledJob{
+		{name: "expirar préstamos vencidos", interval: app.Config.Loans.ExpiryInterval.Duration, run: app.expireOverdueLoans},
+		{name: "expirar reservas no recogidas", interval: app.Config.Loans.ExpiryInterval.Duration, run: app.expireUnclaimedHolds},
+		{name: "retirar licencias vencidas", interval: app.Config.Loans.ExpiryInterval.Duration, run: app.retireExpiredLicences},
+		{name: "convertir preventas publicadas", interval: app.Config.Loans.ExpiryInterval.Duration, run: app.processDuePreorders},
+		{name: "conciliar inventario", interval: app.Config.Inventory.ReconcileInterval.Duration, run: app.reconcileInventoryJob},
+		{name: "reconstruir índice de búsqueda", interval: app.Config.Search.RebuildInterval.Duration, run: app.rebuildSearchIndex},
+	}
+}
+
+// startScheduler lanza cada tarea en su propia goroutine. Las tareas se
+// ejecutan una vez al arrancar y después cada interval, hasta que ctx termine.
+func (app *App) startScheduler(ctx context.Context) {
+	for _, job := range app.scheduledJobs() {
+		go func(job scheduledJob) {
+			ticker := time.NewTicker(job.interval)
+			defer ticker.Stop()
+			for {
+				if err := job.run(ctx, time.Now()); err != nil {
+					log.Printf("Error en la tarea programada %q: %v", job.name, err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(job)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStartSchedulerRunsJobsAtStartup(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	now := time.Now()
+	user := User{Username: "lector", Name: "Lector", Role: "user"}
+	if err := app.Users.Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	book := Book{Title: "Vencido", ReleaseAt: now.Add(-60 * 24 * time.Hour)}
+	if err := app.Books.Create(ctx, &book); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Copies.Add(ctx, Copy{BookID: book.ID, AcquiredAt: now}, 1, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Loans.Create(ctx, user.ID, book.ID, now.Add(-15*24*time.Hour), now.Add(-time.Hour), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Los intervalos por defecto son de minutos: el préstamo solo puede
+	// expirar en la ejecución inicial
+	jobs, cancel := context.WithCancel(ctx)
+	defer cancel()
+	app.startScheduler(jobs)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		active, err := app.Loans.HasActive(ctx, user.ID, book.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !active {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("el préstamo vencido no expiró al arrancar el planificador")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
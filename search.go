@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Campos indexados y su peso en la relevancia. Una coincidencia en el título
+// cuenta más que una en la descripción.
+var searchFields = [...]struct {
+	name   string
+	weight float64
+	value  func(Book) string
+}{
+	{"title", 8, func(b Book) string { return b.Title }},
+	{"author", 5, func(b Book) string { return b.Author }},
+	{"genre", 3, func(b Book) string { return b.Genre }},
+	{"description", 1, func(b Book) string { return b.Description }},
+}
+
+const (
+	// searchPrefixFactor reduce la relevancia de los términos que solo
+	// coinciden por prefijo frente a los que coinciden completos.
+	searchPrefixFactor = 0.5
+	// searchPhraseFactor premia que los términos aparezcan seguidos.
+	searchPhraseFactor = 2
+)
+
+// fieldPositions guarda, por cada campo de searchFields, las posiciones de un
+// término dentro del texto del campo.
+type fieldPositions [len(searchFields)][]int
+
+// SearchResult es un libro encontrado por searchIndex.Search y su relevancia.
+type SearchResult struct {
+	BookID int
+	Score  float64
+}
+
+// searchIndex es un índice invertido en memoria de los libros: para cada
+// término normalizado (minúsculas y sin acentos) guarda en qué libros y en qué
+// posiciones de cada campo aparece. Se reconstruye entero con Build.
+type searchIndex struct {
+	mu       sync.RWMutex
+	postings map[string]map[int]*fieldPositions
+	terms    []string // Términos ordenados, para las búsquedas por prefijo
+	docs     int
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{postings: make(map[string]map[int]*fieldPositions)}
+}
+
+// Build sustituye el contenido del índice por los libros indicados.
+func (idx *searchIndex) Build(books []Book) {
+	postings := make(map[string]map[int]*fieldPositions)
+	for _, book := range books {
+		for f, field := range searchFields {
+			for pos, term := range searchTerms(field.value(book)) {
+				byBook := postings[term]
+				if byBook == nil {
+					byBook = make(map[int]*fieldPositions)
+					postings[term] = byBook
+				}
+				fp := byBook[book.ID]
+				if fp == nil {
+					fp = new(fieldPositions)
+					byBook[book.ID] = fp
+				}
+				fp[f] = append(fp[f], pos)
+			}
+		}
+	}
+	terms := make([]string, 0, len(postings))
+	for term := range postings {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	idx.mu.Lock()
+	idx.postings, idx.terms, idx.docs = postings, terms, len(books)
+	idx.mu.Unlock()
+}
+
+// Search devuelve los libros que cumplen todas las partes de la consulta,
+// ordenados por relevancia. La consulta admite palabras sueltas, frases entre
+// comillas ("cien años") y prefijos terminados en * (marq*).
+func (idx *searchIndex) Search(query string) []SearchResult {
+	clauses := parseSearchQuery(query)
+	if len(clauses) == 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var scores map[int]float64
+	for _, c := range clauses {
+		matches := idx.matchClause(c)
+		if scores == nil {
+			scores = matches
+			continue
+		}
+		// Todas las partes deben coincidir
+		for id, score := range scores {
+			if m, ok := matches[id]; ok {
+				scores[id] = score + m
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, SearchResult{BookID: id, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].BookID < results[j].BookID
+	})
+	return results
+}
+
+// searchClause es una parte de la consulta: un término o una frase. Si prefix
+// es true, el último término coincide con cualquier palabra que empiece por él.
+type searchClause struct {
+	terms  []string
+	prefix bool
+}
+
+// parseSearchQuery separa la consulta en frases entre comillas y términos
+// sueltos. Una comilla sin cerrar abarca hasta el final.
+func parseSearchQuery(query string) []searchClause {
+	var clauses []searchClause
+	addWords := func(text string, phrase bool) {
+		var words []string
+		if phrase {
+			words = []string{text}
+		} else {
+			words = strings.Fields(text)
+		}
+		for _, word := range words {
+			word = strings.TrimSpace(word)
+			prefix := strings.HasSuffix(word, "*")
+			terms := searchTerms(strings.TrimRight(word, "*"))
+			if len(terms) == 0 {
+				continue
+			}
+			if phrase {
+				clauses = append(clauses, searchClause{terms: terms, prefix: prefix})
+				continue
+			}
+			// "garcía-márquez" se busca como dos términos independientes
+			for i, term := range terms {
+				clauses = append(clauses, searchClause{terms: []string{term}, prefix: prefix && i == len(terms)-1})
+			}
+		}
+	}
+
+	for {
+		start := strings.IndexByte(query, '"')
+		if start < 0 {
+			addWords(query, false)
+			break
+		}
+		addWords(query[:start], false)
+		rest := query[start+1:]
+		end := strings.IndexByte(rest, '"')
+		if end < 0 {
+			addWords(rest, true)
+			break
+		}
+		addWords(rest[:end], true)
+		query = rest[end+1:]
+	}
+	return clauses
+}
+
+// matchClause devuelve la relevancia de cada libro que contiene la cláusula.
+func (idx *searchIndex) matchClause(c searchClause) map[int]float64 {
+	scores := make(map[int]float64)
+	last := len(c.terms) - 1
+	for _, lastTerm := range idx.expand(c.terms[last], c.prefix) {
+		factor := 1.0
+		if lastTerm != c.terms[last] {
+			factor = searchPrefixFactor
+		}
+		terms := append(append([]string(nil), c.terms[:last]...), lastTerm)
+		if len(terms) > 1 {
+			factor *= searchPhraseFactor
+		}
+		idf := 0.0
+		for _, term := range terms {
+			idf += idx.idf(term)
+		}
+
+		for id, first := range idx.postings[terms[0]] {
+			for f, field := range searchFields {
+				count := 0
+				for _, pos := range first[f] {
+					if idx.phraseAt(terms, id, f, pos) {
+						count++
+					}
+				}
+				if count > 0 {
+					scores[id] += field.weight * (1 + math.Log(float64(count))) * idf * factor
+				}
+			}
+		}
+	}
+	return scores
+}
+
+// phraseAt indica si terms[1:] aparecen justo después de la posición pos del
+// campo f del libro id.
+func (idx *searchIndex) phraseAt(terms []string, id, f, pos int) bool {
+	for i, term := range terms[1:] {
+		fp := idx.postings[term][id]
+		if fp == nil {
+			return false
+		}
+		want := pos + i + 1
+		n := sort.SearchInts(fp[f], want)
+		if n == len(fp[f]) || fp[f][n] != want {
+			return false
+		}
+	}
+	return true
+}
+
+// expand devuelve el término si está en el índice o, con prefix, todos los
+// términos del índice que empiezan por él.
+func (idx *searchIndex) expand(term string, prefix bool) []string {
+	if !prefix {
+		if _, ok := idx.postings[term]; ok {
+			return []string{term}
+		}
+		return nil
+	}
+	var terms []string
+	for i := sort.SearchStrings(idx.terms, term); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], term); i++ {
+		terms = append(terms, idx.terms[i])
+	}
+	return terms
+}
+
+// idf es la frecuencia inversa del término: los términos raros pesan más.
+func (idx *searchIndex) idf(term string) float64 {
+	return math.Log(1 + float64(idx.docs)/float64(1+len(idx.postings[term])))
+}
+
+// searchTerms normaliza el texto (minúsculas y sin acentos, de modo que
+// "García Márquez" y "garcia marquez" coinciden) y lo divide en palabras.
+func searchTerms(text string) []string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	normalized, _, err := transform.String(t, text)
+	if err != nil {
+		normalized = text
+	}
+	return strings.FieldsFunc(strings.ToLower(normalized), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// rebuildSearchIndex carga todos los libros y reconstruye el índice de
+// búsqueda. Se ejecuta al arrancar, tras cada cambio en un libro desde el panel
+// y periódicamente para recoger los cambios hechos por otros procesos.
+func (app *App) rebuildSearchIndex(ctx context.Context, now time.Time) error {
+	books, err := app.Books.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	app.Search.Build(books)
+	return nil
+}
+
+// refreshSearchIndex reconstruye el índice después de un cambio en un libro.
+// Si falla se mantiene el índice anterior hasta la siguiente reconstrucción.
+func (app *App) refreshSearchIndex(ctx context.Context) {
+	if err := app.rebuildSearchIndex(ctx, time.Now()); err != nil {
+		log.Printf("Error al reconstruir el índice de búsqueda: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []searchClause
+	}{
+		{"vacía", "   ", nil},
+		{"palabras sueltas", "Cien Años", []searchClause{{terms: []string{"cien"}}, {terms: []string{"anos"}}}},
+		{"frase", `"cien años"`, []searchClause{{terms: []string{"cien", "anos"}}}},
+		{"frase y palabra", `soledad "cien años"`, []searchClause{{terms: []string{"soledad"}}, {terms: []string{"cien", "anos"}}}},
+		{"prefijo", "marq*", []searchClause{{terms: []string{"marq"}, prefix: true}}},
+		{"prefijo al final de una frase", `"gabriel garc*"`, []searchClause{{terms: []string{"gabriel", "garc"}, prefix: true}}},
+		{"palabra compuesta", "garcía-márquez", []searchClause{{terms: []string{"garcia"}}, {terms: []string{"marquez"}}}},
+		{"prefijo solo en la última parte", "garcía-már*", []searchClause{{terms: []string{"garcia"}}, {terms: []string{"mar"}, prefix: true}}},
+		{"comilla sin cerrar", `"el amor`, []searchClause{{terms: []string{"el", "amor"}}}},
+		{"solo asterisco", "*", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSearchQuery(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchIndexSearch(t *testing.T) {
+	idx := newSearchIndex()
+	idx.Build([]Book{
+		{ID: 1, Title: "Cien años de soledad", Author: "Gabriel García Márquez", Genre: "Realismo mágico"},
+		{ID: 2, Title: "El amor en los tiempos del cólera", Author: "Gabriel García Márquez", Genre: "Novela"},
+		{ID: 3, Title: "La soledad de los números primos", Author: "Paolo Giordano", Genre: "Novela"},
+		{ID: 4, Title: "Marianela", Author: "Benito Pérez Galdós", Genre: "Novela", Description: "Cien páginas de años difíciles"},
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int
+	}{
+		{"sin acentos encuentra acentuados", "garcia marquez", []int{1, 2}},
+		{"con acentos y mayúsculas", "GARCÍA MÁRQUEZ", []int{1, 2}},
+		{"todas las palabras deben coincidir", "soledad giordano", []int{3}},
+		{"el título pesa más que la descripción", "cien años", []int{1, 4}},
+		{"frase exacta", `"cien años"`, []int{1}},
+		{"frase en otro orden no coincide", `"años cien"`, nil},
+		{"prefijo, primero en el título", "mar*", []int{4, 1, 2}},
+		{"sin prefijo no coincide a medias", "mar", nil},
+		{"prefijo dentro de una frase", `"garcía már*"`, []int{1, 2}},
+		{"término inexistente", "cervantes", nil},
+		{"consulta vacía", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, r := range idx.Search(tt.query) {
+				got = append(got, r.BookID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchIndexPrefixScoresBelowExactMatch(t *testing.T) {
+	idx := newSearchIndex()
+	idx.Build([]Book{
+		{ID: 1, Title: "Amores perros"},
+		{ID: 2, Title: "Amor y pedagogía"},
+	})
+	results := idx.Search("amor*")
+	if len(results) != 2 || results[0].BookID != 2 {
+		t.Fatalf("Search(amor*) = %+v, quería primero el libro 2 (coincidencia exacta)", results)
+	}
+	if results[0].Score <= results[1].Score {
+		t.Errorf("la coincidencia exacta (%v) debería puntuar más que la de prefijo (%v)", results[0].Score, results[1].Score)
+	}
+}
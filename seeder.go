@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
 
+// Contraseñas de los usuarios de prueba creados por seedUsers
+const (
+	seedAdminPassword = "Biblioteca2025"
+	seedUserPassword  = "lector2025"
+)
+
 // Listas de archivos de imágenes y PDFs
 var bookImageFilenames = []string{
 	"1984.jpg", "alicia_en_el_pais_de_las_maravillas.jpg", "aura.jpg", "carrie.jpg", "cementerio_de_animales.jpg",
@@ -80,32 +87,34 @@ var bookAuthors = map[string]string{
 	"cien_anos_de_soledad_6": "Gabriel García Márquez", "cien_anos_de_soledad_7": "Gabriel García Márquez",
 }
 
+// bookGenres da los géneros de cada libro separados por comas, cada uno con
+// su género principal delante si es un subgénero ("Terror > Gótico").
 var bookGenres = map[string]string{
-	"carrie": "Terror", "cementerio_de_animales": "Terror", "dracula": "Terror", "el_exorcista": "Terror",
+	"carrie": "Terror", "cementerio_de_animales": "Terror", "dracula": "Terror > Gótico, Clásico", "el_exorcista": "Terror",
 	"el_juego_de_gerald": "Terror", "el_resplandor": "Terror", "it": "Terror", "la_casa_infernal": "Terror",
-	"la_maldicion_de_hill_house": "Terror", "la_semilla_del_diablo": "Terror", "psicosis": "Terror", "salems_lot": "Terror",
+	"la_maldicion_de_hill_house": "Terror > Gótico", "la_semilla_del_diablo": "Terror", "psicosis": "Terror", "salems_lot": "Terror",
 	"dune": "Ciencia Ficción", "el_problema_de_los_tres_cuerpos": "Ciencia Ficción", "fahrenheit_451": "Ciencia Ficción",
 	"ready_player_one": "Ciencia Ficción", "un_mundo_feliz": "Ciencia Ficción", "el_nombre_del_viento": "Fantasía",
 	"el_hobbit": "Fantasía", "el_senor_de_los_anillos": "Fantasía", "alicia_en_el_pais_de_las_maravillas": "Fantasía",
 	"donde_viven_los_monstruos": "Infantil", "el_principito": "Infantil", "maus": "Novela Gráfica",
-	"el_codigo_da_vinci": "Misterio", "el_coleccionista": "Suspense", "1984": "Distopía",
+	"el_codigo_da_vinci": "Misterio", "el_coleccionista": "Suspense", "1984": "Ciencia Ficción > Distopía",
 	"cien_anos_de_soledad": "Realismo Mágico", "cien_anos_de_soledad_2": "Realismo Mágico",
 	"cien_anos_de_soledad_3": "Realismo Mágico", "cien_anos_de_soledad_4": "Realismo Mágico",
 	"cien_anos_de_soledad_5": "Realismo Mágico", "cien_anos_de_soledad_6": "Realismo Mágico",
 	"cien_anos_de_soledad_7":          "Realismo Mágico",
 	"cronica_de_una_muerte_anunciada": "Novela", "dona_barbara": "Novela",
-	"el_amor_en_los_tiempos_del_colera": "Novela Romántica", "el_amor_en_los_tiempos_del_colera_2": "Novela Romántica",
-	"el_coronel_no_tiene_quien_le_escriba": "Novela", "el_cuento_de_la_criada": "Distopía",
+	"el_amor_en_los_tiempos_del_colera": "Realismo Mágico, Romance", "el_amor_en_los_tiempos_del_colera_2": "Realismo Mágico, Romance",
+	"el_coronel_no_tiene_quien_le_escriba": "Novela", "el_cuento_de_la_criada": "Ciencia Ficción > Distopía",
 	"el_gran_gatsby": "Clásico", "el_hombre_ilustrado": "Ciencia Ficción", "el_lazarillo_de_tormes": "Clásico",
 	"el_viejo_y_el_mar": "Clásico", "etica_para_amador": "Filosofía", "ficciones": "Ficción Corta",
-	"frankestein": "Gótico", "hamlet": "Tragedia", "historia_de_dos_ciudades": "Histórica",
+	"frankestein": "Terror > Gótico, Ciencia Ficción", "hamlet": "Tragedia", "historia_de_dos_ciudades": "Histórica",
 	"la_bruja_de_portobello": "Novela", "la_casa_de_los_espiritus": "Realismo Mágico",
 	"la_ciudad_y_los_perros": "Novela", "la_divina_comedia": "Épica",
 	"la_insoportable_levedad_del_ser": "Filosofía", "la_metamorfosis": "Novela Corta",
 	"la_sombra_del_viento": "Misterio", "la_sombra_del_viento_2": "Misterio", "la_sombra_del_viento_3": "Misterio",
-	"los_crimenes_de_oxford": "Misterio", "los_juegos_del_hambre": "Distopía", "los_miserables": "Clásico",
+	"los_crimenes_de_oxford": "Misterio", "los_juegos_del_hambre": "Ciencia Ficción > Distopía", "los_miserables": "Clásico",
 	"los_pilares_de_la_tierra": "Histórica", "los_viajes_de_gulliver": "Sátira", "moby_dick": "Aventura",
-	"morgana": "Romance", "orgullo_y_prejuicio": "Clásico", "rebelion_en_la_granja": "Distopía",
+	"morgana": "Romance", "orgullo_y_prejuicio": "Clásico", "rebelion_en_la_granja": "Ciencia Ficción > Distopía",
 	"sobre_la_libertad": "Filosofía", "ulises": "Clásico", "viaje_al_centro_de_la_tierra": "Aventura",
 }
 
@@ -120,34 +129,47 @@ func (app *App) seedDatabase() {
 
 // seedUsers inserta usuarios de prueba si la tabla está vacía.
 func (app *App) seedUsers() {
-	var count int
-	app.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	ctx := context.Background()
+	count, _ := app.Users.Count(ctx)
 	if count > 0 {
 		log.Println("La tabla 'users' ya está poblada. No se realizarán cambios.")
 		return
 	}
 
 	log.Println("Poblando la base de datos con usuarios de prueba...")
-	// Contraseñas hasheadas para los usuarios de ejemplo (usando bcrypt)
-	adminPass, _ := hashPassword("admin123")
-	userPass, _ := hashPassword("user123")
-
-	_, err := app.DB.Exec(`
-		INSERT INTO users (username, name, email, password, role) VALUES
-		('admin', 'Administrador', 'admin@example.com', ?, 'admin'),
-		('usuario1', 'Usuario Prueba Uno', 'user1@example.com', ?, 'user'),
-		('usuario2', 'Usuario Prueba Dos', 'user2@example.com', ?, 'user')
-	`, adminPass, userPass, userPass)
+	// Las contraseñas de ejemplo deben cumplir la misma política que el resto
+	for _, password := range []string{seedAdminPassword, seedUserPassword} {
+		if err := app.Config.Password.Validate(password); err != nil {
+			log.Fatalf("FATAL: La contraseña de prueba no cumple la política: %v", err)
+		}
+	}
 
+	// Contraseñas hasheadas para los usuarios de ejemplo (usando bcrypt)
+	adminPass, err := hashPassword(seedAdminPassword)
+	if err != nil {
+		log.Fatalf("FATAL: No se pudo hashear la contraseña de prueba: %v", err)
+	}
+	userPass, err := hashPassword(seedUserPassword)
 	if err != nil {
-		log.Fatalf("FATAL: No se pudo insertar usuarios de prueba: %v", err)
+		log.Fatalf("FATAL: No se pudo hashear la contraseña de prueba: %v", err)
+	}
+
+	users := []User{
+		{Username: "admin", Name: "Administrador", Email: "admin@example.com", Password: adminPass, Role: "admin"},
+		{Username: "usuario1", Name: "Usuario Prueba Uno", Email: "user1@example.com", Password: userPass, Role: "user"},
+		{Username: "usuario2", Name: "Usuario Prueba Dos", Email: "user2@example.com", Password: userPass, Role: "user"},
+	}
+	for i := range users {
+		if err := app.Users.Create(ctx, &users[i]); err != nil {
+			log.Fatalf("FATAL: No se pudo insertar usuarios de prueba: %v", err)
+		}
 	}
 	log.Println("¡Poblado de usuarios completado!")
 }
 
 func (app *App) seedBooks() {
-	var count int
-	app.DB.QueryRow("SELECT COUNT(*) FROM books").Scan(&count)
+	ctx := context.Background()
+	count, _ := app.Books.Count(ctx)
 	if count >= len(bookImageFilenames) {
 		log.Println("La tabla 'books' ya está poblada. No se realizarán cambios.")
 		return
@@ -155,12 +177,6 @@ func (app *App) seedBooks() {
 
 	log.Printf("Poblando la base de datos con %d libros...", len(bookImageFilenames))
 
-	stmt, err := app.DB.Prepare("INSERT INTO books (title, author, genre, stock, description, cover_image_path, pdf_file_path, release_date) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
-	if err != nil {
-		log.Fatalf("FATAL: No se pudo preparar la sentencia para insertar libros: %v", err)
-	}
-	defer stmt.Close()
-
 	// Libros que tendrán una fecha de lanzamiento futura
 	upcomingBooks := map[string]bool{
 		"aura": true, "dracula": true, "frankestein": true, "hamlet": true, "it": true,
@@ -168,19 +184,43 @@ func (app *App) seedBooks() {
 		"rebelion_en_la_granja": true, "ulises": true,
 	}
 
+	baseNames := make(map[string]bool, len(bookImageFilenames))
+	for _, imgFilename := range bookImageFilenames {
+		baseNames[strings.TrimSuffix(imgFilename, ".jpg")] = true
+	}
+
 	for i, imgFilename := range bookImageFilenames {
 		baseName := strings.TrimSuffix(imgFilename, ".jpg")
 		title := strings.ReplaceAll(baseName, "_", " ")
 		caser := cases.Title(language.Spanish)
 		title = caser.String(title)
 
-		author, ok := bookAuthors[baseName]
-		if !ok {
-			author = "Autor Desconocido"
+		// cien_anos_de_soledad_2 es el volumen 2 de la serie de cien_anos_de_soledad
+		var seriesID int
+		seriesBase, volume := seedSeriesVolume(baseName, baseNames)
+		if seriesBase != "" {
+			seriesName := caser.String(strings.ReplaceAll(seriesBase, "_", " "))
+			series, err := app.Series.FindOrCreate(ctx, seriesName)
+			if err != nil {
+				log.Printf("ADVERTENCIA: No se pudo crear la serie '%s': %v", seriesName, err)
+				continue
+			}
+			seriesID = series.ID
 		}
-		genre, ok := bookGenres[baseName]
+
+		authorName, ok := bookAuthors[baseName]
 		if !ok {
-			genre = "Clásico"
+			authorName = "Autor Desconocido"
+		}
+		author, err := app.Authors.FindOrCreate(ctx, authorName)
+		if err != nil {
+			log.Printf("ADVERTENCIA: No se pudo crear el autor '%s': %v", authorName, err)
+			continue
+		}
+		genres, err := app.seedBookGenres(ctx, bookGenres[baseName])
+		if err != nil {
+			log.Printf("ADVERTENCIA: No se pudieron crear los géneros de '%s': %v", title, err)
+			continue
 		}
 		pdfFilename := bookPdfFilenames[i]
 
@@ -191,18 +231,68 @@ func (app *App) seedBooks() {
 			releaseDate = time.Now().AddDate(0, -1, 0)
 		}
 
-		// Insertamos el libro con stock inicial de 20
-		_, err := stmt.Exec(title, author, genre, 20, "Descripción de "+title, imgFilename, pdfFilename, releaseDate)
-		if err != nil {
+		book := Book{
+			Title:          title,
+			Authors:        []Author{author},
+			SeriesID:       seriesID,
+			SeriesVolume:   volume,
+			Genres:         genres,
+			Description:    "Descripción de " + title,
+			CoverImagePath: imgFilename,
+			PdfFilePath:    pdfFilename,
+			ReleaseAt:      releaseDate,
+		}
+		if err := app.Books.Create(ctx, &book); err != nil {
 			log.Printf("ADVERTENCIA: No se pudo insertar el libro '%s': %v", title, err)
+			continue
+		}
+		// Stock inicial de 20 copias propias
+		now := time.Now()
+		if err := app.Copies.Add(ctx, Copy{BookID: book.ID, AcquiredAt: now}, 20, now); err != nil {
+			log.Printf("ADVERTENCIA: No se pudieron crear las copias de '%s': %v", title, err)
 		}
 	}
 	log.Println("¡Poblado de libros completado!")
 }
 
+// seedBookGenres crea los géneros de una entrada de bookGenres que aún no
+// existen y los devuelve en orden. Los libros sin entrada quedan sin género.
+func (app *App) seedBookGenres(ctx context.Context, value string) ([]Genre, error) {
+	var genres []Genre
+	for _, path := range strings.Split(value, ", ") {
+		if path == "" {
+			continue
+		}
+		var genre Genre
+		for _, name := range strings.Split(path, " > ") {
+			var err error
+			if genre, err = app.Genres.FindOrCreate(ctx, name, genre.ID); err != nil {
+				return nil, err
+			}
+		}
+		genres = append(genres, genre)
+	}
+	return genres, nil
+}
+
+// seedSeriesVolume detecta los volúmenes de una serie por el nombre de archivo:
+// si existe base_N, base es el volumen 1 y base_N el volumen N. Devuelve la base
+// vacía si el libro no forma parte de ninguna serie.
+func seedSeriesVolume(baseName string, baseNames map[string]bool) (string, int) {
+	if i := strings.LastIndexByte(baseName, '_'); i > 0 {
+		if volume, err := strconv.Atoi(baseName[i+1:]); err == nil && volume > 1 && baseNames[baseName[:i]] {
+			return baseName[:i], volume
+		}
+	}
+	if baseNames[baseName+"_2"] {
+		return baseName, 1
+	}
+	return "", 0
+}
+
 func (app *App) seedLoans() {
-	var count int
-	app.DB.QueryRow("SELECT COUNT(*) FROM loans").Scan(&count)
+	ctx := context.Background()
+	count, _ := app.Loans.Count(ctx)
 	if count > 0 {
 		log.Println("La tabla 'loans' ya está poblada. No se realizarán cambios.")
 		return
@@ -210,60 +300,40 @@ func (app *App) seedLoans() {
 
 	log.Println("Poblando la base de datos con préstamos de prueba para el usuario1...")
 
-	var userID int
-	err := app.DB.QueryRow("SELECT id FROM users WHERE username = 'usuario1'").Scan(&userID)
+	user, err := app.Users.GetByUsername(ctx, "usuario1")
 	if err != nil {
 		log.Printf("ADVERTENCIA: No se pudo encontrar 'usuario1' para poblar préstamos. Saltando préstamos. Error: %v", err)
 		return
 	}
 
-	var bookID1, bookID2, bookID3 int
-	app.DB.QueryRow("SELECT id FROM books WHERE title = '1984'").Scan(&bookID1)
-	app.DB.QueryRow("SELECT id FROM books WHERE title = 'El Principito'").Scan(&bookID2)
-	app.DB.QueryRow("SELECT id FROM books WHERE title = 'Maus'").Scan(&bookID3)
-
-	// Solo insertar si los IDs de los libros se encontraron
-	if bookID1 != 0 {
-		// Préstamo activo
-		_, err := app.DB.Exec("INSERT INTO loans (user_id, book_id, loan_date, status) VALUES (?, ?, ?, 'active')",
-			userID, bookID1, time.Now().AddDate(0, 0, -7)) // Prestado hace 7 días
-		if err != nil {
-			log.Printf("ADVERTENCIA: No se pudo insertar préstamo para libro ID %d: %v", bookID1, err)
-		} else {
-			// Decrementar stock del libro prestado
-			app.DB.Exec("UPDATE books SET stock = stock - 1 WHERE id = ?", bookID1)
+	// Los préstamos pasan por el LoanStore para que ocupen una copia en la misma transacción
+	if book, err := app.Books.GetByTitle(ctx, "1984"); err == nil {
+		// Préstamo activo, prestado hace 7 días
+		loanDate := time.Now().AddDate(0, 0, -7)
+		if err := app.Loans.Create(ctx, user.ID, book.ID, loanDate, app.loanDueDate(loanDate), 0); err != nil {
+			log.Printf("ADVERTENCIA: No se pudo insertar préstamo para libro ID %d: %v", book.ID, err)
 		}
 	}
 
-	if bookID2 != 0 {
-		// Préstamo devuelto
-		_, err := app.DB.Exec("INSERT INTO loans (user_id, book_id, loan_date, return_date, status) VALUES (?, ?, ?, ?, 'returned')",
-			userID, bookID2, time.Now().AddDate(0, 0, -30), time.Now().AddDate(0, 0, -15)) // Prestado hace 30, devuelto hace 15
+	if book, err := app.Books.GetByTitle(ctx, "El Principito"); err == nil {
+		// Préstamo devuelto: prestado hace 30 días, devuelto hace 15
+		loanDate := time.Now().AddDate(0, 0, -30)
+		err := app.Loans.Create(ctx, user.ID, book.ID, loanDate, app.loanDueDate(loanDate), 0)
+		if err == nil {
+			err = app.Loans.Return(ctx, user.ID, book.ID, time.Now().AddDate(0, 0, -15))
+		}
 		if err != nil {
-			log.Printf("ADVERTENCIA: No se pudo insertar préstamo devuelto para libro ID %d: %v", bookID2, err)
+			log.Printf("ADVERTENCIA: No se pudo insertar préstamo devuelto para libro ID %d: %v", book.ID, err)
 		}
-		// No decrementar stock ya que ya fue devuelto
 	}
 
-	if bookID3 != 0 {
-		// Otro préstamo activo
-		_, err := app.DB.Exec("INSERT INTO loans (user_id, book_id, loan_date, status) VALUES (?, ?, ?, 'active')",
-			userID, bookID3, time.Now().AddDate(0, 0, -2))
-		if err != nil {
-			log.Printf("ADVERTENCIA: No se pudo insertar segundo préstamo activo para libro ID %d: %v", bookID3, err)
-		} else {
-			// Decrementar stock del libro prestado
-			app.DB.Exec("UPDATE books SET stock = stock - 1 WHERE id = ?", bookID3)
+	if book, err := app.Books.GetByTitle(ctx, "Maus"); err == nil {
+		// Otro préstamo activo, prestado hace 2 días
+		loanDate := time.Now().AddDate(0, 0, -2)
+		if err := app.Loans.Create(ctx, user.ID, book.ID, loanDate, app.loanDueDate(loanDate), 0); err != nil {
+			log.Printf("ADVERTENCIA: No se pudo insertar segundo préstamo activo para libro ID %d: %v", book.ID, err)
 		}
 	}
 
 	log.Println("¡Poblado de préstamos completado!")
 }
-
-func hashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedPassword), nil
-}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestSeriesStoreFindOrCreate(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+
+	created, err := app.Series.FindOrCreate(ctx, "Episodios nacionales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := app.Series.FindOrCreate(ctx, "EPISODIOS NACIONALES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != created.ID || found.Name != "Episodios nacionales" {
+		t.Errorf("FindOrCreate sin distinguir mayúsculas = %+v, want %+v", found, created)
+	}
+
+	// Dos libros no pueden ser el mismo volumen de la serie
+	addTestBook(t, app, Book{Title: "Trafalgar", SeriesID: created.ID, SeriesVolume: 1})
+	book := Book{Title: "La corte de Carlos IV", SeriesID: created.ID, SeriesVolume: 1}
+	if err := app.Books.Create(ctx, &book); !errors.Is(err, ErrVolumeTaken) {
+		t.Errorf("Create con el volumen ocupado: error = %v, want ErrVolumeTaken", err)
+	}
+}
+
+func TestSeriesStoreFindOrCreateConcurrent(t *testing.T) {
+	app := newSQLTestApp(t)
+	ctx := context.Background()
+	const saves = 50
+
+	// Todas empiezan a la vez para que las consultas y las inserciones se mezclen
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	ids := make(chan int, saves)
+	for i := 0; i < saves; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			sr, err := app.Series.FindOrCreate(ctx, "Los gozos y las sombras")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids <- sr.ID
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(ids)
+
+	first := 0
+	for id := range ids {
+		if first == 0 {
+			first = id
+		}
+		if id != first {
+			t.Errorf("FindOrCreate simultáneos devolvieron los IDs %d y %d", first, id)
+		}
+	}
+	if series, _ := app.Series.List(ctx); len(series) != 1 {
+		t.Errorf("List = %+v, want una serie", series)
+	}
+}
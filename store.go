@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Errores devueltos por los stores. Los handlers los traducen a mensajes
+// para el usuario sin conocer los detalles del almacenamiento.
+var (
+	ErrNotFound          = errors.New("registro no encontrado")
+	ErrAlreadyLoaned     = errors.New("el usuario ya tiene este libro prestado")
+	ErrNoStock           = errors.New("no hay stock disponible para este libro")
+	ErrNoActiveLoan      = errors.New("no hay un préstamo activo para este libro")
+	ErrRenewalLimit      = errors.New("el préstamo alcanzó el límite de renovaciones")
+	ErrLoanLimit         = errors.New("el usuario alcanzó su límite de préstamos activos")
+	ErrHoldsPending      = errors.New("hay usuarios esperando este libro")
+	ErrAlreadyOnHold     = errors.New("el usuario ya tiene una reserva de este libro")
+	ErrStockAvailable    = errors.New("el libro tiene stock disponible")
+	ErrAlreadyReleased   = errors.New("el libro ya está publicado")
+	ErrAlreadyPreordered = errors.New("el usuario ya tiene una preventa de este libro")
+	ErrCopyInUse         = errors.New("la copia está prestada o apartada")
+	ErrVolumeTaken       = errors.New("la serie ya tiene un libro con ese número de volumen")
+	ErrUnknownGenre      = errors.New("el género no existe")
+	ErrUnknownAuthor     = errors.New("el autor no existe")
+	ErrGenreExists       = errors.New("ya existe un género con ese nombre")
+	ErrGenreHierarchy    = errors.New("un subgénero solo puede estar dentro de un género principal")
+	ErrNotBorrowed       = errors.New("el usuario no ha tomado prestado este libro")
+	ErrNotReleased       = errors.New("el libro aún no está publicado")
+	ErrPreordersPending  = errors.New("hay preventas pendientes de este libro")
+)
+
+// BookStore gestiona la persistencia del catálogo de libros.
+type BookStore interface {
+	// ListUpcoming devuelve los libros que se publican después de now, por fecha.
+	ListUpcoming(ctx context.Context, now time.Time) ([]Book, error)
+	// Browse devuelve una página de los libros publicados antes de now que
+	// cumplen el filtro, con los recuentos de cada faceta. La paginación es por
+	// clave: la página siguiente empieza después del libro filter.After.
+	Browse(ctx context.Context, now time.Time, filter CatalogFilter) (CatalogPage, error)
+	// List devuelve todos los libros (los más recientes primero), filtrando
+	// por título si titleQuery no está vacío.
+	List(ctx context.Context, titleQuery string) ([]Book, error)
+	Get(ctx context.Context, id int) (Book, error)
+	GetByTitle(ctx context.Context, title string) (Book, error)
+	Count(ctx context.Context) (int, error)
+	// AdjacentVolumes devuelve el volumen anterior y el siguiente de la serie
+	// del libro, o nil si no hay.
+	AdjacentVolumes(ctx context.Context, book Book) (prev, next *Book, err error)
+	// ListByAuthor devuelve los libros de un autor, publicados o no, del más
+	// reciente al más antiguo.
+	ListByAuthor(ctx context.Context, authorID int) ([]Book, error)
+	// Create inserta el libro y asigna su ID. Book.Stock se ignora: el stock son
+	// las copias disponibles, que se añaden con CopyStore. Los autores se toman
+	// de los IDs de Book.Authors (ErrUnknownAuthor si alguno no existe) y
+	// Book.Author se calcula a partir de ellos. Igual con los géneros de
+	// Book.Genres (ErrUnknownGenre) y Book.Genre. Las etiquetas de Book.Tags
+	// se crean si no existen.
+	Create(ctx context.Context, book *Book) error
+	// Update guarda los metadatos, los autores, los géneros, las etiquetas y
+	// la fecha de lanzamiento. Las rutas de portada y PDF solo se cambian si
+	// no están vacías. Devuelve ErrNotFound si el libro no existe y los
+	// mismos errores que Create. Create y Update devuelven ErrVolumeTaken si
+	// la serie ya tiene ese volumen.
+	Update(ctx context.Context, book Book) error
+	Delete(ctx context.Context, id int) error
+}
+
+// UserStore gestiona la persistencia de los usuarios.
+type UserStore interface {
+	List(ctx context.Context) ([]User, error)
+	Get(ctx context.Context, id int) (User, error)
+	// GetByUsername devuelve el usuario incluyendo el hash de su contraseña.
+	GetByUsername(ctx context.Context, username string) (User, error)
+	Count(ctx context.Context) (int, error)
+	// Create inserta el usuario (Password debe ser ya un hash) y asigna su ID.
+	Create(ctx context.Context, user *User) error
+	// Update guarda los datos del usuario. El hash de la contraseña solo se
+	// cambia si Password no está vacío.
+	Update(ctx context.Context, user User) error
+	SetPassword(ctx context.Context, username, passwordHash string) error
+	Delete(ctx context.Context, id int) error
+}
+
+// LoanStore gestiona los préstamos y las copias que ocupan.
+type LoanStore interface {
+	// Create registra un préstamo activo hasta dueDate y le asigna una copia
+	// disponible en una sola transacción. Si el usuario tiene una copia apartada
+	// por una reserva, usa esa. Devuelve ErrNotReleased (si el libro se
+	// publica después de loanDate), ErrPreordersPending (si quedan preventas
+	// del libro sin intentar atender, que tienen prioridad sobre las copias),
+	// ErrAlreadyLoaned, ErrLoanLimit (si ya tiene maxActive préstamos activos;
+	// 0 es sin límite) o ErrNoStock si no es posible.
+	Create(ctx context.Context, userID, bookID int, loanDate, dueDate time.Time, maxActive int) error
+	// CreateFromPreorder es Create para atender una preventa: no se detiene
+	// por las preventas pendientes del libro.
+	CreateFromPreorder(ctx context.Context, userID, bookID int, loanDate, dueDate time.Time, maxActive int) error
+	// Return marca como devuelto el préstamo activo más reciente y libera la
+	// copia en una sola transacción: se retira si su licencia se agotó o venció,
+	// se aparta para la primera reserva en cola o vuelve a estar disponible.
+	// Devuelve ErrNoActiveLoan si no existe.
+	Return(ctx context.Context, userID, bookID int, returnDate time.Time) error
+	// Renew amplía en extension la fecha de vencimiento del préstamo activo y
+	// cuenta una renovación, en una sola transacción. Devuelve la nueva fecha,
+	// ErrNoActiveLoan si no hay préstamo vigente, ErrRenewalLimit si ya se
+	// renovó maxRenewals veces o ErrHoldsPending si hay reservas en cola.
+	Renew(ctx context.Context, userID, bookID int, now time.Time, extension time.Duration, maxRenewals int) (time.Time, error)
+	// ExpireOverdue pasa a "expired" los préstamos activos vencidos en now y
+	// libera sus copias, con la misma transacción que Return. Devuelve los
+	// préstamos expirados.
+	ExpireOverdue(ctx context.Context, now time.Time) ([]Loan, error)
+	HasActive(ctx context.Context, userID, bookID int) (bool, error)
+	CountActiveByUser(ctx context.Context, userID int) (int, error)
+	// ListByUser devuelve los préstamos del usuario con los datos del libro.
+	ListByUser(ctx context.Context, userID int) ([]Loan, error)
+	Count(ctx context.Context) (int, error)
+}
+
+// HoldStore gestiona la cola de reservas de los libros sin stock. Las copias
+// que se liberan se apartan para la reserva más antigua durante un plazo de
+// recogida; si no se recogen, pasan a la siguiente.
+type HoldStore interface {
+	// Create pone al usuario al final de la cola del libro y devuelve su
+	// posición. Devuelve ErrStockAvailable, ErrAlreadyLoaned o ErrAlreadyOnHold
+	// si no procede reservar.
+	Create(ctx context.Context, userID, bookID int, now time.Time) (int, error)
+	// Cancel cancela una reserva en cola o apartada del usuario. Devuelve
+	// ErrNotFound si no existe.
+	Cancel(ctx context.Context, userID, holdID int, now time.Time) error
+	// ListByUser devuelve las reservas en cola o apartadas del usuario.
+	ListByUser(ctx context.Context, userID int) ([]Hold, error)
+	// GetActive devuelve la reserva en cola o apartada del usuario para el libro.
+	GetActive(ctx context.Context, userID, bookID int) (Hold, error)
+	CountWaiting(ctx context.Context, bookID int) (int, error)
+	// ExpireReady marca como expiradas las reservas apartadas que no se
+	// recogieron antes de now y pasa sus copias a la siguiente reserva.
+	ExpireReady(ctx context.Context, now time.Time) ([]Hold, error)
+}
+
+// CopyStore gestiona las copias y licencias de cada libro. El stock de un libro
+// es el número de sus copias disponibles.
+type CopyStore interface {
+	// ListByBook devuelve todas las copias del libro, también las retiradas.
+	ListByBook(ctx context.Context, bookID int) ([]Copy, error)
+	// Add crea count copias del libro c.BookID con los datos de adquisición y
+	// licencia de c. Cada copia se aparta en now para la primera reserva en
+	// cola, si la hay. Devuelve ErrNotFound si el libro no existe.
+	Add(ctx context.Context, c Copy, count int, now time.Time) error
+	// Retire retira una copia disponible del libro. Devuelve ErrNotFound si no
+	// existe, es de otro libro o ya está retirada y ErrCopyInUse si está
+	// prestada o apartada.
+	Retire(ctx context.Context, bookID, copyID int, now time.Time) error
+	// RetireExpired retira las copias disponibles o apartadas cuya licencia
+	// venció en now. Las reservas que tenían una copia apartada reciben otra
+	// disponible o vuelven a la cola con su turno. Devuelve las retiradas.
+	RetireExpired(ctx context.Context, now time.Time) ([]Copy, error)
+}
+
+// AuthorStore gestiona los autores. Los enlaces con los libros se guardan con
+// BookStore.
+type AuthorStore interface {
+	// List devuelve todos los autores por nombre, con su número de libros.
+	List(ctx context.Context) ([]Author, error)
+	Get(ctx context.Context, id int) (Author, error)
+	// FindOrCreate devuelve el autor con ese nombre (sin distinguir
+	// mayúsculas) o lo crea si no existe.
+	FindOrCreate(ctx context.Context, name string) (Author, error)
+}
+
+// GenreStore gestiona los géneros. Los enlaces con los libros se guardan con
+// BookStore; Update y Merge recalculan Book.Genre de los libros afectados.
+type GenreStore interface {
+	// List devuelve todos los géneros: cada principal, por nombre, seguido de
+	// sus subgéneros.
+	List(ctx context.Context) ([]Genre, error)
+	Get(ctx context.Context, id int) (Genre, error)
+	// FindOrCreate devuelve el género con ese nombre (sin distinguir
+	// mayúsculas) o lo crea dentro de parentID (0 para un género principal).
+	// Si ya existe no se cambia su género principal.
+	FindOrCreate(ctx context.Context, name string, parentID int) (Genre, error)
+	// Create inserta el género y asigna su ID. Devuelve ErrGenreExists si el
+	// nombre está ocupado y ErrGenreHierarchy si ParentID no es un género
+	// principal.
+	Create(ctx context.Context, genre *Genre) error
+	// Update cambia el nombre y el género principal, con los mismos errores
+	// que Create. Un género con subgéneros no puede pasar a ser subgénero.
+	Update(ctx context.Context, genre Genre) error
+	// Merge pasa los libros y subgéneros de sourceID a targetID y elimina
+	// sourceID. Devuelve ErrGenreHierarchy si el resultado tendría más de
+	// dos niveles.
+	Merge(ctx context.Context, sourceID, targetID int) error
+}
+
+// SeriesStore gestiona las series. Los volúmenes se guardan con BookStore.
+type SeriesStore interface {
+	// List devuelve todas las series por nombre.
+	List(ctx context.Context) ([]Series, error)
+	// FindOrCreate devuelve la serie con ese nombre (sin distinguir
+	// mayúsculas) o la crea si no existe.
+	FindOrCreate(ctx context.Context, name string) (Series, error)
+}
+
+// InventoryStore concilia las copias de cada libro con sus préstamos activos y
+// reservas apartadas, y guarda el historial de conciliaciones.
+type InventoryStore interface {
+	// Reconcile revisa cada libro en su propia transacción y devuelve su
+	// inventario con las discrepancias. Si fix es true, también las corrige.
+	Reconcile(ctx context.Context, now time.Time, fix bool) ([]BookInventory, error)
+	// SaveRun guarda una ejecución con sus discrepancias y asigna su ID.
+	SaveRun(ctx context.Context, run *ReconciliationRun) error
+	// ListRuns devuelve las últimas limit ejecuciones, las más recientes primero.
+	ListRuns(ctx context.Context, limit int) ([]ReconciliationRun, error)
+}
+
+// ReviewStore gestiona las valoraciones y reseñas de los libros, una por
+// usuario y libro.
+type ReviewStore interface {
+	// Save crea o sustituye la reseña del usuario sobre el libro y asigna su
+	// ID. La reseña queda pendiente de moderar. Devuelve ErrNotBorrowed si el
+	// usuario no puede valorar el libro (ver CanReview).
+	Save(ctx context.Context, review *Review, now time.Time) error
+	// GetByUser devuelve la reseña del usuario sobre el libro, en cualquier
+	// estado, o ErrNotFound.
+	GetByUser(ctx context.Context, userID, bookID int) (Review, error)
+	// CanReview indica si el usuario tiene el libro prestado o lo ha devuelto
+	// alguna vez. Los préstamos que vencieron sin devolverse no cuentan.
+	CanReview(ctx context.Context, userID, bookID int) (bool, error)
+	// ListApproved devuelve las reseñas aprobadas del libro, las más
+	// recientes primero.
+	ListApproved(ctx context.Context, bookID int) ([]Review, error)
+	// ListByStatus devuelve las reseñas con ese estado de todos los libros,
+	// las más antiguas primero.
+	ListByStatus(ctx context.Context, status string) ([]Review, error)
+	// Moderate cambia el estado de una reseña a approved o rejected. Devuelve
+	// ErrNotFound si no existe.
+	Moderate(ctx context.Context, reviewID int, status string, now time.Time) error
+}
+
+// PreorderStore gestiona las preventas de libros aún no publicados. Una tarea
+// programada las convierte en préstamos o reservas al llegar la publicación.
+type PreorderStore interface {
+	// Create registra una preventa pendiente. Devuelve ErrAlreadyReleased si el
+	// libro ya está publicado en now o ErrAlreadyPreordered si ya existe.
+	Create(ctx context.Context, userID, bookID int, now time.Time) error
+	// Cancel cancela una preventa pendiente del usuario. Devuelve ErrNotFound
+	// si no existe.
+	Cancel(ctx context.Context, userID, preorderID int, now time.Time) error
+	// ListByUser devuelve las preventas pendientes del usuario.
+	ListByUser(ctx context.Context, userID int) ([]Preorder, error)
+	// ListDue devuelve las preventas pendientes de libros publicados en now,
+	// por libro y en orden de llegada.
+	ListDue(ctx context.Context, now time.Time) ([]Preorder, error)
+	// MarkProcessed cierra una preventa pendiente con el estado indicado.
+	MarkProcessed(ctx context.Context, preorderID int, status string, now time.Time) error
+	// MarkAttempted registra en ProcessedAt que se intentó atender la
+	// preventa, que sigue pendiente. Desde entonces ya no retiene las copias
+	// del libro frente a otros préstamos.
+	MarkAttempted(ctx context.Context, preorderID int, now time.Time) error
+}
+
+// LoginFailureStore guarda los contadores de intentos de login fallidos.
+type LoginFailureStore interface {
+	Get(ctx context.Context, scope, identifier string) (LoginLock, error)
+	// RecordFailure suma en now un fallo al contador, que vuelve a empezar si
+	// su bloqueo venció o no tenía fallos recientes, y lo bloquea durante
+	// throttle.LockDuration si alcanza throttle.MaxFailures. El incremento es
+	// atómico: los fallos simultáneos se cuentan todos. Devuelve el contador
+	// resultante.
+	RecordFailure(ctx context.Context, scope, identifier string, now time.Time, throttle LoginThrottle) (LoginLock, error)
+	Delete(ctx context.Context, scope, identifier string) error
+	// ListLocked devuelve los contadores bloqueados después de now.
+	ListLocked(ctx context.Context, now time.Time) ([]LoginLock, error)
+}
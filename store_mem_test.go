@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memData guarda en memoria los libros, usuarios y préstamos que comparten
+// memBookStore, memUserStore y memLoanStore, para probar los handlers sin base
+// de datos. No hay copias: el stock de un libro es Book.Stock. Tampoco hay
+// reservas ni preventas, así que nunca se devuelven ErrHoldsPending ni
+// ErrPreordersPending.
+type memData struct {
+	mu     sync.Mutex
+	books  map[int]Book
+	users  map[int]User
+	loans  []Loan
+	nextID int
+}
+
+func newMemData() *memData {
+	return &memData{books: make(map[int]Book), users: make(map[int]User)}
+}
+
+func (d *memData) newID() int {
+	d.nextID++
+	return d.nextID
+}
+
+// sortedBooks devuelve los libros que cumplen keep, ordenados con less.
+func (d *memData) sortedBooks(keep func(Book) bool, less func(a, b Book) bool) []Book {
+	var books []Book
+	for _, b := range d.books {
+		if keep(b) {
+			books = append(books, b)
+		}
+	}
+	sort.Slice(books, func(i, j int) bool { return less(books[i], books[j]) })
+	return books
+}
+
+// volumeTaken indica si otro libro de la serie ya tiene ese volumen.
+func (d *memData) volumeTaken(book Book) bool {
+	if book.SeriesID == 0 {
+		return false
+	}
+	for _, b := range d.books {
+		if b.ID != book.ID && b.SeriesID == book.SeriesID && b.SeriesVolume == book.SeriesVolume {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Libros ---
+
+// memBookStore implementa BookStore. Los autores, géneros y etiquetas se
+// guardan tal cual llegan, y Browse no calcula facetas ni agrupa series.
+type memBookStore struct{ *memData }
+
+var _ BookStore = memBookStore{}
+
+func (s memBookStore) ListUpcoming(ctx context.Context, now time.Time) ([]Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedBooks(func(b Book) bool { return b.ReleaseAt.After(now) },
+		func(a, b Book) bool { return a.ReleaseAt.Before(b.ReleaseAt) }), nil
+}
+
+func (s memBookStore) Browse(ctx context.Context, now time.Time, filter CatalogFilter) (CatalogPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var relevance map[int]int
+	if filter.BookIDs != nil {
+		relevance = make(map[int]int, len(filter.BookIDs))
+		for i, id := range filter.BookIDs {
+			relevance[id] = i
+		}
+	}
+	books := s.sortedBooks(func(b Book) bool {
+		if b.ReleaseAt.After(now) {
+			return false
+		}
+		if _, ok := relevance[b.ID]; relevance != nil && !ok {
+			return false
+		}
+		year := b.ReleaseAt.Local().Year()
+		return (!filter.Available || b.Stock > 0) &&
+			(filter.SeriesID == 0 || b.SeriesID == filter.SeriesID) &&
+			(filter.YearFrom == 0 || year >= filter.YearFrom) &&
+			(filter.YearTo == 0 || year <= filter.YearTo) &&
+			(filter.AuthorID == 0 || hasAuthor(b, filter.AuthorID)) &&
+			(filter.GenreID == 0 || hasGenre(b, filter.GenreID)) &&
+			(filter.Tag == "" || hasTag(b, filter.Tag))
+	}, func(a, b Book) bool {
+		if relevance != nil {
+			return relevance[a.ID] < relevance[b.ID]
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return a.ID < b.ID
+	})
+
+	page := CatalogPage{Total: len(books)}
+	if filter.After != 0 {
+		for i, b := range books {
+			if b.ID == filter.After {
+				books = books[i+1:]
+				break
+			}
+		}
+	}
+	if filter.Limit > 0 && len(books) > filter.Limit {
+		books = books[:filter.Limit]
+		page.NextAfter = books[len(books)-1].ID
+	}
+	page.Books = books
+	return page, nil
+}
+
+func hasAuthor(b Book, authorID int) bool {
+	for _, a := range b.Authors {
+		if a.ID == authorID {
+			return true
+		}
+	}
+	return false
+}
+
+func hasGenre(b Book, genreID int) bool {
+	for _, g := range b.Genres {
+		if g.ID == genreID || g.ParentID == genreID {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTag(b Book, tag string) bool {
+	for _, t := range b.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s memBookStore) List(ctx context.Context, titleQuery string) ([]Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	titleQuery = strings.ToLower(titleQuery)
+	return s.sortedBooks(func(b Book) bool { return strings.Contains(strings.ToLower(b.Title), titleQuery) },
+		func(a, b Book) bool { return a.ID > b.ID }), nil
+}
+
+func (s memBookStore) Get(ctx context.Context, id int) (Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	book, ok := s.books[id]
+	if !ok {
+		return Book{}, ErrNotFound
+	}
+	return book, nil
+}
+
+func (s memBookStore) GetByTitle(ctx context.Context, title string) (Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.books {
+		if b.Title == title {
+			return b, nil
+		}
+	}
+	return Book{}, ErrNotFound
+}
+
+func (s memBookStore) Count(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.books), nil
+}
+
+func (s memBookStore) AdjacentVolumes(ctx context.Context, book Book) (prev, next *Book, err error) {
+	if book.SeriesID == 0 {
+		return nil, nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.books {
+		if b.SeriesID != book.SeriesID {
+			continue
+		}
+		b := b
+		if b.SeriesVolume < book.SeriesVolume && (prev == nil || b.SeriesVolume > prev.SeriesVolume) {
+			prev = &b
+		}
+		if b.SeriesVolume > book.SeriesVolume && (next == nil || b.SeriesVolume < next.SeriesVolume) {
+			next = &b
+		}
+	}
+	return prev, next, nil
+}
+
+func (s memBookStore) ListByAuthor(ctx context.Context, authorID int) ([]Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedBooks(func(b Book) bool { return hasAuthor(b, authorID) }, func(a, b Book) bool {
+		if !a.ReleaseAt.Equal(b.ReleaseAt) {
+			return a.ReleaseAt.After(b.ReleaseAt)
+		}
+		return a.ID > b.ID
+	}), nil
+}
+
+func (s memBookStore) Create(ctx context.Context, book *Book) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.volumeTaken(*book) {
+		return ErrVolumeTaken
+	}
+	book.ID = s.newID()
+	s.books[book.ID] = *book
+	return nil
+}
+
+func (s memBookStore) Update(ctx context.Context, book Book) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.books[book.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if s.volumeTaken(book) {
+		return ErrVolumeTaken
+	}
+	if book.CoverImagePath == "" {
+		book.CoverImagePath = old.CoverImagePath
+	}
+	if book.PdfFilePath == "" {
+		book.PdfFilePath = old.PdfFilePath
+	}
+	book.Stock = old.Stock
+	s.books[book.ID] = book
+	return nil
+}
+
+func (s memBookStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.books, id)
+	s.loans = deleteLoans(s.loans, func(l Loan) bool { return l.BookID == id })
+	return nil
+}
+
+// deleteLoans quita los préstamos que cumplen match, como el ON DELETE CASCADE.
+func deleteLoans(loans []Loan, match func(Loan) bool) []Loan {
+	kept := loans[:0]
+	for _, l := range loans {
+		if !match(l) {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// --- Usuarios ---
+
+// memUserStore implementa UserStore. Como en SQL, solo GetByUsername devuelve
+// el hash de la contraseña.
+type memUserStore struct{ *memData }
+
+var _ UserStore = memUserStore{}
+
+func (s memUserStore) List(ctx context.Context) ([]User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		u.Password = ""
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID > users[j].ID })
+	return users, nil
+}
+
+func (s memUserStore) Get(ctx context.Context, id int) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+	user.Password = ""
+	return user, nil
+}
+
+func (s memUserStore) GetByUsername(ctx context.Context, username string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (s memUserStore) Count(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.users), nil
+}
+
+func (s memUserStore) Create(ctx context.Context, user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user.ID = s.newID()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s memUserStore) Update(ctx context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.users[user.ID]
+	if !ok {
+		return nil // Como un UPDATE sin filas
+	}
+	if user.Password == "" {
+		user.Password = old.Password
+	}
+	user.CreatedAt = old.CreatedAt
+	s.users[user.ID] = user
+	return nil
+}
+
+func (s memUserStore) SetPassword(ctx context.Context, username, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, u := range s.users {
+		if u.Username == username {
+			u.Password = passwordHash
+			s.users[id] = u
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s memUserStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, id)
+	s.loans = deleteLoans(s.loans, func(l Loan) bool { return l.UserID == id })
+	return nil
+}
+
+// --- Préstamos ---
+
+// memLoanStore implementa LoanStore descontando y reponiendo Book.Stock.
+type memLoanStore struct{ *memData }
+
+var _ LoanStore = memLoanStore{}
+
+// activeLoan devuelve el índice del préstamo activo más reciente del usuario
+// para el libro, o -1.
+func (s memLoanStore) activeLoan(userID, bookID int) int {
+	found := -1
+	for i, l := range s.loans {
+		if l.UserID == userID && l.BookID == bookID && l.Status == "active" &&
+			(found < 0 || !l.LoanDate.Before(s.loans[found].LoanDate)) {
+			found = i
+		}
+	}
+	return found
+}
+
+func (s memLoanStore) countActive(userID int) int {
+	count := 0
+	for _, l := range s.loans {
+		if l.UserID == userID && l.Status == "active" {
+			count++
+		}
+	}
+	return count
+}
+
+// releaseStock devuelve al stock la copia de un préstamo que termina.
+func (s memLoanStore) releaseStock(bookID int) {
+	if book, ok := s.books[bookID]; ok {
+		book.Stock++
+		s.books[bookID] = book
+	}
+}
+
+func (s memLoanStore) Create(ctx context.Context, userID, bookID int, loanDate, dueDate time.Time, maxActive int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return ErrNotFound
+	}
+	book, ok := s.books[bookID]
+	if !ok {
+		return ErrNotFound
+	}
+	switch {
+	case book.ReleaseAt.After(loanDate):
+		return ErrNotReleased
+	case s.activeLoan(userID, bookID) >= 0:
+		return ErrAlreadyLoaned
+	case maxActive > 0 && s.countActive(userID) >= maxActive:
+		return ErrLoanLimit
+	case book.Stock <= 0:
+		return ErrNoStock
+	}
+	book.Stock--
+	s.books[bookID] = book
+	s.loans = append(s.loans, Loan{ID: s.newID(), UserID: userID, BookID: bookID, LoanDate: loanDate, DueDate: dueDate, Status: "active"})
+	return nil
+}
+
+func (s memLoanStore) CreateFromPreorder(ctx context.Context, userID, bookID int, loanDate, dueDate time.Time, maxActive int) error {
+	return s.Create(ctx, userID, bookID, loanDate, dueDate, maxActive)
+}
+
+func (s memLoanStore) Return(ctx context.Context, userID, bookID int, returnDate time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.activeLoan(userID, bookID)
+	if i < 0 {
+		return ErrNoActiveLoan
+	}
+	s.loans[i].Status = "returned"
+	s.loans[i].ReturnDate.Time, s.loans[i].ReturnDate.Valid = returnDate, true
+	s.releaseStock(bookID)
+	return nil
+}
+
+func (s memLoanStore) Renew(ctx context.Context, userID, bookID int, now time.Time, extension time.Duration, maxRenewals int) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.activeLoan(userID, bookID)
+	if i < 0 || !s.loans[i].DueDate.After(now) {
+		return time.Time{}, ErrNoActiveLoan
+	}
+	if s.loans[i].RenewalCount >= maxRenewals {
+		return time.Time{}, ErrRenewalLimit
+	}
+	s.loans[i].DueDate = s.loans[i].DueDate.Add(extension)
+	s.loans[i].RenewalCount++
+	return s.loans[i].DueDate, nil
+}
+
+func (s memLoanStore) ExpireOverdue(ctx context.Context, now time.Time) ([]Loan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []Loan
+	for i, l := range s.loans {
+		if l.Status == "active" && !l.DueDate.After(now) {
+			s.loans[i].Status = "expired"
+			s.releaseStock(l.BookID)
+			expired = append(expired, s.loans[i])
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].DueDate.Before(expired[j].DueDate) })
+	return expired, nil
+}
+
+func (s memLoanStore) HasActive(ctx context.Context, userID, bookID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeLoan(userID, bookID) >= 0, nil
+}
+
+func (s memLoanStore) CountActiveByUser(ctx context.Context, userID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.countActive(userID), nil
+}
+
+func (s memLoanStore) ListByUser(ctx context.Context, userID int) ([]Loan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var loans []Loan
+	for _, l := range s.loans {
+		if l.UserID == userID {
+			l.Book = s.books[l.BookID]
+			loans = append(loans, l)
+		}
+	}
+	sort.Slice(loans, func(i, j int) bool { return loans[i].LoanDate.After(loans[j].LoanDate) })
+	return loans, nil
+}
+
+func (s memLoanStore) Count(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.loans), nil
+}
@@ -0,0 +1,2547 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Implementación SQL de los stores, común a todos los dialectos. Las consultas
+// usan marcadores "?" y las fechas se calculan en Go, no con funciones del motor.
+
+type sqlBookStore struct{ db *sqlDB }
+type sqlAuthorStore struct{ db *sqlDB }
+type sqlSeriesStore struct{ db *sqlDB }
+type sqlGenreStore struct{ db *sqlDB }
+type sqlReviewStore struct{ db *sqlDB }
+type sqlUserStore struct{ db *sqlDB }
+type sqlLoginFailureStore struct{ db *sqlDB }
+type sqlPreorderStore struct{ db *sqlDB }
+type sqlCopyStore struct {
+	db               *sqlDB
+	holdPickupWindow time.Duration
+}
+type sqlInventoryStore struct {
+	db               *sqlDB
+	holdPickupWindow time.Duration
+}
+
+// Las copias que se liberan quedan apartadas durante holdPickupWindow para la
+// primera reserva en cola.
+type sqlLoanStore struct {
+	db               *sqlDB
+	holdPickupWindow time.Duration
+}
+type sqlHoldStore struct {
+	db               *sqlDB
+	holdPickupWindow time.Duration
+}
+
+// rowScanner permite compartir el escaneo entre *sql.Row y *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// --- Libros ---
+
+// availableCopies cuenta las copias disponibles del libro ref, que forman su stock.
+func availableCopies(ref string) string {
+	return "(SELECT COUNT(*) FROM copies c WHERE c.book_id = " + ref + ".id AND c.status = 'available')"
+}
+
+// approvedReviews filtra las reseñas aprobadas del libro ref, que forman su
+// valoración.
+func approvedReviews(ref string) string {
+	return "FROM reviews r WHERE r.book_id = " + ref + ".id AND r.status = 'approved'"
+}
+
+var bookColumns = "id, title, author, isbn, publisher, language, page_count, edition, " +
+	"COALESCE(series_id, 0), COALESCE(series_volume, 0), COALESCE((SELECT s.name FROM series s WHERE s.id = books.series_id), ''), " +
+	"genre, " + availableCopies("books") + ", " +
+	"(SELECT COUNT(*) " + approvedReviews("books") + "), (SELECT COALESCE(SUM(r.rating), 0) " + approvedReviews("books") + "), " +
+	"description, cover_image_path, pdf_file_path, release_date"
+
+func scanBook(s rowScanner) (Book, error) {
+	var book Book
+	var ratingSum int
+	err := s.Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Publisher, &book.Language, &book.PageCount, &book.Edition,
+		&book.SeriesID, &book.SeriesVolume, &book.SeriesName, &book.Genre, &book.Stock, &book.ReviewCount, &ratingSum,
+		&book.Description, &book.CoverImagePath, &book.PdfFilePath, &book.ReleaseAt)
+	if book.ReviewCount > 0 {
+		book.Rating = float64(ratingSum) / float64(book.ReviewCount)
+	}
+	return book, err
+}
+
+func (s *sqlBookStore) queryBooks(ctx context.Context, query string, args ...interface{}) ([]Book, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []Book
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+func (s *sqlBookStore) getBook(ctx context.Context, where string, arg interface{}) (Book, error) {
+	book, err := scanBook(s.db.QueryRowContext(ctx, "SELECT "+bookColumns+" FROM books WHERE "+where, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return book, ErrNotFound
+	}
+	if err != nil {
+		return book, err
+	}
+	if book.Authors, err = s.listBookAuthors(ctx, book.ID); err != nil {
+		return book, err
+	}
+	if book.Genres, err = listBookGenres(ctx, s.db, book.ID); err != nil {
+		return book, err
+	}
+	book.Tags, err = s.listBookTags(ctx, book.ID)
+	return book, err
+}
+
+// listBookAuthors devuelve los autores de un libro en su orden.
+func (s *sqlBookStore) listBookAuthors(ctx context.Context, bookID int) ([]Author, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT a.id, a.name FROM book_authors ba JOIN authors a ON a.id = ba.author_id WHERE ba.book_id = ? ORDER BY ba.author_order", bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var authors []Author
+	for rows.Next() {
+		var a Author
+		if err := rows.Scan(&a.ID, &a.Name); err != nil {
+			return nil, err
+		}
+		authors = append(authors, a)
+	}
+	return authors, rows.Err()
+}
+
+// setBookAuthors sustituye los autores del libro por los de authors (por ID,
+// en ese orden) y devuelve sus nombres unidos para books.author.
+func setBookAuthors(ctx context.Context, tx *sqlTx, bookID int, authors []Author) (string, error) {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM book_authors WHERE book_id = ?", bookID); err != nil {
+		return "", err
+	}
+	var names []string
+	linked := make(map[int]bool)
+	for _, a := range authors {
+		if linked[a.ID] {
+			continue
+		}
+		var name string
+		err := tx.QueryRowContext(ctx, "SELECT name FROM authors WHERE id = ?", a.ID).Scan(&name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrUnknownAuthor
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO book_authors (book_id, author_id, author_order) VALUES (?, ?, ?)", bookID, a.ID, len(names)); err != nil {
+			return "", err
+		}
+		linked[a.ID] = true
+		names = append(names, name)
+	}
+	// books.author admite 255 caracteres
+	return truncateRunes(strings.Join(names, ", "), 255), nil
+}
+
+// truncateRunes corta s a max caracteres, terminando en "…" si se corta.
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
+
+// rowsQuerier permite consultar filas tanto con *sqlDB como con *sqlTx.
+type rowsQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// genreSelect lee los géneros con el nombre de su género principal, en el
+// orden de scanGenre.
+const genreSelect = "SELECT g.id, g.name, COALESCE(g.parent_id, 0), COALESCE(p.name, '') FROM genres g LEFT JOIN genres p ON p.id = g.parent_id"
+
+func scanGenre(s rowScanner, extra ...interface{}) (Genre, error) {
+	var g Genre
+	err := s.Scan(append([]interface{}{&g.ID, &g.Name, &g.ParentID, &g.ParentName}, extra...)...)
+	return g, err
+}
+
+// listBookGenres devuelve los géneros de un libro en su orden.
+func listBookGenres(ctx context.Context, q rowsQuerier, bookID int) ([]Genre, error) {
+	rows, err := q.QueryContext(ctx, genreSelect+" JOIN book_genres bg ON bg.genre_id = g.id WHERE bg.book_id = ? ORDER BY bg.genre_order", bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var genres []Genre
+	for rows.Next() {
+		g, err := scanGenre(rows)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, g)
+	}
+	return genres, rows.Err()
+}
+
+// bookGenreText devuelve las rutas de los géneros del libro unidas por comas,
+// para books.genre.
+func bookGenreText(ctx context.Context, q rowsQuerier, bookID int) (string, error) {
+	genres, err := listBookGenres(ctx, q, bookID)
+	if err != nil {
+		return "", err
+	}
+	paths := make([]string, len(genres))
+	for i, g := range genres {
+		paths[i] = g.Path()
+	}
+	// books.genre admite 100 caracteres
+	return truncateRunes(strings.Join(paths, ", "), 100), nil
+}
+
+// setBookGenres sustituye los géneros del libro por los de genres (por ID, en
+// ese orden) y devuelve el texto para books.genre.
+func setBookGenres(ctx context.Context, tx *sqlTx, bookID int, genres []Genre) (string, error) {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM book_genres WHERE book_id = ?", bookID); err != nil {
+		return "", err
+	}
+	linked := make(map[int]bool)
+	for _, g := range genres {
+		if linked[g.ID] {
+			continue
+		}
+		var exists int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM genres WHERE id = ?", g.ID).Scan(&exists); err != nil {
+			return "", err
+		}
+		if exists == 0 {
+			return "", ErrUnknownGenre
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO book_genres (book_id, genre_id, genre_order) VALUES (?, ?, ?)", bookID, g.ID, len(linked)); err != nil {
+			return "", err
+		}
+		linked[g.ID] = true
+	}
+	return bookGenreText(ctx, tx, bookID)
+}
+
+// listBookTags devuelve las etiquetas de un libro por nombre.
+func (s *sqlBookStore) listBookTags(ctx context.Context, bookID int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT t.name FROM book_tags bt JOIN tags t ON t.id = bt.tag_id WHERE bt.book_id = ? ORDER BY t.name", bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tags []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	return tags, rows.Err()
+}
+
+// setBookTags sustituye las etiquetas del libro, creando las que no existen.
+func setBookTags(ctx context.Context, tx *sqlTx, bookID int, tags []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM book_tags WHERE book_id = ?", bookID); err != nil {
+		return err
+	}
+	linked := make(map[int64]bool)
+	for _, name := range tags {
+		// La comparación no distingue mayúsculas por la intercalación de la columna
+		var id int64
+		err := tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE name = ?", name).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Otro guardado puede haberla creado desde la consulta
+			id, err = tx.dialect.insertOrGetID(ctx, tx, "tags", "name", "INSERT INTO tags (name) VALUES (?)", name)
+		}
+		if err != nil {
+			return err
+		}
+		if linked[id] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO book_tags (book_id, tag_id) VALUES (?, ?)", bookID, id); err != nil {
+			return err
+		}
+		linked[id] = true
+	}
+	return nil
+}
+
+func (s *sqlBookStore) ListUpcoming(ctx context.Context, now time.Time) ([]Book, error) {
+	return s.queryBooks(ctx, "SELECT "+bookColumns+" FROM books WHERE release_date > ? ORDER BY release_date", now)
+}
+
+// --- Catálogo ---
+
+// loanCount es el número de préstamos de un libro (de cualquier estado), para
+// ordenar por los más prestados.
+const loanCount = "(SELECT COUNT(*) FROM loans l WHERE l.book_id = books.id)"
+
+// catalogAuthorFacets y catalogTagFacets son cuántos autores y etiquetas
+// muestran sus facetas.
+const (
+	catalogAuthorFacets = 20
+	catalogTagFacets    = 20
+)
+
+// catalogSortKeys devuelve las columnas por las que se ordena cada ordenación
+// del catálogo, terminando en id para que el orden sea total, y si es
+// descendente. La paginación por clave compara con estas mismas columnas.
+func catalogSortKeys(sort string) ([]string, bool) {
+	switch sort {
+	case catalogSortAuthor:
+		return []string{"author", "title", "id"}, false
+	case catalogSortNewest:
+		return []string{"release_date", "id"}, true
+	case catalogSortMostBorrowed:
+		return []string{loanCount, "id"}, true
+	default:
+		return []string{"title", "id"}, false
+	}
+}
+
+// placeholders devuelve n marcadores separados por comas, para un IN (...).
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// catalogConditions traduce el filtro a condiciones SQL. skip omite el filtro
+// de una faceta (genre, tag, author, year o available) para calcular sus recuentos.
+func catalogConditions(now time.Time, f CatalogFilter, skip string) (string, []interface{}) {
+	conds, args := bookFilterConditions("books", now, f, skip)
+	// Al agrupar, de cada serie solo queda su volumen más bajo entre los que
+	// cumplen los mismos filtros
+	if f.CollapseSeries {
+		inner, innerArgs := bookFilterConditions("b2", now, f, skip)
+		conds = append(conds, "(books.series_id IS NULL OR books.series_volume = (SELECT MIN(b2.series_volume) FROM books b2 WHERE b2.series_id = books.series_id AND "+strings.Join(inner, " AND ")+"))")
+		args = append(args, innerArgs...)
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// bookFilterConditions devuelve las condiciones del filtro sobre la tabla de
+// libros con alias ref.
+func bookFilterConditions(ref string, now time.Time, f CatalogFilter, skip string) ([]string, []interface{}) {
+	conds := []string{ref + ".release_date <= ?"}
+	args := []interface{}{now}
+	if f.GenreID != 0 && skip != "genre" {
+		conds = append(conds, ref+".id IN (SELECT bg.book_id FROM book_genres bg JOIN genres g ON g.id = bg.genre_id WHERE g.id = ? OR g.parent_id = ?)")
+		args = append(args, f.GenreID, f.GenreID)
+	}
+	if f.Tag != "" && skip != "tag" {
+		conds = append(conds, ref+".id IN (SELECT bt.book_id FROM book_tags bt JOIN tags t ON t.id = bt.tag_id WHERE t.name = ?)")
+		args = append(args, f.Tag)
+	}
+	if f.AuthorID != 0 && skip != "author" {
+		conds = append(conds, ref+".id IN (SELECT book_id FROM book_authors WHERE author_id = ?)")
+		args = append(args, f.AuthorID)
+	}
+	if f.SeriesID != 0 {
+		conds = append(conds, ref+".series_id = ?")
+		args = append(args, f.SeriesID)
+	}
+	if skip != "year" {
+		if f.YearFrom > 0 {
+			conds = append(conds, ref+".release_date >= ?")
+			args = append(args, time.Date(f.YearFrom, time.January, 1, 0, 0, 0, 0, time.Local))
+		}
+		if f.YearTo > 0 {
+			conds = append(conds, ref+".release_date < ?")
+			args = append(args, time.Date(f.YearTo+1, time.January, 1, 0, 0, 0, 0, time.Local))
+		}
+	}
+	if f.Available && skip != "available" {
+		conds = append(conds, availableCopies(ref)+" > 0")
+	}
+	if f.BookIDs != nil {
+		if len(f.BookIDs) == 0 {
+			conds = append(conds, "1 = 0")
+		} else {
+			conds = append(conds, ref+".id IN ("+placeholders(len(f.BookIDs))+")")
+			for _, id := range f.BookIDs {
+				args = append(args, id)
+			}
+		}
+	}
+	return conds, args
+}
+
+func (s *sqlBookStore) Browse(ctx context.Context, now time.Time, f CatalogFilter) (CatalogPage, error) {
+	var page CatalogPage
+	where, args := catalogConditions(now, f, "")
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM books"+where, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	var err error
+	if f.Sort == catalogSortRelevance && f.BookIDs != nil {
+		page.Books, err = s.browseByRelevance(ctx, where, args, f)
+	} else {
+		page.Books, err = s.browseByKey(ctx, where, args, f)
+	}
+	if err != nil {
+		return page, err
+	}
+	if len(page.Books) > f.Limit {
+		page.Books = page.Books[:f.Limit]
+		page.NextAfter = page.Books[f.Limit-1].ID
+	}
+	if f.CollapseSeries {
+		if err := s.countSeriesVolumes(ctx, now, page.Books); err != nil {
+			return page, err
+		}
+	}
+
+	page.Facets, err = s.catalogFacets(ctx, now, f)
+	return page, err
+}
+
+// countSeriesVolumes rellena SeriesCount con los volúmenes publicados de la
+// serie de cada libro.
+func (s *sqlBookStore) countSeriesVolumes(ctx context.Context, now time.Time, books []Book) error {
+	args := []interface{}{now}
+	for _, b := range books {
+		if b.SeriesID != 0 {
+			args = append(args, b.SeriesID)
+		}
+	}
+	if len(args) == 1 {
+		return nil
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT series_id, COUNT(*) FROM books WHERE release_date <= ? AND series_id IN ("+placeholders(len(args)-1)+") GROUP BY series_id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	counts := make(map[int]int)
+	for rows.Next() {
+		var seriesID, count int
+		if err := rows.Scan(&seriesID, &count); err != nil {
+			return err
+		}
+		counts[seriesID] = count
+	}
+	for i := range books {
+		books[i].SeriesCount = counts[books[i].SeriesID]
+	}
+	return rows.Err()
+}
+
+// browseByKey devuelve hasta f.Limit+1 libros ordenados por f.Sort que van
+// después del libro f.After. Si ese libro ya no existe, empieza desde el principio.
+func (s *sqlBookStore) browseByKey(ctx context.Context, where string, args []interface{}, f CatalogFilter) ([]Book, error) {
+	keys, desc := catalogSortKeys(f.Sort)
+	op, dir := ">", "ASC"
+	if desc {
+		op, dir = "<", "DESC"
+	}
+
+	if f.After > 0 {
+		var title, author string
+		var releaseAt time.Time
+		var loans int
+		err := s.db.QueryRowContext(ctx, "SELECT title, author, release_date, "+loanCount+" FROM books WHERE id = ?", f.After).Scan(&title, &author, &releaseAt, &loans)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil {
+			value := map[string]interface{}{"title": title, "author": author, "release_date": releaseAt, loanCount: loans, "id": f.After}
+			// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+			var alternatives []string
+			for i := range keys {
+				var parts []string
+				for j := 0; j < i; j++ {
+					parts = append(parts, keys[j]+" = ?")
+					args = append(args, value[keys[j]])
+				}
+				parts = append(parts, keys[i]+" "+op+" ?")
+				args = append(args, value[keys[i]])
+				alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+			}
+			where += " AND (" + strings.Join(alternatives, " OR ") + ")"
+		}
+	}
+
+	order := make([]string, len(keys))
+	for i, key := range keys {
+		order[i] = key + " " + dir
+	}
+	args = append(args, f.Limit+1)
+	return s.queryBooks(ctx, "SELECT "+bookColumns+" FROM books"+where+" ORDER BY "+strings.Join(order, ", ")+" LIMIT ?", args...)
+}
+
+// browseByRelevance devuelve hasta f.Limit+1 libros en el orden de
+// f.BookIDs, que ya viene ordenado por relevancia, después del libro f.After.
+func (s *sqlBookStore) browseByRelevance(ctx context.Context, where string, args []interface{}, f CatalogFilter) ([]Book, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM books"+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	matching := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		matching[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	start := 0
+	for i, id := range f.BookIDs {
+		if id == f.After {
+			start = i + 1
+			break
+		}
+	}
+	var ids []interface{}
+	rank := make(map[int]int)
+	for _, id := range f.BookIDs[start:] {
+		if len(ids) > f.Limit {
+			break
+		}
+		if matching[id] {
+			rank[id] = len(ids)
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	books, err := s.queryBooks(ctx, "SELECT "+bookColumns+" FROM books WHERE id IN ("+placeholders(len(ids))+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(books, func(i, j int) bool { return rank[books[i].ID] < rank[books[j].ID] })
+	return books, nil
+}
+
+// catalogFacets cuenta los libros por género, etiqueta, autor, año y
+// disponibilidad.
+func (s *sqlBookStore) catalogFacets(ctx context.Context, now time.Time, f CatalogFilter) (CatalogFacets, error) {
+	var facets CatalogFacets
+	var err error
+
+	// Cada género cuenta los libros enlazados con él o con sus subgéneros
+	where, args := catalogConditions(now, f, "genre")
+	facets.Genres, err = s.facetCounts(ctx, "SELECT g.id, COALESCE(g.parent_id, 0), g.name, COUNT(DISTINCT books.id) FROM genres g"+
+		" LEFT JOIN genres p ON p.id = g.parent_id JOIN genres sub ON sub.id = g.id OR sub.parent_id = g.id"+
+		" JOIN book_genres bg ON bg.genre_id = sub.id JOIN books ON books.id = bg.book_id"+where+
+		" GROUP BY g.id, g.parent_id, g.name, p.name ORDER BY COALESCE(p.name, g.name), CASE WHEN g.parent_id IS NULL THEN 0 ELSE 1 END, g.name", args)
+	if err != nil {
+		return facets, err
+	}
+	for i := range facets.Genres {
+		facets.Genres[i].Selected = facets.Genres[i].ID == f.GenreID
+	}
+
+	// Igual que con los autores, la etiqueta seleccionada aparece siempre
+	where, args = catalogConditions(now, f, "tag")
+	args = append(args, f.Tag, catalogTagFacets)
+	facets.Tags, err = s.facetCounts(ctx, "SELECT t.name, COUNT(*) FROM books JOIN book_tags bt ON bt.book_id = books.id JOIN tags t ON t.id = bt.tag_id"+where+
+		" GROUP BY t.id, t.name ORDER BY CASE WHEN t.name = ? THEN 0 ELSE 1 END, COUNT(*) DESC, t.name LIMIT ?", args)
+	if err != nil {
+		return facets, err
+	}
+	for i := range facets.Tags {
+		facets.Tags[i].Selected = f.Tag != "" && strings.EqualFold(facets.Tags[i].Value, f.Tag)
+	}
+
+	// El autor seleccionado aparece siempre, aunque no esté entre los primeros
+	where, args = catalogConditions(now, f, "author")
+	args = append(args, f.AuthorID, catalogAuthorFacets)
+	facets.Authors, err = s.facetCounts(ctx, "SELECT a.id, a.name, COUNT(*) FROM books JOIN book_authors ba ON ba.book_id = books.id JOIN authors a ON a.id = ba.author_id"+where+
+		" GROUP BY a.id, a.name ORDER BY CASE WHEN a.id = ? THEN 0 ELSE 1 END, COUNT(*) DESC, a.name LIMIT ?", args)
+	if err != nil {
+		return facets, err
+	}
+	for i := range facets.Authors {
+		facets.Authors[i].Selected = facets.Authors[i].ID == f.AuthorID
+	}
+
+	// Los años se agrupan en Go, en hora local, como el filtro
+	where, args = catalogConditions(now, f, "year")
+	rows, err := s.db.QueryContext(ctx, "SELECT books.release_date FROM books"+where, args...)
+	if err != nil {
+		return facets, err
+	}
+	years := make(map[int]int)
+	for rows.Next() {
+		var releaseAt time.Time
+		if err := rows.Scan(&releaseAt); err != nil {
+			rows.Close()
+			return facets, err
+		}
+		years[releaseAt.Local().Year()]++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return facets, err
+	}
+	for year, count := range years {
+		selected := (f.YearFrom > 0 || f.YearTo > 0) && (f.YearFrom == 0 || year >= f.YearFrom) && (f.YearTo == 0 || year <= f.YearTo)
+		facets.Years = append(facets.Years, FacetCount{Value: fmt.Sprint(year), Count: count, Selected: selected})
+	}
+	sort.Slice(facets.Years, func(i, j int) bool { return facets.Years[i].Value > facets.Years[j].Value })
+
+	where, args = catalogConditions(now, f, "available")
+	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM books"+where+" AND "+availableCopies("books")+" > 0", args...).Scan(&facets.Available)
+	return facets, err
+}
+
+// facetCounts lee filas (valor, recuento) o, si la consulta devuelve tres
+// columnas, (ID, valor, recuento), o con cuatro (ID, ID del padre, valor,
+// recuento).
+func (s *sqlBookStore) facetCounts(ctx context.Context, query string, args []interface{}) ([]FacetCount, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var counts []FacetCount
+	for rows.Next() {
+		var fc FacetCount
+		dest := []interface{}{&fc.Value, &fc.Count}
+		switch len(columns) {
+		case 3:
+			dest = append([]interface{}{&fc.ID}, dest...)
+		case 4:
+			dest = append([]interface{}{&fc.ID, &fc.ParentID}, dest...)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		counts = append(counts, fc)
+	}
+	return counts, rows.Err()
+}
+
+func (s *sqlBookStore) List(ctx context.Context, titleQuery string) ([]Book, error) {
+	if titleQuery != "" {
+		return s.queryBooks(ctx, "SELECT "+bookColumns+" FROM books WHERE title LIKE ? ORDER BY id DESC", "%"+titleQuery+"%")
+	}
+	return s.queryBooks(ctx, "SELECT "+bookColumns+" FROM books ORDER BY id DESC")
+}
+
+func (s *sqlBookStore) Get(ctx context.Context, id int) (Book, error) {
+	return s.getBook(ctx, "id = ?", id)
+}
+
+func (s *sqlBookStore) GetByTitle(ctx context.Context, title string) (Book, error) {
+	return s.getBook(ctx, "title = ?", title)
+}
+
+func (s *sqlBookStore) Count(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM books").Scan(&count)
+	return count, err
+}
+
+func (s *sqlBookStore) AdjacentVolumes(ctx context.Context, book Book) (*Book, *Book, error) {
+	if book.SeriesID == 0 {
+		return nil, nil, nil
+	}
+	volume := func(query string) (*Book, error) {
+		b, err := scanBook(s.db.QueryRowContext(ctx, "SELECT "+bookColumns+" FROM books WHERE series_id = ? AND "+query+" LIMIT 1", book.SeriesID, book.SeriesVolume))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &b, nil
+	}
+	prev, err := volume("series_volume < ? ORDER BY series_volume DESC")
+	if err != nil {
+		return nil, nil, err
+	}
+	next, err := volume("series_volume > ? ORDER BY series_volume")
+	if err != nil {
+		return nil, nil, err
+	}
+	return prev, next, nil
+}
+
+// checkSeriesVolume devuelve ErrVolumeTaken si otro libro distinto de bookID
+// ya es ese volumen de la serie.
+func checkSeriesVolume(ctx context.Context, tx *sqlTx, book Book) error {
+	if book.SeriesID == 0 {
+		return nil
+	}
+	var taken int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM books WHERE series_id = ? AND series_volume = ? AND id <> ?", book.SeriesID, book.SeriesVolume, book.ID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrVolumeTaken
+	}
+	return nil
+}
+
+// seriesArgs devuelve series_id y series_volume para guardarlos, NULL si el
+// libro no pertenece a ninguna serie.
+func seriesArgs(book Book) (sql.NullInt64, sql.NullInt64) {
+	if book.SeriesID == 0 {
+		return sql.NullInt64{}, sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(book.SeriesID), Valid: true}, sql.NullInt64{Int64: int64(book.SeriesVolume), Valid: true}
+}
+
+func (s *sqlBookStore) ListByAuthor(ctx context.Context, authorID int) ([]Book, error) {
+	return s.queryBooks(ctx, "SELECT "+bookColumns+" FROM books WHERE id IN (SELECT book_id FROM book_authors WHERE author_id = ?) ORDER BY release_date DESC, id DESC", authorID)
+}
+
+func (s *sqlBookStore) Create(ctx context.Context, book *Book) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkSeriesVolume(ctx, tx, *book); err != nil {
+		return err
+	}
+	seriesID, seriesVolume := seriesArgs(*book)
+	id, err := s.db.dialect.insert(ctx, tx, "INSERT INTO books (title, author, isbn, publisher, language, page_count, edition, series_id, series_volume, genre, description, cover_image_path, pdf_file_path, release_date) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		book.Title, "", book.ISBN, book.Publisher, book.Language, book.PageCount, book.Edition, seriesID, seriesVolume,
+		"", book.Description, book.CoverImagePath, book.PdfFilePath, book.ReleaseAt)
+	if err != nil {
+		return err
+	}
+	author, err := setBookAuthors(ctx, tx, int(id), book.Authors)
+	if err != nil {
+		return err
+	}
+	genre, err := setBookGenres(ctx, tx, int(id), book.Genres)
+	if err != nil {
+		return err
+	}
+	if err := setBookTags(ctx, tx, int(id), book.Tags); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE books SET author = ?, genre = ? WHERE id = ?", author, genre, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	book.ID = int(id)
+	book.Author = author
+	book.Genre = genre
+	return nil
+}
+
+func (s *sqlBookStore) Update(ctx context.Context, book Book) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM books WHERE id = ?", book.ID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrNotFound
+	}
+	// Actualizar rutas de archivos solo si se cargaron nuevos
+	if book.CoverImagePath != "" {
+		if _, err := tx.ExecContext(ctx, "UPDATE books SET cover_image_path = ? WHERE id = ?", book.CoverImagePath, book.ID); err != nil {
+			return err
+		}
+	}
+	if book.PdfFilePath != "" {
+		if _, err := tx.ExecContext(ctx, "UPDATE books SET pdf_file_path = ? WHERE id = ?", book.PdfFilePath, book.ID); err != nil {
+			return err
+		}
+	}
+	// Actualizar autores, géneros, etiquetas y metadatos
+	author, err := setBookAuthors(ctx, tx, book.ID, book.Authors)
+	if err != nil {
+		return err
+	}
+	genre, err := setBookGenres(ctx, tx, book.ID, book.Genres)
+	if err != nil {
+		return err
+	}
+	if err := setBookTags(ctx, tx, book.ID, book.Tags); err != nil {
+		return err
+	}
+	if err := checkSeriesVolume(ctx, tx, book); err != nil {
+		return err
+	}
+	seriesID, seriesVolume := seriesArgs(book)
+	_, err = tx.ExecContext(ctx, "UPDATE books SET title = ?, author = ?, isbn = ?, publisher = ?, language = ?, page_count = ?, edition = ?, series_id = ?, series_volume = ?, genre = ?, description = ?, release_date = ? WHERE id = ?",
+		book.Title, author, book.ISBN, book.Publisher, book.Language, book.PageCount, book.Edition, seriesID, seriesVolume, genre, book.Description, book.ReleaseAt, book.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlBookStore) Delete(ctx context.Context, id int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM books WHERE id = ?", id)
+	return err
+}
+
+// --- Autores ---
+
+func (s *sqlAuthorStore) List(ctx context.Context) ([]Author, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT a.id, a.name, (SELECT COUNT(*) FROM book_authors ba WHERE ba.author_id = a.id) FROM authors a ORDER BY a.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var authors []Author
+	for rows.Next() {
+		var a Author
+		if err := rows.Scan(&a.ID, &a.Name, &a.BookCount); err != nil {
+			return nil, err
+		}
+		authors = append(authors, a)
+	}
+	return authors, rows.Err()
+}
+
+func (s *sqlAuthorStore) Get(ctx context.Context, id int) (Author, error) {
+	var a Author
+	err := s.db.QueryRowContext(ctx, "SELECT id, name FROM authors WHERE id = ?", id).Scan(&a.ID, &a.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, ErrNotFound
+	}
+	return a, err
+}
+
+func (s *sqlAuthorStore) FindOrCreate(ctx context.Context, name string) (Author, error) {
+	a := Author{Name: name}
+	// La comparación no distingue mayúsculas por la intercalación de la columna
+	err := s.db.QueryRowContext(ctx, "SELECT id, name FROM authors WHERE name = ?", name).Scan(&a.ID, &a.Name)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return a, err
+	}
+	// Otra petición puede haberlo creado desde la consulta
+	id, err := s.db.dialect.insertOrGetID(ctx, s.db, "authors", "name", "INSERT INTO authors (name) VALUES (?)", name)
+	if err != nil {
+		return a, err
+	}
+	return s.Get(ctx, int(id))
+}
+
+// --- Series ---
+
+func (s *sqlSeriesStore) List(ctx context.Context) ([]Series, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name FROM series ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var series []Series
+	for rows.Next() {
+		var sr Series
+		if err := rows.Scan(&sr.ID, &sr.Name); err != nil {
+			return nil, err
+		}
+		series = append(series, sr)
+	}
+	return series, rows.Err()
+}
+
+func (s *sqlSeriesStore) FindOrCreate(ctx context.Context, name string) (Series, error) {
+	sr := Series{Name: name}
+	// La comparación no distingue mayúsculas por la intercalación de la columna
+	err := s.db.QueryRowContext(ctx, "SELECT id, name FROM series WHERE name = ?", name).Scan(&sr.ID, &sr.Name)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return sr, err
+	}
+	// Otra petición puede haberla creado desde la consulta
+	id, err := s.db.dialect.insertOrGetID(ctx, s.db, "series", "name", "INSERT INTO series (name) VALUES (?)", name)
+	if err != nil {
+		return sr, err
+	}
+	err = s.db.QueryRowContext(ctx, "SELECT id, name FROM series WHERE id = ?", id).Scan(&sr.ID, &sr.Name)
+	return sr, err
+}
+
+// --- Géneros ---
+
+func (s *sqlGenreStore) List(ctx context.Context) ([]Genre, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT g.id, g.name, COALESCE(g.parent_id, 0), COALESCE(p.name, ''), (SELECT COUNT(*) FROM book_genres bg WHERE bg.genre_id = g.id)"+
+		" FROM genres g LEFT JOIN genres p ON p.id = g.parent_id ORDER BY COALESCE(p.name, g.name), CASE WHEN g.parent_id IS NULL THEN 0 ELSE 1 END, g.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var genres []Genre
+	for rows.Next() {
+		var count int
+		g, err := scanGenre(rows, &count)
+		if err != nil {
+			return nil, err
+		}
+		g.BookCount = count
+		genres = append(genres, g)
+	}
+	return genres, rows.Err()
+}
+
+func (s *sqlGenreStore) Get(ctx context.Context, id int) (Genre, error) {
+	return getGenre(ctx, s.db, id)
+}
+
+// getGenre lee un género, dentro o fuera de una transacción.
+func getGenre(ctx context.Context, q execQueryer, id int) (Genre, error) {
+	g, err := scanGenre(q.QueryRowContext(ctx, genreSelect+" WHERE g.id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return g, ErrNotFound
+	}
+	return g, err
+}
+
+func (s *sqlGenreStore) FindOrCreate(ctx context.Context, name string, parentID int) (Genre, error) {
+	// La comparación no distingue mayúsculas por la intercalación de la columna
+	g, err := scanGenre(s.db.QueryRowContext(ctx, genreSelect+" WHERE g.name = ?", name))
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return g, err
+	}
+	// Otra petición puede haberlo creado desde la consulta
+	id, err := s.db.dialect.insertOrGetID(ctx, s.db, "genres", "name", "INSERT INTO genres (name, parent_id) VALUES (?, ?)", name, genreParentArg(parentID))
+	if err != nil {
+		return Genre{Name: name, ParentID: parentID}, err
+	}
+	return getGenre(ctx, s.db, int(id))
+}
+
+// genreParentArg devuelve parent_id para guardarlo, NULL en un género principal.
+func genreParentArg(parentID int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(parentID), Valid: parentID != 0}
+}
+
+// checkGenre comprueba que el nombre del género no esté ocupado por otro y
+// que su género principal exista y no sea a su vez un subgénero.
+func checkGenre(ctx context.Context, tx *sqlTx, genre Genre) error {
+	var taken int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM genres WHERE name = ? AND id <> ?", genre.Name, genre.ID).Scan(&taken); err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrGenreExists
+	}
+	if genre.ParentID == 0 {
+		return nil
+	}
+	if genre.ParentID == genre.ID {
+		return ErrGenreHierarchy
+	}
+	parent, err := getGenre(ctx, tx, genre.ParentID)
+	if errors.Is(err, ErrNotFound) {
+		return ErrUnknownGenre
+	}
+	if err != nil {
+		return err
+	}
+	if parent.ParentID != 0 {
+		return ErrGenreHierarchy
+	}
+	return nil
+}
+
+func (s *sqlGenreStore) Create(ctx context.Context, genre *Genre) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkGenre(ctx, tx, *genre); err != nil {
+		return err
+	}
+	id, err := s.db.dialect.insert(ctx, tx, "INSERT INTO genres (name, parent_id) VALUES (?, ?)", genre.Name, genreParentArg(genre.ParentID))
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	genre.ID = int(id)
+	return nil
+}
+
+func (s *sqlGenreStore) Update(ctx context.Context, genre Genre) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := getGenre(ctx, tx, genre.ID); err != nil {
+		return err
+	}
+	if err := checkGenre(ctx, tx, genre); err != nil {
+		return err
+	}
+	if genre.ParentID != 0 {
+		var children int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM genres WHERE parent_id = ?", genre.ID).Scan(&children); err != nil {
+			return err
+		}
+		if children > 0 {
+			return ErrGenreHierarchy
+		}
+	}
+	// Los libros de los subgéneros también muestran el nombre del género
+	bookIDs, err := genreBookIDs(ctx, tx, genre.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE genres SET name = ?, parent_id = ? WHERE id = ?", genre.Name, genreParentArg(genre.ParentID), genre.ID); err != nil {
+		return err
+	}
+	if err := syncBookGenreText(ctx, tx, bookIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlGenreStore) Merge(ctx context.Context, sourceID, targetID int) error {
+	if sourceID == targetID {
+		return ErrGenreHierarchy
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := getGenre(ctx, tx, sourceID); err != nil {
+		return err
+	}
+	target, err := getGenre(ctx, tx, targetID)
+	if err != nil {
+		return err
+	}
+	// Los subgéneros de sourceID pasan a targetID, que debe poder tenerlos
+	var children int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM genres WHERE parent_id = ?", sourceID).Scan(&children); err != nil {
+		return err
+	}
+	if target.ParentID == sourceID || (children > 0 && target.ParentID != 0) {
+		return ErrGenreHierarchy
+	}
+
+	bookIDs, err := genreBookIDs(ctx, tx, sourceID)
+	if err != nil {
+		return err
+	}
+	// Cada libro de sourceID pasa a targetID en la misma posición, salvo que ya
+	// lo tuviera
+	for _, bookID := range bookIDs {
+		var linked int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM book_genres WHERE book_id = ? AND genre_id = ?", bookID, targetID).Scan(&linked); err != nil {
+			return err
+		}
+		query := "UPDATE book_genres SET genre_id = ? WHERE book_id = ? AND genre_id = ?"
+		args := []interface{}{targetID, bookID, sourceID}
+		if linked > 0 {
+			query, args = "DELETE FROM book_genres WHERE book_id = ? AND genre_id = ?", args[1:]
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE genres SET parent_id = ? WHERE parent_id = ?", targetID, sourceID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM genres WHERE id = ?", sourceID); err != nil {
+		return err
+	}
+	if err := syncBookGenreText(ctx, tx, bookIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// genreBookIDs devuelve los libros enlazados con el género o con sus subgéneros.
+func genreBookIDs(ctx context.Context, tx *sqlTx, genreID int) ([]int, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT DISTINCT bg.book_id FROM book_genres bg JOIN genres g ON g.id = bg.genre_id WHERE g.id = ? OR g.parent_id = ?", genreID, genreID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// syncBookGenreText recalcula books.genre de los libros indicados.
+func syncBookGenreText(ctx context.Context, tx *sqlTx, bookIDs []int) error {
+	for _, id := range bookIDs {
+		genre, err := bookGenreText(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE books SET genre = ? WHERE id = ?", genre, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- Usuarios ---
+
+const userColumns = "id, username, name, email, password, role, created_at, max_active_loans"
+
+func scanUser(s rowScanner) (User, error) {
+	var user User
+	err := s.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.MaxActiveLoans)
+	return user, err
+}
+
+func (s *sqlUserStore) getUser(ctx context.Context, where string, arg interface{}) (User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE "+where, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (s *sqlUserStore) List(ctx context.Context) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = "" // El hash nunca sale del store en los listados
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlUserStore) Get(ctx context.Context, id int) (User, error) {
+	user, err := s.getUser(ctx, "id = ?", id)
+	user.Password = ""
+	return user, err
+}
+
+func (s *sqlUserStore) GetByUsername(ctx context.Context, username string) (User, error) {
+	return s.getUser(ctx, "username = ?", username)
+}
+
+func (s *sqlUserStore) Count(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+	return count, err
+}
+
+func (s *sqlUserStore) Create(ctx context.Context, user *User) error {
+	id, err := s.db.dialect.insert(ctx, s.db, "INSERT INTO users (username, name, email, password, role, max_active_loans) VALUES (?, ?, ?, ?, ?, ?)",
+		user.Username, user.Name, user.Email, user.Password, user.Role, user.MaxActiveLoans)
+	if err != nil {
+		return err
+	}
+	user.ID = int(id)
+	return nil
+}
+
+func (s *sqlUserStore) Update(ctx context.Context, user User) error {
+	if user.Password != "" {
+		_, err := s.db.ExecContext(ctx, "UPDATE users SET username = ?, name = ?, email = ?, password = ?, role = ?, max_active_loans = ? WHERE id = ?",
+			user.Username, user.Name, user.Email, user.Password, user.Role, user.MaxActiveLoans, user.ID)
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET username = ?, name = ?, email = ?, role = ?, max_active_loans = ? WHERE id = ?",
+		user.Username, user.Name, user.Email, user.Role, user.MaxActiveLoans, user.ID)
+	return err
+}
+
+func (s *sqlUserStore) SetPassword(ctx context.Context, username, passwordHash string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET password = ? WHERE username = ?", passwordHash, username)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlUserStore) Delete(ctx context.Context, id int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	return err
+}
+
+// --- Préstamos ---
+
+func (s *sqlLoanStore) Create(ctx context.Context, userID, bookID int, loanDate, dueDate time.Time, maxActive int) error {
+	return s.create(ctx, userID, bookID, loanDate, dueDate, maxActive, false)
+}
+
+func (s *sqlLoanStore) CreateFromPreorder(ctx context.Context, userID, bookID int, loanDate, dueDate time.Time, maxActive int) error {
+	return s.create(ctx, userID, bookID, loanDate, dueDate, maxActive, true)
+}
+
+// create registra el préstamo. Salvo fromPreorder, no presta mientras queden
+// preventas del libro sin intentar atender: al publicarse, las copias son
+// primero para quienes lo reservaron en preventa.
+func (s *sqlLoanStore) create(ctx context.Context, userID, bookID int, loanDate, dueDate time.Time, maxActive int, fromPreorder bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Asegurarse de hacer rollback si algo falla
+
+	// Bloquear la fila del usuario serializa sus préstamos simultáneos, de modo
+	// que el límite de préstamos activos no se pueda superar en una carrera
+	var lockedID int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = ?"+s.db.dialect.forUpdate, userID).Scan(&lockedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var releaseAt time.Time
+	err = tx.QueryRowContext(ctx, "SELECT release_date FROM books WHERE id = ?", bookID).Scan(&releaseAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if releaseAt.After(loanDate) {
+		return ErrNotReleased
+	}
+	if !fromPreorder {
+		var pending int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM preorders WHERE book_id = ? AND status = 'pending' AND processed_at IS NULL", bookID).Scan(&pending)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrPreordersPending
+		}
+	}
+
+	// Verificar si ya existe un préstamo ACTIVO para este usuario y libro
+	var activeLoanCount int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM loans WHERE user_id = ? AND book_id = ? AND status = 'active'", userID, bookID).Scan(&activeLoanCount)
+	if err != nil {
+		return err
+	}
+	if activeLoanCount > 0 {
+		return ErrAlreadyLoaned
+	}
+
+	if maxActive > 0 {
+		var userActive int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM loans WHERE user_id = ? AND status = 'active'", userID).Scan(&userActive)
+		if err != nil {
+			return err
+		}
+		if userActive >= maxActive {
+			return ErrLoanLimit
+		}
+	}
+
+	// Si el usuario tiene una copia apartada por su reserva, el préstamo usa esa
+	// copia; si no, toma una disponible
+	copyID, err := claimReservedCopy(ctx, tx, userID, bookID, loanDate)
+	if err != nil {
+		return err
+	}
+	if copyID == 0 {
+		copyID, err = claimAvailableCopy(ctx, tx, s.db.dialect, bookID, loanDate, "loaned")
+		if err != nil {
+			return err
+		}
+		// Una reserva en cola del mismo usuario queda atendida con este préstamo
+		if _, err := tx.ExecContext(ctx, "UPDATE holds SET status = 'fulfilled' WHERE user_id = ? AND book_id = ? AND status = 'waiting'", userID, bookID); err != nil {
+			return err
+		}
+	}
+	// Cada préstamo consume uno de los préstamos de la licencia (NULL no cambia)
+	_, err = tx.ExecContext(ctx, "UPDATE copies SET licence_loans_remaining = licence_loans_remaining - 1 WHERE id = ?", copyID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO loans (user_id, book_id, copy_id, status, loan_date, due_date) VALUES (?, ?, ?, 'active', ?, ?)", userID, bookID, copyID, loanDate, dueDate)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// claimReservedCopy atiende la reserva apartada y vigente del usuario para el
+// libro y pasa su copia a prestada. Devuelve 0 si no tiene ninguna.
+func claimReservedCopy(ctx context.Context, tx *sqlTx, userID, bookID int, now time.Time) (int, error) {
+	var holdID int
+	var copyID sql.NullInt64
+	err := tx.QueryRowContext(ctx, "SELECT id, copy_id FROM holds WHERE user_id = ? AND book_id = ? AND status = 'ready' AND expires_at > ?", userID, bookID, now).Scan(&holdID, &copyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	// La condición sobre status evita usar dos veces la misma copia apartada
+	res, err := tx.ExecContext(ctx, "UPDATE holds SET status = 'fulfilled' WHERE id = ? AND status = 'ready'", holdID)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return 0, err
+	}
+	if !copyID.Valid {
+		return 0, nil // Apartada sin copia concreta: se toma una disponible
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE copies SET status = 'loaned' WHERE id = ?", copyID.Int64)
+	return int(copyID.Int64), err
+}
+
+// claimAvailableCopy pasa al estado status (loaned o reserved) una copia
+// disponible y con licencia vigente del libro. Devuelve ErrNoStock si no hay
+// ninguna.
+func claimAvailableCopy(ctx context.Context, tx *sqlTx, d *dialect, bookID int, now time.Time, status string) (int, error) {
+	for {
+		var copyID int
+		err := tx.QueryRowContext(ctx, "SELECT id FROM copies WHERE book_id = ? AND status = 'available' AND (licence_expires_at IS NULL OR licence_expires_at > ?) ORDER BY id LIMIT 1"+d.forUpdate, bookID, now).Scan(&copyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoStock
+		}
+		if err != nil {
+			return 0, err
+		}
+		// La condición sobre status evita usar dos veces la misma copia
+		res, err := tx.ExecContext(ctx, "UPDATE copies SET status = ? WHERE id = ? AND status = 'available'", status, copyID)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := res.RowsAffected(); err != nil || n > 0 {
+			return copyID, err
+		}
+	}
+}
+
+func (s *sqlLoanStore) Return(ctx context.Context, userID, bookID int, returnDate time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var loan Loan
+	// Selecciona el préstamo más reciente activo para ese user_id y book_id
+	err = tx.QueryRowContext(ctx, "SELECT id, book_id, copy_id FROM loans WHERE user_id = ? AND book_id = ? AND status = 'active' ORDER BY loan_date DESC LIMIT 1", userID, bookID).
+		Scan(&loan.ID, &loan.BookID, &loan.CopyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoActiveLoan
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := closeLoan(ctx, tx, loan, "returned", returnDate, s.holdPickupWindow); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlLoanStore) Renew(ctx context.Context, userID, bookID int, now time.Time, extension time.Duration, maxRenewals int) (time.Time, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	var loanID, renewalCount int
+	var dueDate time.Time
+	err = tx.QueryRowContext(ctx, "SELECT id, due_date, renewal_count FROM loans WHERE user_id = ? AND book_id = ? AND status = 'active' ORDER BY loan_date DESC LIMIT 1", userID, bookID).
+		Scan(&loanID, &dueDate, &renewalCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrNoActiveLoan
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Un préstamo vencido que aún no ha expirado ya no se puede renovar
+	if !dueDate.After(now) {
+		return time.Time{}, ErrNoActiveLoan
+	}
+	if renewalCount >= maxRenewals {
+		return time.Time{}, ErrRenewalLimit
+	}
+	var waiting int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM holds WHERE book_id = ? AND status = 'waiting'", bookID).Scan(&waiting)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if waiting > 0 {
+		return time.Time{}, ErrHoldsPending
+	}
+
+	newDueDate := dueDate.Add(extension)
+	// La condición sobre renewal_count evita superar el límite con renovaciones simultáneas
+	res, err := tx.ExecContext(ctx, "UPDATE loans SET due_date = ?, renewal_count = renewal_count + 1 WHERE id = ? AND status = 'active' AND renewal_count < ?", newDueDate, loanID, maxRenewals)
+	if err != nil {
+		return time.Time{}, err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if rowsAffected == 0 {
+		return time.Time{}, ErrRenewalLimit
+	}
+	return newDueDate, tx.Commit()
+}
+
+// closeLoan da por terminado un préstamo activo con el estado indicado y libera
+// su copia con releaseCopy. Debe ejecutarse dentro de la transacción del
+// llamador para que ambos cambios se apliquen juntos.
+func closeLoan(ctx context.Context, tx *sqlTx, loan Loan, status string, at time.Time, pickupWindow time.Duration) error {
+	// La condición sobre status evita devolver dos veces el mismo préstamo
+	res, err := tx.ExecContext(ctx, "UPDATE loans SET status = ?, return_date = ? WHERE id = ? AND status = 'active'", status, at, loan.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNoActiveLoan
+	}
+	if !loan.CopyID.Valid {
+		return nil // Préstamo sin copia (borrada): no hay nada que liberar
+	}
+	return releaseCopy(ctx, tx, int(loan.CopyID.Int64), at, pickupWindow)
+}
+
+// releaseCopy devuelve una copia que deja de estar prestada o apartada. Si su
+// licencia se agotó o venció en at la retira; si no, la aparta para la reserva
+// en cola más antigua hasta at+pickupWindow o la deja disponible.
+func releaseCopy(ctx context.Context, tx *sqlTx, copyID int, at time.Time, pickupWindow time.Duration) error {
+	var c Copy
+	err := tx.QueryRowContext(ctx, "SELECT id, book_id, licence_loans_remaining, licence_expires_at FROM copies WHERE id = ?", copyID).
+		Scan(&c.ID, &c.BookID, &c.LicenceLoansRemaining, &c.LicenceExpiresAt)
+	if err != nil {
+		return err
+	}
+	if licenceExhausted(c, at) {
+		_, err = tx.ExecContext(ctx, "UPDATE copies SET status = 'retired', retired_at = ? WHERE id = ?", at, c.ID)
+		return err
+	}
+
+	for {
+		var holdID int
+		err := tx.QueryRowContext(ctx, "SELECT id FROM holds WHERE book_id = ? AND status = 'waiting' ORDER BY created_at, id LIMIT 1", c.BookID).Scan(&holdID)
+		if errors.Is(err, sql.ErrNoRows) {
+			_, err = tx.ExecContext(ctx, "UPDATE copies SET status = 'available' WHERE id = ?", c.ID)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		// La condición sobre status evita apartar dos copias para la misma reserva
+		res, err := tx.ExecContext(ctx, "UPDATE holds SET status = 'ready', copy_id = ?, ready_at = ?, expires_at = ? WHERE id = ? AND status = 'waiting'", c.ID, at, at.Add(pickupWindow), holdID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n > 0 {
+			_, err = tx.ExecContext(ctx, "UPDATE copies SET status = 'reserved' WHERE id = ?", c.ID)
+			return err
+		}
+	}
+}
+
+// licenceExhausted indica si la licencia de la copia ya no admite préstamos en at.
+func licenceExhausted(c Copy, at time.Time) bool {
+	if c.LicenceLoansRemaining.Valid && c.LicenceLoansRemaining.Int64 <= 0 {
+		return true
+	}
+	return c.LicenceExpiresAt.Valid && !c.LicenceExpiresAt.Time.After(at)
+}
+
+func (s *sqlLoanStore) ExpireOverdue(ctx context.Context, now time.Time) ([]Loan, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, user_id, book_id, copy_id, loan_date, due_date FROM loans WHERE status = 'active' AND due_date <= ? ORDER BY due_date", now)
+	if err != nil {
+		return nil, err
+	}
+	var overdue []Loan
+	for rows.Next() {
+		var loan Loan
+		if err := rows.Scan(&loan.ID, &loan.UserID, &loan.BookID, &loan.CopyID, &loan.LoanDate, &loan.DueDate); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		overdue = append(overdue, loan)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Cada préstamo se cierra en su propia transacción, igual que una devolución
+	var expired []Loan
+	for _, loan := range overdue {
+		err := s.expire(ctx, loan, now)
+		if errors.Is(err, ErrNoActiveLoan) {
+			continue // Se devolvió mientras tanto
+		}
+		if err != nil {
+			return expired, err
+		}
+		loan.Status = "expired"
+		loan.ReturnDate = sql.NullTime{Time: now, Valid: true}
+		expired = append(expired, loan)
+	}
+	return expired, nil
+}
+
+func (s *sqlLoanStore) expire(ctx context.Context, loan Loan, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := closeLoan(ctx, tx, loan, "expired", now, s.holdPickupWindow); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlLoanStore) HasActive(ctx context.Context, userID, bookID int) (bool, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM loans WHERE user_id = ? AND book_id = ? AND status = 'active'", userID, bookID).Scan(&count)
+	return count > 0, err
+}
+
+func (s *sqlLoanStore) CountActiveByUser(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM loans WHERE user_id = ? AND status = 'active'", userID).Scan(&count)
+	return count, err
+}
+
+func (s *sqlLoanStore) ListByUser(ctx context.Context, userID int) ([]Loan, error) {
+	query := `
+        SELECT
+            l.id, l.user_id, l.book_id, l.copy_id,
+            b.id, b.title, b.author, b.cover_image_path, b.pdf_file_path,
+            l.loan_date,
+            l.due_date,
+            l.return_date,
+            l.renewal_count,
+            l.status
+        FROM
+            loans l
+        JOIN
+            books b ON l.book_id = b.id
+        WHERE
+            l.user_id = ?
+        ORDER BY
+            l.loan_date DESC
+    `
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var loans []Loan
+	for rows.Next() {
+		var loan Loan
+		err := rows.Scan(
+			&loan.ID, &loan.UserID, &loan.BookID, &loan.CopyID,
+			&loan.Book.ID, &loan.Book.Title, &loan.Book.Author, &loan.Book.CoverImagePath, &loan.Book.PdfFilePath,
+			&loan.LoanDate,
+			&loan.DueDate,
+			&loan.ReturnDate,
+			&loan.RenewalCount,
+			&loan.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+		loans = append(loans, loan)
+	}
+	return loans, rows.Err()
+}
+
+func (s *sqlLoanStore) Count(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM loans").Scan(&count)
+	return count, err
+}
+
+// --- Reservas ---
+
+// holdColumns incluye la posición en la cola, que solo tiene sentido para las
+// reservas en estado waiting.
+var holdColumns = `h.id, h.user_id, h.book_id, h.status, h.created_at, h.ready_at, h.expires_at,
+	(SELECT COUNT(*) FROM holds q WHERE q.book_id = h.book_id AND q.status = 'waiting'
+		AND (q.created_at < h.created_at OR (q.created_at = h.created_at AND q.id <= h.id))),
+	b.id, b.title, b.author, b.cover_image_path, ` + availableCopies("b")
+
+func scanHold(s rowScanner) (Hold, error) {
+	var h Hold
+	err := s.Scan(&h.ID, &h.UserID, &h.BookID, &h.Status, &h.CreatedAt, &h.ReadyAt, &h.ExpiresAt, &h.Position,
+		&h.Book.ID, &h.Book.Title, &h.Book.Author, &h.Book.CoverImagePath, &h.Book.Stock)
+	return h, err
+}
+
+func (s *sqlHoldStore) Create(ctx context.Context, userID, bookID int, now time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var stock int
+	err = tx.QueryRowContext(ctx, "SELECT "+availableCopies("books")+" FROM books WHERE id = ?", bookID).Scan(&stock)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if stock > 0 {
+		return 0, ErrStockAvailable
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM loans WHERE user_id = ? AND book_id = ? AND status = 'active'", userID, bookID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, ErrAlreadyLoaned
+	}
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM holds WHERE user_id = ? AND book_id = ? AND status IN ('waiting', 'ready')", userID, bookID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, ErrAlreadyOnHold
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO holds (user_id, book_id, status, created_at) VALUES (?, ?, 'waiting', ?)", userID, bookID, now); err != nil {
+		return 0, err
+	}
+	var position int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM holds WHERE book_id = ? AND status = 'waiting'", bookID).Scan(&position)
+	if err != nil {
+		return 0, err
+	}
+	return position, tx.Commit()
+}
+
+func (s *sqlHoldStore) Cancel(ctx context.Context, userID, holdID int, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var copyID sql.NullInt64
+	var status string
+	err = tx.QueryRowContext(ctx, "SELECT copy_id, status FROM holds WHERE id = ? AND user_id = ? AND status IN ('waiting', 'ready')", holdID, userID).Scan(&copyID, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE holds SET status = 'cancelled' WHERE id = ? AND status = ?", holdID, status)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	// La copia apartada pasa a la siguiente reserva o vuelve al stock
+	if status == "ready" && copyID.Valid {
+		if err := releaseCopy(ctx, tx, int(copyID.Int64), now, s.holdPickupWindow); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlHoldStore) ListByUser(ctx context.Context, userID int) ([]Hold, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+holdColumns+" FROM holds h JOIN books b ON h.book_id = b.id WHERE h.user_id = ? AND h.status IN ('waiting', 'ready') ORDER BY h.created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []Hold
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+func (s *sqlHoldStore) GetActive(ctx context.Context, userID, bookID int) (Hold, error) {
+	hold, err := scanHold(s.db.QueryRowContext(ctx, "SELECT "+holdColumns+" FROM holds h JOIN books b ON h.book_id = b.id WHERE h.user_id = ? AND h.book_id = ? AND h.status IN ('waiting', 'ready')", userID, bookID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Hold{}, ErrNotFound
+	}
+	return hold, err
+}
+
+func (s *sqlHoldStore) CountWaiting(ctx context.Context, bookID int) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM holds WHERE book_id = ? AND status = 'waiting'", bookID).Scan(&count)
+	return count, err
+}
+
+func (s *sqlHoldStore) ExpireReady(ctx context.Context, now time.Time) ([]Hold, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, user_id, book_id, copy_id FROM holds WHERE status = 'ready' AND expires_at <= ? ORDER BY expires_at", now)
+	if err != nil {
+		return nil, err
+	}
+	var overdue []Hold
+	for rows.Next() {
+		var hold Hold
+		if err := rows.Scan(&hold.ID, &hold.UserID, &hold.BookID, &hold.CopyID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		overdue = append(overdue, hold)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var expired []Hold
+	for _, hold := range overdue {
+		ok, err := s.expire(ctx, hold, now)
+		if err != nil {
+			return expired, err
+		}
+		if ok {
+			hold.Status = "expired"
+			expired = append(expired, hold)
+		}
+	}
+	return expired, nil
+}
+
+// expire marca una reserva apartada como no recogida y pasa su copia a la
+// siguiente de la cola en la misma transacción.
+func (s *sqlHoldStore) expire(ctx context.Context, hold Hold, now time.Time) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE holds SET status = 'expired' WHERE id = ? AND status = 'ready'", hold.ID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err // Se recogió o canceló mientras tanto
+	}
+	if hold.CopyID.Valid {
+		if err := releaseCopy(ctx, tx, int(hold.CopyID.Int64), now, s.holdPickupWindow); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// --- Copias y licencias ---
+
+const copyColumns = "id, book_id, status, acquired_at, licence_loans_remaining, licence_expires_at, retired_at"
+
+func scanCopy(s rowScanner) (Copy, error) {
+	var c Copy
+	err := s.Scan(&c.ID, &c.BookID, &c.Status, &c.AcquiredAt, &c.LicenceLoansRemaining, &c.LicenceExpiresAt, &c.RetiredAt)
+	return c, err
+}
+
+func (s *sqlCopyStore) queryCopies(ctx context.Context, query string, args ...interface{}) ([]Copy, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var copies []Copy
+	for rows.Next() {
+		c, err := scanCopy(rows)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, c)
+	}
+	return copies, rows.Err()
+}
+
+func (s *sqlCopyStore) ListByBook(ctx context.Context, bookID int) ([]Copy, error) {
+	return s.queryCopies(ctx, "SELECT "+copyColumns+" FROM copies WHERE book_id = ? ORDER BY id", bookID)
+}
+
+func (s *sqlCopyStore) Add(ctx context.Context, c Copy, count int, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var bookID int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM books WHERE id = ?", c.BookID).Scan(&bookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		// Se crea prestada para que releaseCopy decida si se aparta o queda disponible
+		id, err := s.db.dialect.insert(ctx, tx, "INSERT INTO copies (book_id, status, acquired_at, licence_loans_remaining, licence_expires_at) VALUES (?, 'loaned', ?, ?, ?)",
+			c.BookID, c.AcquiredAt, c.LicenceLoansRemaining, c.LicenceExpiresAt)
+		if err != nil {
+			return err
+		}
+		if err := releaseCopy(ctx, tx, int(id), now, s.holdPickupWindow); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlCopyStore) Retire(ctx context.Context, bookID, copyID int, now time.Time) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE copies SET status = 'retired', retired_at = ? WHERE id = ? AND book_id = ? AND status = 'available'", now, copyID, bookID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	var status string
+	err = s.db.QueryRowContext(ctx, "SELECT status FROM copies WHERE id = ? AND book_id = ?", copyID, bookID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) || status == "retired" {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return ErrCopyInUse
+}
+
+func (s *sqlCopyStore) RetireExpired(ctx context.Context, now time.Time) ([]Copy, error) {
+	expiring, err := s.queryCopies(ctx, "SELECT "+copyColumns+" FROM copies WHERE status IN ('available', 'reserved') AND licence_expires_at <= ? ORDER BY licence_expires_at", now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cada copia se retira en su propia transacción
+	var retired []Copy
+	for _, c := range expiring {
+		ok, err := s.retireExpired(ctx, c, now)
+		if err != nil {
+			return retired, err
+		}
+		if ok {
+			c.Status = "retired"
+			c.RetiredAt = sql.NullTime{Time: now, Valid: true}
+			retired = append(retired, c)
+		}
+	}
+	return retired, nil
+}
+
+// retireExpired retira una copia con la licencia vencida. Si estaba apartada,
+// la reserva recibe otra copia disponible o vuelve a la cola; como conserva su
+// fecha, sigue siendo la primera.
+func (s *sqlCopyStore) retireExpired(ctx context.Context, c Copy, now time.Time) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE copies SET status = 'retired', retired_at = ? WHERE id = ? AND status = ?", now, c.ID, c.Status)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err // Cambió de estado mientras tanto
+	}
+
+	if c.Status == "reserved" {
+		var holdID int
+		err := tx.QueryRowContext(ctx, "SELECT id FROM holds WHERE copy_id = ? AND status = 'ready'", c.ID).Scan(&holdID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return false, err
+		}
+		if err == nil {
+			newCopyID, err := claimAvailableCopy(ctx, tx, s.db.dialect, c.BookID, now, "reserved")
+			switch {
+			case err == nil:
+				_, err = tx.ExecContext(ctx, "UPDATE holds SET copy_id = ? WHERE id = ?", newCopyID, holdID)
+			case errors.Is(err, ErrNoStock):
+				_, err = tx.ExecContext(ctx, "UPDATE holds SET status = 'waiting', copy_id = NULL, ready_at = NULL, expires_at = NULL WHERE id = ?", holdID)
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, tx.Commit()
+}
+
+// --- Conciliación de inventario ---
+
+func (s *sqlInventoryStore) Reconcile(ctx context.Context, now time.Time, fix bool) ([]BookInventory, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, title FROM books ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	var books []BookInventory
+	for rows.Next() {
+		var inv BookInventory
+		if err := rows.Scan(&inv.BookID, &inv.Title); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		books = append(books, inv)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range books {
+		if err := s.reconcileBook(ctx, &books[i], now, fix); err != nil {
+			return books[:i], fmt.Errorf("libro %d: %w", books[i].BookID, err)
+		}
+	}
+	return books, nil
+}
+
+// reconcileBook compara las copias del libro con sus préstamos activos y sus
+// reservas. Sin fix la transacción se descarta, así que solo informa.
+func (s *sqlInventoryStore) reconcileBook(ctx context.Context, inv *BookInventory, now time.Time, fix bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	copies := make(map[int]Copy)
+	var copyOrder []int
+	rows, err := tx.QueryContext(ctx, "SELECT "+copyColumns+" FROM copies WHERE book_id = ? AND status <> 'retired' ORDER BY id", inv.BookID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		c, err := scanCopy(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		copies[c.ID] = c
+		copyOrder = append(copyOrder, c.ID)
+		inv.Capacity++
+		switch c.Status {
+		case "available":
+			inv.Available++
+		case "loaned":
+			inv.LoanedCopies++
+		case "reserved":
+			inv.ReservedCopies++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	type ref struct {
+		id     int
+		status string
+		copyID sql.NullInt64
+	}
+	queryRefs := func(query string) ([]ref, error) {
+		rows, err := tx.QueryContext(ctx, query, inv.BookID)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var refs []ref
+		for rows.Next() {
+			var r ref
+			if err := rows.Scan(&r.id, &r.status, &r.copyID); err != nil {
+				return nil, err
+			}
+			refs = append(refs, r)
+		}
+		return refs, rows.Err()
+	}
+	loans, err := queryRefs("SELECT id, status, copy_id FROM loans WHERE book_id = ? AND status = 'active' ORDER BY loan_date, id")
+	if err != nil {
+		return err
+	}
+	holds, err := queryRefs("SELECT id, status, copy_id FROM holds WHERE book_id = ? AND status IN ('waiting', 'ready') ORDER BY created_at, id")
+	if err != nil {
+		return err
+	}
+	inv.ActiveLoans = len(loans)
+	for _, h := range holds {
+		if h.status == "ready" {
+			inv.ReadyHolds++
+		} else {
+			inv.WaitingHolds++
+		}
+	}
+	inv.Balanced = inv.Available+inv.ActiveLoans+inv.ReadyHolds == inv.Capacity
+
+	issue := func(kind, format string, args ...interface{}) *InventoryIssue {
+		inv.Issues = append(inv.Issues, InventoryIssue{BookID: inv.BookID, BookTitle: inv.Title, Kind: kind, Description: fmt.Sprintf(format, args...)})
+		return &inv.Issues[len(inv.Issues)-1]
+	}
+
+	// Cada copia prestada o apartada debe estar ocupada por exactamente un
+	// préstamo activo o una reserva apartada del mismo libro
+	usedBy := make(map[int]string)
+	var loansWithoutCopy, holdsWithoutCopy []ref
+	for _, l := range loans {
+		c, ok := copies[int(l.copyID.Int64)]
+		if !l.copyID.Valid || !ok || c.Status != "loaned" || usedBy[c.ID] != "" {
+			loansWithoutCopy = append(loansWithoutCopy, l)
+			continue
+		}
+		usedBy[c.ID] = "loan"
+	}
+	for _, h := range holds {
+		if h.status != "ready" {
+			continue
+		}
+		c, ok := copies[int(h.copyID.Int64)]
+		if !h.copyID.Valid || !ok || c.Status != "reserved" || usedBy[c.ID] != "" {
+			holdsWithoutCopy = append(holdsWithoutCopy, h)
+			continue
+		}
+		usedBy[c.ID] = "hold"
+	}
+
+	// 1. Copias ocupadas sin préstamo ni reserva: se liberan
+	for _, id := range copyOrder {
+		c := copies[id]
+		if (c.Status != "loaned" && c.Status != "reserved") || usedBy[id] != "" {
+			continue
+		}
+		kind, what := "copia_prestada_sin_prestamo", "prestada sin préstamo activo"
+		if c.Status == "reserved" {
+			kind, what = "copia_apartada_sin_reserva", "apartada sin reserva"
+		}
+		found := issue(kind, "La copia %d está %s", id, what)
+		if fix {
+			if err := releaseCopy(ctx, tx, id, now, s.holdPickupWindow); err != nil {
+				return err
+			}
+			found.Fixed = true
+		}
+	}
+
+	// 2. Préstamos activos sin copia válida: se les asigna una disponible
+	for _, l := range loansWithoutCopy {
+		found := issue("prestamo_sin_copia", "El préstamo activo %d no ocupa ninguna copia prestada del libro", l.id)
+		if !fix {
+			continue
+		}
+		copyID, err := claimAvailableCopy(ctx, tx, s.db.dialect, inv.BookID, now, "loaned")
+		if errors.Is(err, ErrNoStock) {
+			found.Description += " (no hay copias disponibles para asignarle)"
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE loans SET copy_id = ? WHERE id = ?", copyID, l.id); err != nil {
+			return err
+		}
+		found.Fixed = true
+	}
+
+	// 3. Reservas apartadas sin copia válida: reciben una disponible o vuelven a la cola
+	for _, h := range holdsWithoutCopy {
+		found := issue("reserva_sin_copia", "La reserva apartada %d no tiene ninguna copia apartada del libro", h.id)
+		if !fix {
+			continue
+		}
+		copyID, err := claimAvailableCopy(ctx, tx, s.db.dialect, inv.BookID, now, "reserved")
+		switch {
+		case err == nil:
+			_, err = tx.ExecContext(ctx, "UPDATE holds SET copy_id = ? WHERE id = ?", copyID, h.id)
+		case errors.Is(err, ErrNoStock):
+			_, err = tx.ExecContext(ctx, "UPDATE holds SET status = 'waiting', copy_id = NULL, ready_at = NULL, expires_at = NULL WHERE id = ?", h.id)
+		}
+		if err != nil {
+			return err
+		}
+		found.Fixed = true
+	}
+
+	// 4. Copias disponibles cuya licencia ya no admite préstamos: se retiran
+	for _, id := range copyOrder {
+		c := copies[id]
+		if c.Status != "available" || !licenceExhausted(c, now) {
+			continue
+		}
+		found := issue("licencia_agotada", "La copia %d sigue disponible con la licencia agotada o vencida", id)
+		if fix {
+			if _, err := tx.ExecContext(ctx, "UPDATE copies SET status = 'retired', retired_at = ? WHERE id = ? AND status = 'available'", now, id); err != nil {
+				return err
+			}
+			found.Fixed = true
+		}
+	}
+
+	// 5. Copias disponibles con reservas en cola: se apartan para ellas
+	if inv.Available > 0 && inv.WaitingHolds > 0 {
+		found := issue("cola_sin_atender", "Hay %d copias disponibles y %d reservas en cola", inv.Available, inv.WaitingHolds)
+		if fix {
+			for {
+				var waiting int
+				if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM holds WHERE book_id = ? AND status = 'waiting'", inv.BookID).Scan(&waiting); err != nil {
+					return err
+				}
+				if waiting == 0 {
+					break
+				}
+				// Se marca prestada para que releaseCopy la aparte para la primera reserva
+				copyID, err := claimAvailableCopy(ctx, tx, s.db.dialect, inv.BookID, now, "loaned")
+				if errors.Is(err, ErrNoStock) {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				if err := releaseCopy(ctx, tx, copyID, now, s.holdPickupWindow); err != nil {
+					return err
+				}
+			}
+			found.Fixed = true
+		}
+	}
+
+	if fix {
+		return tx.Commit()
+	}
+	return nil
+}
+
+func (s *sqlInventoryStore) SaveRun(ctx context.Context, run *ReconciliationRun) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id, err := s.db.dialect.insert(ctx, tx, "INSERT INTO reconciliation_runs (source, fix, started_at, books_checked, issues_found, issues_fixed) VALUES (?, ?, ?, ?, ?, ?)",
+		run.Source, run.Fix, run.StartedAt, run.BooksChecked, run.IssuesFound, run.IssuesFixed)
+	if err != nil {
+		return err
+	}
+	for _, issue := range run.Issues {
+		_, err := tx.ExecContext(ctx, "INSERT INTO reconciliation_issues (run_id, book_id, book_title, kind, description, fixed) VALUES (?, ?, ?, ?, ?, ?)",
+			id, issue.BookID, issue.BookTitle, issue.Kind, issue.Description, issue.Fixed)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	run.ID = int(id)
+	return nil
+}
+
+func (s *sqlInventoryStore) ListRuns(ctx context.Context, limit int) ([]ReconciliationRun, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, source, fix, started_at, books_checked, issues_found, issues_fixed FROM reconciliation_runs ORDER BY started_at DESC, id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	var runs []ReconciliationRun
+	for rows.Next() {
+		var run ReconciliationRun
+		if err := rows.Scan(&run.ID, &run.Source, &run.Fix, &run.StartedAt, &run.BooksChecked, &run.IssuesFound, &run.IssuesFixed); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range runs {
+		rows, err := s.db.QueryContext(ctx, "SELECT book_id, book_title, kind, description, fixed FROM reconciliation_issues WHERE run_id = ? ORDER BY id", runs[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var issue InventoryIssue
+			if err := rows.Scan(&issue.BookID, &issue.BookTitle, &issue.Kind, &issue.Description, &issue.Fixed); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			runs[i].Issues = append(runs[i].Issues, issue)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+// --- Reseñas ---
+
+const reviewColumns = `r.id, r.book_id, r.user_id, u.name, b.title, r.rating, r.body, r.status, r.created_at, r.updated_at, r.moderated_at`
+
+// reviewFrom une cada reseña con su autor y su libro.
+const reviewFrom = " FROM reviews r JOIN users u ON u.id = r.user_id JOIN books b ON b.id = r.book_id"
+
+func scanReview(s rowScanner) (Review, error) {
+	var rv Review
+	err := s.Scan(&rv.ID, &rv.BookID, &rv.UserID, &rv.UserName, &rv.BookTitle, &rv.Rating, &rv.Body, &rv.Status, &rv.CreatedAt, &rv.UpdatedAt, &rv.ModeratedAt)
+	return rv, err
+}
+
+func (s *sqlReviewStore) queryReviews(ctx context.Context, query string, args ...interface{}) ([]Review, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []Review
+	for rows.Next() {
+		rv, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, rv)
+	}
+	return reviews, rows.Err()
+}
+
+// hasBorrowed indica si el usuario tiene el libro prestado o lo ha devuelto
+// alguna vez. Los préstamos que vencieron sin devolverse no cuentan.
+func hasBorrowed(ctx context.Context, q execQueryer, userID, bookID int) (bool, error) {
+	var count int
+	err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM loans WHERE user_id = ? AND book_id = ? AND status IN ('active', 'returned')", userID, bookID).Scan(&count)
+	return count > 0, err
+}
+
+func (s *sqlReviewStore) Save(ctx context.Context, review *Review, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	borrowed, err := hasBorrowed(ctx, tx, review.UserID, review.BookID)
+	if err != nil {
+		return err
+	}
+	if !borrowed {
+		return ErrNotBorrowed
+	}
+
+	// Al editar una reseña vuelve a quedar pendiente de moderar
+	var id int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM reviews WHERE user_id = ? AND book_id = ?", review.UserID, review.BookID).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		id, err = s.db.dialect.insert(ctx, tx, "INSERT INTO reviews (book_id, user_id, rating, body, status, created_at, updated_at) VALUES (?, ?, ?, ?, 'pending', ?, ?)",
+			review.BookID, review.UserID, review.Rating, review.Body, now, now)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		_, err = tx.ExecContext(ctx, "UPDATE reviews SET rating = ?, body = ?, status = 'pending', updated_at = ?, moderated_at = NULL WHERE id = ?", review.Rating, review.Body, now, id)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	review.ID = int(id)
+	review.Status = "pending"
+	return nil
+}
+
+func (s *sqlReviewStore) GetByUser(ctx context.Context, userID, bookID int) (Review, error) {
+	rv, err := scanReview(s.db.QueryRowContext(ctx, "SELECT "+reviewColumns+reviewFrom+" WHERE r.user_id = ? AND r.book_id = ?", userID, bookID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return rv, ErrNotFound
+	}
+	return rv, err
+}
+
+func (s *sqlReviewStore) CanReview(ctx context.Context, userID, bookID int) (bool, error) {
+	return hasBorrowed(ctx, s.db, userID, bookID)
+}
+
+func (s *sqlReviewStore) ListApproved(ctx context.Context, bookID int) ([]Review, error) {
+	return s.queryReviews(ctx, "SELECT "+reviewColumns+reviewFrom+" WHERE r.book_id = ? AND r.status = 'approved' ORDER BY r.updated_at DESC, r.id DESC", bookID)
+}
+
+func (s *sqlReviewStore) ListByStatus(ctx context.Context, status string) ([]Review, error) {
+	return s.queryReviews(ctx, "SELECT "+reviewColumns+reviewFrom+" WHERE r.status = ? ORDER BY r.updated_at, r.id", status)
+}
+
+func (s *sqlReviewStore) Moderate(ctx context.Context, reviewID int, status string, now time.Time) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE reviews SET status = ?, moderated_at = ? WHERE id = ?", status, now, reviewID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// --- Preventas ---
+
+const preorderColumns = `p.id, p.user_id, p.book_id, p.status, p.created_at, p.processed_at,
+	b.id, b.title, b.author, b.cover_image_path, b.release_date`
+
+func scanPreorder(s rowScanner) (Preorder, error) {
+	var p Preorder
+	err := s.Scan(&p.ID, &p.UserID, &p.BookID, &p.Status, &p.CreatedAt, &p.ProcessedAt,
+		&p.Book.ID, &p.Book.Title, &p.Book.Author, &p.Book.CoverImagePath, &p.Book.ReleaseAt)
+	return p, err
+}
+
+func (s *sqlPreorderStore) queryPreorders(ctx context.Context, query string, args ...interface{}) ([]Preorder, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var preorders []Preorder
+	for rows.Next() {
+		p, err := scanPreorder(rows)
+		if err != nil {
+			return nil, err
+		}
+		preorders = append(preorders, p)
+	}
+	return preorders, rows.Err()
+}
+
+func (s *sqlPreorderStore) Create(ctx context.Context, userID, bookID int, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var releaseAt time.Time
+	err = tx.QueryRowContext(ctx, "SELECT release_date FROM books WHERE id = ?", bookID).Scan(&releaseAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !releaseAt.After(now) {
+		return ErrAlreadyReleased
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM preorders WHERE user_id = ? AND book_id = ? AND status = 'pending'", userID, bookID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAlreadyPreordered
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO preorders (user_id, book_id, status, created_at) VALUES (?, ?, 'pending', ?)", userID, bookID, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlPreorderStore) Cancel(ctx context.Context, userID, preorderID int, now time.Time) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE preorders SET status = 'cancelled', processed_at = ? WHERE id = ? AND user_id = ? AND status = 'pending'", now, preorderID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *sqlPreorderStore) ListByUser(ctx context.Context, userID int) ([]Preorder, error) {
+	return s.queryPreorders(ctx, "SELECT "+preorderColumns+" FROM preorders p JOIN books b ON p.book_id = b.id WHERE p.user_id = ? AND p.status = 'pending' ORDER BY b.release_date, p.created_at", userID)
+}
+
+func (s *sqlPreorderStore) ListDue(ctx context.Context, now time.Time) ([]Preorder, error) {
+	return s.queryPreorders(ctx, "SELECT "+preorderColumns+" FROM preorders p JOIN books b ON p.book_id = b.id WHERE p.status = 'pending' AND b.release_date <= ? ORDER BY b.release_date, p.book_id, p.created_at, p.id", now)
+}
+
+func (s *sqlPreorderStore) MarkProcessed(ctx context.Context, preorderID int, status string, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE preorders SET status = ?, processed_at = ? WHERE id = ? AND status = 'pending'", status, now, preorderID)
+	return err
+}
+
+func (s *sqlPreorderStore) MarkAttempted(ctx context.Context, preorderID int, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE preorders SET processed_at = ? WHERE id = ? AND status = 'pending'", now, preorderID)
+	return err
+}
+
+// --- Intentos de login fallidos ---
+
+func (s *sqlLoginFailureStore) Get(ctx context.Context, scope, identifier string) (LoginLock, error) {
+	lock := LoginLock{Scope: scope, Identifier: identifier}
+	var lockedUntil sql.NullTime
+	err := s.db.QueryRowContext(ctx, "SELECT failures, last_failure_at, locked_until FROM login_failures WHERE scope = ? AND identifier = ?", scope, identifier).
+		Scan(&lock.Failures, &lock.LastFailureAt, &lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return lock, ErrNotFound
+	}
+	if lockedUntil.Valid {
+		lock.LockedUntil = lockedUntil.Time
+	}
+	return lock, err
+}
+
+func (s *sqlLoginFailureStore) RecordFailure(ctx context.Context, scope, identifier string, now time.Time, throttle LoginThrottle) (LoginLock, error) {
+	lock := LoginLock{Scope: scope, Identifier: identifier, LastFailureAt: now}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return lock, err
+	}
+	defer tx.Rollback()
+
+	// El incremento se hace en la base de datos para que dos fallos
+	// simultáneos no se pisen. Un contador caducado (bloqueo vencido o sin
+	// fallos recientes) vuelve a empezar en 1. MySQL evalúa las asignaciones
+	// en orden con los valores ya actualizados, así que last_failure_at va la
+	// última
+	expired := "(login_failures.locked_until <= ? OR login_failures.last_failure_at < ?)"
+	query := s.db.dialect.upsertSet("INSERT INTO login_failures (scope, identifier, failures, last_failure_at) VALUES (?, ?, 1, ?)",
+		[]string{"scope", "identifier"},
+		"failures = CASE WHEN "+expired+" THEN 1 ELSE login_failures.failures + 1 END, "+
+			"locked_until = CASE WHEN "+expired+" THEN NULL ELSE login_failures.locked_until END, "+
+			"last_failure_at = ?")
+	staleBefore := now.Add(-throttle.LockDuration.Duration)
+	if _, err := tx.ExecContext(ctx, query, scope, identifier, now, now, staleBefore, now, staleBefore, now); err != nil {
+		return lock, err
+	}
+
+	// La fila queda bloqueada por el upsert hasta el commit, así que el valor
+	// leído incluye este fallo y ninguno posterior
+	err = tx.QueryRowContext(ctx, "SELECT failures FROM login_failures WHERE scope = ? AND identifier = ?", scope, identifier).Scan(&lock.Failures)
+	if err != nil {
+		return lock, err
+	}
+	if lock.Failures >= throttle.MaxFailures {
+		lock.LockedUntil = now.Add(throttle.LockDuration.Duration)
+		_, err = tx.ExecContext(ctx, "UPDATE login_failures SET locked_until = ? WHERE scope = ? AND identifier = ?", lock.LockedUntil, scope, identifier)
+		if err != nil {
+			return lock, err
+		}
+	}
+	return lock, tx.Commit()
+}
+
+func (s *sqlLoginFailureStore) Delete(ctx context.Context, scope, identifier string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_failures WHERE scope = ? AND identifier = ?", scope, identifier)
+	return err
+}
+
+func (s *sqlLoginFailureStore) ListLocked(ctx context.Context, now time.Time) ([]LoginLock, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT scope, identifier, failures, last_failure_at, locked_until FROM login_failures WHERE locked_until > ? ORDER BY locked_until DESC", now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locks []LoginLock
+	for rows.Next() {
+		var lock LoginLock
+		if err := rows.Scan(&lock.Scope, &lock.Identifier, &lock.Failures, &lock.LastFailureAt, &lock.LockedUntil); err != nil {
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+	return locks, rows.Err()
+}
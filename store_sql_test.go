@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sqliteTestDBs numera las bases de datos en memoria de los tests para que
+// cada uno tenga la suya.
+var sqliteTestDBs atomic.Int64
+
+// newSQLTestApp devuelve una App con la configuración por defecto sobre una
+// base de datos SQLite en memoria con todas las migraciones aplicadas.
+func newSQLTestApp(t *testing.T) *App {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.DSN = fmt.Sprintf("file:test%d?mode=memory&cache=shared", sqliteTestDBs.Add(1))
+	// La base de datos desaparece al cerrarse su única conexión
+	cfg.Database.ConnMaxLifetime.Duration = 0
+	app, err := newApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.DB.Close() })
+	if _, err := migrateUp(app.DB); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestSQLiteMigrationsRoundTrip(t *testing.T) {
+	app := newSQLTestApp(t)
+	status, err := migrationStatus(app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := migrateDown(app.DB, len(status))
+	if err != nil {
+		t.Fatalf("migrateDown: %v", err)
+	}
+	if reverted != len(status) {
+		t.Errorf("revertidas %d migraciones, want %d", reverted, len(status))
+	}
+	applied, err := migrateUp(app.DB)
+	if err != nil {
+		t.Fatalf("migrateUp tras revertir: %v", err)
+	}
+	if applied != len(status) {
+		t.Errorf("aplicadas %d migraciones, want %d", applied, len(status))
+	}
+}
+
+// addTestCopies añade n copias disponibles al libro.
+func addTestCopies(t *testing.T, app *App, bookID, n int) {
+	t.Helper()
+	now := time.Now()
+	if err := app.Copies.Add(context.Background(), Copy{BookID: bookID, AcquiredAt: now}, n, now); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// storeFixture son los stores de libros, usuarios y préstamos de una
+// implementación, para comprobar que todas cumplen el mismo contrato.
+type storeFixture struct {
+	Books BookStore
+	Users UserStore
+	Loans LoanStore
+	// addStock añade n copias disponibles al libro
+	addStock func(t *testing.T, bookID, n int)
+}
+
+// storeImplementations son los stores en memoria de los tests de handlers y
+// los SQL sobre SQLite. Si el contrato cambia, los dos deben seguirlo.
+var storeImplementations = []struct {
+	name       string
+	newFixture func(t *testing.T) storeFixture
+}{
+	{"memoria", func(t *testing.T) storeFixture {
+		data := newMemData()
+		return storeFixture{
+			Books: memBookStore{data},
+			Users: memUserStore{data},
+			Loans: memLoanStore{data},
+			addStock: func(t *testing.T, bookID, n int) {
+				data.mu.Lock()
+				defer data.mu.Unlock()
+				book := data.books[bookID]
+				book.Stock += n
+				data.books[bookID] = book
+			},
+		}
+	}},
+	{"sqlite", func(t *testing.T) storeFixture {
+		app := newSQLTestApp(t)
+		return storeFixture{
+			Books: app.Books,
+			Users: app.Users,
+			Loans: app.Loans,
+			addStock: func(t *testing.T, bookID, n int) {
+				t.Helper()
+				now := time.Now()
+				if err := app.Copies.Add(context.Background(), Copy{BookID: bookID, AcquiredAt: now}, n, now); err != nil {
+					t.Fatal(err)
+				}
+			},
+		}
+	}},
+}
+
+// forEachStore ejecuta test con cada implementación de los stores.
+func forEachStore(t *testing.T, test func(t *testing.T, s storeFixture)) {
+	for _, impl := range storeImplementations {
+		t.Run(impl.name, func(t *testing.T) {
+			test(t, impl.newFixture(t))
+		})
+	}
+}
+
+// mustCreateBook crea un libro publicado hace un día si no se indica ReleaseAt.
+func (s storeFixture) mustCreateBook(t *testing.T, book Book) Book {
+	t.Helper()
+	if book.ReleaseAt.IsZero() {
+		book.ReleaseAt = time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	}
+	if err := s.Books.Create(context.Background(), &book); err != nil {
+		t.Fatal(err)
+	}
+	return book
+}
+
+func (s storeFixture) mustCreateUser(t *testing.T, user User) User {
+	t.Helper()
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	if user.Name == "" {
+		user.Name = user.Username
+	}
+	if err := s.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// stock devuelve el stock actual del libro.
+func (s storeFixture) stock(t *testing.T, bookID int) int {
+	t.Helper()
+	book, err := s.Books.Get(context.Background(), bookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return book.Stock
+}
+
+func TestBookStore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s storeFixture) {
+		ctx := context.Background()
+		first := s.mustCreateBook(t, Book{Title: "Niebla", CoverImagePath: "niebla.jpg"})
+		second := s.mustCreateBook(t, Book{Title: "Nada"})
+		if first.ID == 0 || second.ID == first.ID {
+			t.Fatalf("IDs asignados: %d y %d", first.ID, second.ID)
+		}
+
+		got, err := s.Books.GetByTitle(ctx, "Niebla")
+		if err != nil || got.ID != first.ID {
+			t.Fatalf("GetByTitle = %+v, %v", got, err)
+		}
+		if count, _ := s.Books.Count(ctx); count != 2 {
+			t.Errorf("Count = %d, want 2", count)
+		}
+		books, err := s.Books.List(ctx, "")
+		if err != nil || len(books) != 2 || books[0].ID != second.ID {
+			t.Errorf("List = %+v, %v; want los más recientes primero", books, err)
+		}
+		if books, _ := s.Books.List(ctx, "nie"); len(books) != 1 || books[0].ID != first.ID {
+			t.Errorf("List(nie) = %+v", books)
+		}
+
+		// Una ruta de portada vacía no borra la anterior
+		first.Title = "Niebla (edición revisada)"
+		first.CoverImagePath = ""
+		if err := s.Books.Update(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+		got, err = s.Books.Get(ctx, first.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != first.Title || got.CoverImagePath != "niebla.jpg" {
+			t.Errorf("tras Update: título %q, portada %q", got.Title, got.CoverImagePath)
+		}
+		if err := s.Books.Update(ctx, Book{ID: 9999, Title: "Nadie"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Update de un libro inexistente: error = %v, want ErrNotFound", err)
+		}
+
+		if err := s.Books.Delete(ctx, first.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Books.Get(ctx, first.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get tras Delete: error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestUserStore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s storeFixture) {
+		ctx := context.Background()
+		user := s.mustCreateUser(t, User{Username: "lector", Email: "lector@example.com", Password: "hash-1"})
+
+		got, err := s.Users.Get(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Username != "lector" || got.Password != "" {
+			t.Errorf("Get = %+v; want sin el hash de la contraseña", got)
+		}
+		if got, _ := s.Users.GetByUsername(ctx, "lector"); got.Password != "hash-1" {
+			t.Errorf("GetByUsername: Password = %q, want el hash", got.Password)
+		}
+		if users, _ := s.Users.List(ctx); len(users) != 1 || users[0].Password != "" {
+			t.Errorf("List = %+v; want sin el hash", users)
+		}
+
+		// Update sin contraseña conserva el hash
+		user.Name = "Lectora"
+		user.Password = ""
+		if err := s.Users.Update(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := s.Users.GetByUsername(ctx, "lector"); got.Name != "Lectora" || got.Password != "hash-1" {
+			t.Errorf("tras Update: %+v", got)
+		}
+		if err := s.Users.SetPassword(ctx, "lector", "hash-2"); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := s.Users.GetByUsername(ctx, "lector"); got.Password != "hash-2" {
+			t.Errorf("tras SetPassword: Password = %q", got.Password)
+		}
+		if err := s.Users.SetPassword(ctx, "nadie", "hash"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("SetPassword de un usuario inexistente: error = %v, want ErrNotFound", err)
+		}
+
+		if err := s.Users.Delete(ctx, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Users.Get(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get tras Delete: error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestLoanStoreCreateAndReturn(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s storeFixture) {
+		ctx := context.Background()
+		user := s.mustCreateUser(t, User{Username: "lector"})
+		book := s.mustCreateBook(t, Book{Title: "Niebla"})
+		now := time.Now()
+		due := now.Add(time.Hour)
+
+		if err := s.Loans.Create(ctx, user.ID, book.ID, now, due, 0); !errors.Is(err, ErrNoStock) {
+			t.Fatalf("Create sin stock: error = %v, want ErrNoStock", err)
+		}
+		if err := s.Loans.Create(ctx, user.ID, 9999, now, due, 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Create de un libro inexistente: error = %v, want ErrNotFound", err)
+		}
+		s.addStock(t, book.ID, 1)
+		if err := s.Loans.Create(ctx, user.ID, book.ID, now, due, 0); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if got := s.stock(t, book.ID); got != 0 {
+			t.Errorf("Stock tras prestar = %d, want 0", got)
+		}
+		if err := s.Loans.Create(ctx, user.ID, book.ID, now, due, 0); !errors.Is(err, ErrAlreadyLoaned) {
+			t.Errorf("segundo Create: error = %v, want ErrAlreadyLoaned", err)
+		}
+		if active, _ := s.Loans.HasActive(ctx, user.ID, book.ID); !active {
+			t.Error("HasActive = false tras prestar")
+		}
+		loans, err := s.Loans.ListByUser(ctx, user.ID)
+		if err != nil || len(loans) != 1 || loans[0].Book.Title != "Niebla" || loans[0].Status != "active" {
+			t.Fatalf("ListByUser = %+v, %v", loans, err)
+		}
+
+		if err := s.Loans.Return(ctx, user.ID, book.ID, now.Add(time.Minute)); err != nil {
+			t.Fatalf("Return: %v", err)
+		}
+		if got := s.stock(t, book.ID); got != 1 {
+			t.Errorf("Stock tras devolver = %d, want 1", got)
+		}
+		if err := s.Loans.Return(ctx, user.ID, book.ID, now.Add(time.Minute)); !errors.Is(err, ErrNoActiveLoan) {
+			t.Errorf("segundo Return: error = %v, want ErrNoActiveLoan", err)
+		}
+		loans, _ = s.Loans.ListByUser(ctx, user.ID)
+		if len(loans) != 1 || loans[0].Status != "returned" || !loans[0].ReturnDate.Valid {
+			t.Errorf("ListByUser tras devolver = %+v", loans)
+		}
+		if count, _ := s.Loans.Count(ctx); count != 1 {
+			t.Errorf("Count = %d, want 1", count)
+		}
+	})
+}
+
+func TestLoanStoreExpireOverdue(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s storeFixture) {
+		ctx := context.Background()
+		user := s.mustCreateUser(t, User{Username: "lector"})
+		now := time.Now()
+		overdue := s.mustCreateBook(t, Book{Title: "Vencido", ReleaseAt: now.Add(-60 * 24 * time.Hour)})
+		current := s.mustCreateBook(t, Book{Title: "Vigente"})
+		s.addStock(t, overdue.ID, 1)
+		s.addStock(t, current.ID, 1)
+		if err := s.Loans.Create(ctx, user.ID, overdue.ID, now.Add(-15*24*time.Hour), now.Add(-time.Hour), 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Loans.Create(ctx, user.ID, current.ID, now, now.Add(time.Hour), 0); err != nil {
+			t.Fatal(err)
+		}
+
+		expired, err := s.Loans.ExpireOverdue(ctx, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(expired) != 1 || expired[0].BookID != overdue.ID || expired[0].UserID != user.ID {
+			t.Fatalf("ExpireOverdue = %+v, want solo el préstamo vencido", expired)
+		}
+		if active, _ := s.Loans.HasActive(ctx, user.ID, overdue.ID); active {
+			t.Error("el préstamo vencido sigue activo")
+		}
+		if active, _ := s.Loans.HasActive(ctx, user.ID, current.ID); !active {
+			t.Error("el préstamo vigente dejó de estar activo")
+		}
+		if got := s.stock(t, overdue.ID); got != 1 {
+			t.Errorf("Stock del libro vencido = %d, want 1", got)
+		}
+		if again, _ := s.Loans.ExpireOverdue(ctx, now); len(again) != 0 {
+			t.Errorf("segunda ExpireOverdue = %+v, want ninguno", again)
+		}
+	})
+}
+
+func TestLoanStoreRenew(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s storeFixture) {
+		ctx := context.Background()
+		user := s.mustCreateUser(t, User{Username: "lector"})
+		book := s.mustCreateBook(t, Book{Title: "Niebla"})
+		s.addStock(t, book.ID, 1)
+		now := time.Now().Truncate(time.Second)
+		due := now.Add(time.Hour)
+		week := 7 * 24 * time.Hour
+
+		if _, err := s.Loans.Renew(ctx, user.ID, book.ID, now, week, 2); !errors.Is(err, ErrNoActiveLoan) {
+			t.Errorf("Renew sin préstamo: error = %v, want ErrNoActiveLoan", err)
+		}
+		if err := s.Loans.Create(ctx, user.ID, book.ID, now, due, 0); err != nil {
+			t.Fatal(err)
+		}
+		// La ampliación cuenta desde el vencimiento, no desde now
+		got, err := s.Loans.Renew(ctx, user.ID, book.ID, now, week, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := due.Add(week); !got.Equal(want) {
+			t.Errorf("primera renovación hasta %v, want %v", got, want)
+		}
+		if _, err := s.Loans.Renew(ctx, user.ID, book.ID, now, week, 2); err != nil {
+			t.Fatalf("segunda renovación: %v", err)
+		}
+		if _, err := s.Loans.Renew(ctx, user.ID, book.ID, now, week, 2); !errors.Is(err, ErrRenewalLimit) {
+			t.Errorf("tercera renovación: error = %v, want ErrRenewalLimit", err)
+		}
+		loans, _ := s.Loans.ListByUser(ctx, user.ID)
+		if len(loans) != 1 || loans[0].RenewalCount != 2 {
+			t.Errorf("ListByUser = %+v, want 2 renovaciones", loans)
+		}
+
+		// Un préstamo vencido que aún no ha expirado ya no se renueva
+		late := due.Add(3 * week)
+		if _, err := s.Loans.Renew(ctx, user.ID, book.ID, late, week, 5); !errors.Is(err, ErrNoActiveLoan) {
+			t.Errorf("Renew de un préstamo vencido: error = %v, want ErrNoActiveLoan", err)
+		}
+	})
+}
+
+func TestLoanStoreLoanLimit(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s storeFixture) {
+		ctx := context.Background()
+		user := s.mustCreateUser(t, User{Username: "lector"})
+		now := time.Now()
+		var books []Book
+		for _, title := range []string{"Uno", "Dos", "Tres"} {
+			book := s.mustCreateBook(t, Book{Title: title})
+			s.addStock(t, book.ID, 1)
+			books = append(books, book)
+		}
+
+		for _, book := range books[:2] {
+			if err := s.Loans.Create(ctx, user.ID, book.ID, now, now.Add(time.Hour), 2); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Loans.Create(ctx, user.ID, books[2].ID, now, now.Add(time.Hour), 2); !errors.Is(err, ErrLoanLimit) {
+			t.Fatalf("Create por encima del límite: error = %v, want ErrLoanLimit", err)
+		}
+		if got := s.stock(t, books[2].ID); got != 1 {
+			t.Errorf("Stock tras rechazar el préstamo = %d, want 1", got)
+		}
+		if count, _ := s.Loans.CountActiveByUser(ctx, user.ID); count != 2 {
+			t.Errorf("CountActiveByUser = %d, want 2", count)
+		}
+		// 0 es sin límite
+		if err := s.Loans.Create(ctx, user.ID, books[2].ID, now, now.Add(time.Hour), 0); err != nil {
+			t.Errorf("Create sin límite: %v", err)
+		}
+	})
+}